@@ -0,0 +1,180 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// lockKey is the key marked by the replica evaluating the rules.
+const lockKey = "evaluate"
+
+// Evaluator periodically checks the rules against the counts of their hit ID, and notifies the changes of their status.
+//
+// A rule is notified once when it starts firing, not at every evaluation, and again once resolved.
+// It is notified firing again only after its cooldown since the previous firing notification.
+// The state is saved only once notified, so a failed notification is sent again at the next evaluation.
+type Evaluator struct {
+	rules     Store
+	retriever store.ViewRetriever
+	notifier  Notifier
+	logger    *slog.Logger
+
+	interval time.Duration
+	lock     filter.Marker
+
+	now func() time.Time
+}
+
+type Option func(*Evaluator)
+
+// Default interval is 1 minute.
+func WithInterval(interval time.Duration) func(*Evaluator) {
+	return func(e *Evaluator) {
+		e.interval = interval
+	}
+}
+
+// WithLock evaluates the rules on a single replica per interval, the one marking the lock first, e.g. filter.RedisMarker.
+// Default is to evaluate on every replica.
+func WithLock(lock filter.Marker) func(*Evaluator) {
+	return func(e *Evaluator) {
+		e.lock = lock
+	}
+}
+
+// The logger can be nil.
+func NewEvaluator(rules Store, retriever store.ViewRetriever, notifier Notifier, logger *slog.Logger, opts ...Option) *Evaluator {
+	e := &Evaluator{
+		rules:     rules,
+		retriever: retriever,
+		notifier:  notifier,
+		logger:    logging.OrDiscard(logger).With(slog.String("component", "alert")),
+		interval:  time.Minute,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Run evaluates the rules at every interval, until the context is done.
+func (e *Evaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := e.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Error("evaluate alert rules", logging.Error(err))
+		}
+	}
+}
+
+// Evaluate checks every rule, and notifies the rules whose status changed.
+// A failed rule does not stop the others, the first error is returned.
+func (e *Evaluator) Evaluate(ctx context.Context) error {
+	if e.lock != nil {
+		// Expire before the next interval, so the next evaluation is not skipped.
+		locked, err := e.lock.Mark(ctx, lockKey, e.interval/2)
+		if err != nil {
+			return errors.Wrap(err, "lock")
+		}
+
+		if !locked {
+			return nil
+		}
+	}
+
+	rules, err := e.rules.List(ctx, "")
+	if err != nil {
+		return errors.Wrap(err, "list rules")
+	}
+
+	var firstErr error
+
+	for _, rule := range rules {
+		if err := e.evaluate(ctx, rule); err != nil {
+			e.logger.Error("evaluate alert rule", slog.String("rule_id", rule.ID), logging.Error(err))
+
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "rule %s", rule.ID)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, rule Rule) error {
+	counts, err := e.retriever.Retrieve(ctx, store.ViewQuery{
+		Tenant: rule.Tenant,
+		ID:     rule.HitID,
+		Ranges: rule.ranges(),
+	})
+	if err != nil {
+		return err
+	}
+
+	count, limit, firing, err := rule.check(counts)
+	if err != nil {
+		return err
+	}
+
+	state, err := e.rules.State(ctx, rule.ID)
+	if err != nil {
+		return err
+	}
+
+	now := e.now()
+
+	var status Status
+
+	switch {
+	case firing && !state.Firing:
+		if now.Sub(state.LastNotified) < rule.Cooldown {
+			return nil
+		}
+
+		status = StatusFiring
+		state = State{Firing: true, LastNotified: now}
+
+	case !firing && state.Firing:
+		status = StatusResolved
+		state.Firing = false
+
+	default:
+		return nil
+	}
+
+	err = e.notifier.Notify(ctx, rule, Event{
+		RuleID:    rule.ID,
+		HitID:     rule.HitID,
+		Status:    status,
+		Window:    rule.Window,
+		Count:     count,
+		Limit:     limit,
+		Timestamp: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.logger.Info("alert notified", slog.String("rule_id", rule.ID), slog.String("status", string(status)), slog.Int64("count", count))
+
+	return e.rules.SetState(ctx, rule.ID, state)
+}
@@ -0,0 +1,184 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// notifier records the events.
+type notifier struct {
+	events []Event
+	err    error
+}
+
+func (n *notifier) Notify(ctx context.Context, rule Rule, event Event) error {
+	if n.err != nil {
+		return n.err
+	}
+
+	n.events = append(n.events, event)
+
+	return nil
+}
+
+func (n *notifier) statuses() []Status {
+	var statuses []Status
+	for _, event := range n.events {
+		statuses = append(statuses, event.Status)
+	}
+
+	return statuses
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1600000000, 0)
+
+	var count int64
+
+	retriever := &mock.ViewRetriever{
+		OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+			assert.Equal(t, "acme", q.Tenant)
+			assert.Equal(t, "1", q.ID)
+			assert.Equal(t, []store.Range{store.FiveMinute}, q.Ranges)
+
+			return []store.ViewCount{{Description: store.RangeDescription(store.FiveMinute), Count: count}}, nil
+		},
+	}
+
+	rules := NewMemoryStore()
+	rules.Create(ctx, Rule{ID: "r1", Tenant: "acme", HitID: "1", Kind: KindThreshold, Window: "5m", Threshold: 10, Cooldown: time.Hour})
+
+	n := &notifier{}
+
+	e := NewEvaluator(rules, retriever, n, nil)
+	e.now = func() time.Time { return now }
+
+	evaluate := func(c int64, advance time.Duration) {
+		count = c
+		now = now.Add(advance)
+
+		assert.NoError(t, e.Evaluate(ctx))
+	}
+
+	evaluate(5, 0)
+	assert.Empty(t, n.events)
+
+	// Notified once while firing.
+	evaluate(11, time.Minute)
+	evaluate(20, time.Minute)
+	assert.Equal(t, []Status{StatusFiring}, n.statuses())
+	assert.Equal(t, Event{RuleID: "r1", HitID: "1", Status: StatusFiring, Window: "5m", Count: 11, Limit: 10, Timestamp: now.Add(-time.Minute)}, n.events[0])
+
+	evaluate(3, time.Minute)
+	assert.Equal(t, []Status{StatusFiring, StatusResolved}, n.statuses())
+
+	// Firing again within the cooldown is not notified.
+	evaluate(11, time.Minute)
+	assert.Len(t, n.events, 2)
+
+	evaluate(11, time.Hour)
+	assert.Equal(t, []Status{StatusFiring, StatusResolved, StatusFiring}, n.statuses())
+
+	// A failed notification is sent at the next evaluation.
+	n.err = errors.New("timeout")
+	count = 0
+	assert.EqualError(t, e.Evaluate(ctx), "rule r1: timeout")
+
+	n.err = nil
+	evaluate(0, time.Minute)
+	assert.Equal(t, []Status{StatusFiring, StatusResolved, StatusFiring, StatusResolved}, n.statuses())
+}
+
+func TestEvaluateLock(t *testing.T) {
+	rules := NewMemoryStore()
+	rules.Create(context.Background(), Rule{ID: "r1", Tenant: "acme", HitID: "1", Kind: KindThreshold, Window: "5m", Threshold: 1})
+
+	retriever := &mock.ViewRetriever{
+		OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+			return []store.ViewCount{{Description: store.RangeDescription(store.FiveMinute), Count: 2}}, nil
+		},
+	}
+
+	lock := filter.NewMemoryMarker()
+	n1, n2 := &notifier{}, &notifier{}
+
+	assert.NoError(t, NewEvaluator(rules, retriever, n1, nil, WithLock(lock)).Evaluate(context.Background()))
+	assert.NoError(t, NewEvaluator(rules, retriever, n2, nil, WithLock(lock)).Evaluate(context.Background()))
+
+	assert.Len(t, n1.events, 1)
+	assert.Empty(t, n2.events)
+}
+
+func TestWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		assert.NoError(t, err)
+		assert.Equal(t, Sign("s3cret", timestamp, body), r.Header.Get(HeaderSignature))
+
+		var event Event
+		assert.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "r1", event.RuleID)
+
+		switch r.URL.Path {
+		case "/flaky":
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	webhook := NewWebhook(WithHTTPClient(srv.Client()), WithRetries(3, time.Millisecond))
+
+	rule := Rule{ID: "r1", Secret: "s3cret", WebhookURL: srv.URL + "/flaky"}
+	event := Event{RuleID: "r1", Status: StatusFiring}
+
+	assert.NoError(t, webhook.Notify(context.Background(), rule, event))
+	assert.Equal(t, 3, attempts)
+
+	// The client errors are not retried.
+	attempts = 0
+	rule.WebhookURL = srv.URL + "/gone"
+
+	assert.EqualError(t, webhook.Notify(context.Background(), rule, event), "webhook: status 410")
+	assert.Equal(t, 1, attempts)
+
+	// The default client refuses the loopback address of the test server, without retrying.
+	attempts = 0
+	rule.WebhookURL = srv.URL + "/flaky"
+
+	err := NewWebhook(WithRetries(3, time.Millisecond)).Notify(context.Background(), rule, event)
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), err)
+	assert.Equal(t, 0, attempts)
+}
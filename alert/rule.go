@@ -0,0 +1,176 @@
+// Package alert evaluates the alert rules of the hit IDs against their counts, and notifies their webhooks.
+package alert
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// Kind is the condition of a rule.
+type Kind string
+
+const (
+	// KindThreshold fires when the count of the window exceeds the threshold.
+	KindThreshold Kind = "threshold"
+	// KindRatio fires when the count of the window exceeds factor times the average count of the window over the baseline,
+	// e.g. the last hour is 3 times the hourly average of the last day.
+	KindRatio Kind = "ratio"
+)
+
+// window is a range of the counts usable by the rules.
+type window struct {
+	rang     store.Range
+	duration time.Duration
+}
+
+// windows are the windows of the rules, by name.
+var windows = map[string]window{
+	"1m":  {store.OneMinute, time.Minute},
+	"5m":  {store.FiveMinute, 5 * time.Minute},
+	"1h":  {store.OneHour, time.Hour},
+	"1d":  {store.OneDay, 24 * time.Hour},
+	"7d":  {store.OneWeek, 7 * 24 * time.Hour},
+	"30d": {store.OneMonth, 30 * 24 * time.Hour},
+}
+
+// Rule notifies the webhook when the counts of the hit ID meet the condition.
+type Rule struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant"`
+	HitID  string `json:"hit_id"`
+	Kind   Kind   `json:"kind"`
+	// Window of the count: 1m, 5m, 1h, 1d, 7d or 30d.
+	Window string `json:"window"`
+	// Threshold is the count to exceed for KindThreshold, and the minimum count to fire for KindRatio.
+	Threshold int64 `json:"threshold"`
+	// Baseline is the window of the average, longer than the window, for KindRatio.
+	Baseline string  `json:"baseline,omitempty"`
+	Factor   float64 `json:"factor,omitempty"`
+	// WebhookURL receives the events, signed with the secret.
+	WebhookURL string `json:"webhook_url"`
+	Secret     string `json:"secret"`
+	// Cooldown is the minimum delay between two firing notifications.
+	Cooldown  time.Duration `json:"cooldown"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Validate returns an error describing the first invalid value.
+func (r *Rule) Validate() error {
+	if r.HitID == "" {
+		return errors.New("hit_id is empty")
+	}
+
+	w, ok := windows[r.Window]
+	if !ok {
+		return errors.New("window must be one of 1m, 5m, 1h, 1d, 7d or 30d")
+	}
+
+	switch r.Kind {
+	case KindThreshold:
+		if r.Threshold <= 0 {
+			return errors.New("threshold must be positive")
+		}
+
+	case KindRatio:
+		baseline, ok := windows[r.Baseline]
+		if !ok || baseline.duration <= w.duration {
+			return errors.New("baseline must be one of 1m, 5m, 1h, 1d, 7d or 30d, and longer than the window")
+		}
+
+		if r.Factor <= 0 {
+			return errors.New("factor must be positive")
+		}
+
+		if r.Threshold < 0 {
+			return errors.New("threshold must not be negative")
+		}
+
+	default:
+		return errors.New("kind must be threshold or ratio")
+	}
+
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http or https URL")
+	}
+
+	if r.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+
+	return nil
+}
+
+// ranges returns the ranges of the counts needed to check the rule.
+func (r *Rule) ranges() []store.Range {
+	ranges := []store.Range{windows[r.Window].rang}
+
+	if r.Kind == KindRatio {
+		ranges = append(ranges, windows[r.Baseline].rang)
+	}
+
+	return ranges
+}
+
+// check returns the count of the window, the limit it must exceed, and if the rule fires.
+func (r *Rule) check(counts []store.ViewCount) (int64, float64, bool, error) {
+	count, err := countOf(counts, r.Window)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	if r.Kind == KindThreshold {
+		return count, float64(r.Threshold), count > r.Threshold, nil
+	}
+
+	baseline, err := countOf(counts, r.Baseline)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	limit := r.Factor * float64(baseline) * float64(windows[r.Window].duration) / float64(windows[r.Baseline].duration)
+
+	return count, limit, float64(count) > limit && count >= r.Threshold, nil
+}
+
+func countOf(counts []store.ViewCount, name string) (int64, error) {
+	desc := store.RangeDescription(windows[name].rang)
+
+	for _, count := range counts {
+		if count.Description == desc {
+			return count.Count, nil
+		}
+	}
+
+	return 0, errors.Errorf("no count of the %s window", name)
+}
+
+// Status is the status of a rule, sent in the events.
+type Status string
+
+const (
+	StatusFiring   Status = "firing"
+	StatusResolved Status = "resolved"
+)
+
+// State is the last notified status of a rule.
+type State struct {
+	Firing       bool      `json:"firing"`
+	LastNotified time.Time `json:"last_notified"`
+}
+
+// Event is the body of the webhook requests.
+type Event struct {
+	RuleID string `json:"rule_id"`
+	HitID  string `json:"hit_id"`
+	Status Status `json:"status"`
+	Window string `json:"window"`
+	Count  int64  `json:"count"`
+	// Limit is the count the window exceeds when firing.
+	Limit     float64   `json:"limit"`
+	Timestamp time.Time `json:"timestamp"`
+}
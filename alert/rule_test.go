@@ -0,0 +1,78 @@
+package alert
+
+import (
+	"testing"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Rule{HitID: "1", Kind: KindThreshold, Window: "5m", Threshold: 100, WebhookURL: "https://example.com/hook"}
+
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name    string
+		modify  func(r *Rule)
+		wantErr string
+	}{
+		{"no hit id", func(r *Rule) { r.HitID = "" }, "hit_id is empty"},
+		{"window", func(r *Rule) { r.Window = "2h" }, "window must be one of 1m, 5m, 1h, 1d, 7d or 30d"},
+		{"kind", func(r *Rule) { r.Kind = "spike" }, "kind must be threshold or ratio"},
+		{"threshold", func(r *Rule) { r.Threshold = 0 }, "threshold must be positive"},
+		{"baseline", func(r *Rule) { r.Kind, r.Baseline, r.Factor = KindRatio, "5m", 3 }, "baseline must be one of 1m, 5m, 1h, 1d, 7d or 30d, and longer than the window"},
+		{"factor", func(r *Rule) { r.Kind, r.Baseline = KindRatio, "1d" }, "factor must be positive"},
+		{"webhook", func(r *Rule) { r.WebhookURL = "example.com/hook" }, "webhook_url must be an absolute http or https URL"},
+		{"cooldown", func(r *Rule) { r.Cooldown = -1 }, "cooldown must not be negative"},
+	}
+
+	for _, tc := range tests {
+		rule := valid
+		tc.modify(&rule)
+
+		assert.EqualError(t, rule.Validate(), tc.wantErr, tc.name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	counts := func(hour, day int64) []store.ViewCount {
+		return []store.ViewCount{
+			{Description: store.RangeDescription(store.OneHour), Count: hour},
+			{Description: store.RangeDescription(store.OneDay), Count: day},
+		}
+	}
+
+	threshold := Rule{Kind: KindThreshold, Window: "1h", Threshold: 100}
+
+	_, _, firing, err := threshold.check(counts(100, 0))
+	assert.NoError(t, err)
+	assert.False(t, firing)
+
+	count, limit, firing, err := threshold.check(counts(101, 0))
+	assert.NoError(t, err)
+	assert.True(t, firing)
+	assert.Equal(t, int64(101), count)
+	assert.Equal(t, float64(100), limit)
+
+	// The last hour is 3 times the hourly average of the last day.
+	ratio := Rule{Kind: KindRatio, Window: "1h", Baseline: "1d", Factor: 3, Threshold: 10}
+
+	_, limit, firing, err = ratio.check(counts(72, 576))
+	assert.NoError(t, err)
+	assert.False(t, firing)
+	assert.Equal(t, float64(72), limit)
+
+	_, _, firing, err = ratio.check(counts(73, 576))
+	assert.NoError(t, err)
+	assert.True(t, firing)
+
+	// Below the minimum count.
+	_, _, firing, err = ratio.check(counts(9, 0))
+	assert.NoError(t, err)
+	assert.False(t, firing)
+
+	_, _, _, err = ratio.check(counts(1, 1)[:1])
+	assert.EqualError(t, err, "no count of the 1d window")
+}
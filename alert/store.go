@@ -0,0 +1,236 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+// ErrNotFound is returned when the rule does not exist, or belongs to another tenant.
+var ErrNotFound = errors.New("alert rule not found")
+
+// Store stores the rules, and their state.
+type Store interface {
+	// Create stores the rule, its ID must be set.
+	Create(ctx context.Context, rule Rule) error
+
+	Get(ctx context.Context, tenant, id string) (Rule, error)
+
+	// List returns the rules of the tenant, or of every tenant if empty, in creation order.
+	List(ctx context.Context, tenant string) ([]Rule, error)
+
+	// Delete deletes the rule and its state.
+	Delete(ctx context.Context, tenant, id string) error
+
+	// State returns the state of the rule, the zero State if it was never notified.
+	State(ctx context.Context, id string) (State, error)
+
+	SetState(ctx context.Context, id string, state State) error
+}
+
+func sortRules(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if !rules[i].CreatedAt.Equal(rules[j].CreatedAt) {
+			return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+		}
+
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore stores the rules in memory, so they are per server replica and lost on restart.
+type MemoryStore struct {
+	mu     sync.Mutex
+	rules  map[string]Rule
+	states map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rules:  make(map[string]Rule),
+		states: make(map[string]State),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[rule.ID] = rule
+
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, tenant, id string) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.rules[id]
+	if !ok || rule.Tenant != tenant {
+		return Rule{}, ErrNotFound
+	}
+
+	return rule, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, tenant string) ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]Rule, 0, len(s.rules))
+
+	for _, rule := range s.rules {
+		if tenant == "" || rule.Tenant == tenant {
+			rules = append(rules, rule)
+		}
+	}
+
+	sortRules(rules)
+
+	return rules, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.rules[id]
+	if !ok || rule.Tenant != tenant {
+		return ErrNotFound
+	}
+
+	delete(s.rules, id)
+	delete(s.states, id)
+
+	return nil
+}
+
+func (s *MemoryStore) State(ctx context.Context, id string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.states[id], nil
+}
+
+func (s *MemoryStore) SetState(ctx context.Context, id string, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[id] = state
+
+	return nil
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// RedisStore stores the rules as JSON in the Redis hash <prefix>rules, and their state in the hash <prefix>states,
+// one field per rule ID, so every server replica shares them.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisStore) Create(ctx context.Context, rule Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.client.HSet(s.prefix+"rules", rule.ID, string(data)).Err(), "redis")
+}
+
+func (s *RedisStore) Get(ctx context.Context, tenant, id string) (Rule, error) {
+	data, err := s.client.HGet(s.prefix+"rules", id).Result()
+	if err == redis.Nil {
+		return Rule{}, ErrNotFound
+	}
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "redis")
+	}
+
+	var rule Rule
+	if err := json.Unmarshal([]byte(data), &rule); err != nil {
+		return Rule{}, errors.Wrapf(err, "rule %s", id)
+	}
+
+	if rule.Tenant != tenant {
+		return Rule{}, ErrNotFound
+	}
+
+	return rule, nil
+}
+
+func (s *RedisStore) List(ctx context.Context, tenant string) ([]Rule, error) {
+	values, err := s.client.HGetAllMap(s.prefix + "rules").Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "redis")
+	}
+
+	rules := make([]Rule, 0, len(values))
+
+	for id, data := range values {
+		var rule Rule
+		if err := json.Unmarshal([]byte(data), &rule); err != nil {
+			return nil, errors.Wrapf(err, "rule %s", id)
+		}
+
+		if tenant == "" || rule.Tenant == tenant {
+			rules = append(rules, rule)
+		}
+	}
+
+	sortRules(rules)
+
+	return rules, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, tenant, id string) error {
+	if _, err := s.Get(ctx, tenant, id); err != nil {
+		return err
+	}
+
+	if err := s.client.HDel(s.prefix+"rules", id).Err(); err != nil {
+		return errors.Wrap(err, "redis")
+	}
+
+	return errors.Wrap(s.client.HDel(s.prefix+"states", id).Err(), "redis")
+}
+
+func (s *RedisStore) State(ctx context.Context, id string) (State, error) {
+	data, err := s.client.HGet(s.prefix+"states", id).Result()
+	if err == redis.Nil {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, errors.Wrap(err, "redis")
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return State{}, errors.Wrapf(err, "state of %s", id)
+	}
+
+	return state, nil
+}
+
+func (s *RedisStore) SetState(ctx context.Context, id string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.client.HSet(s.prefix+"states", id, string(data)).Err(), "redis")
+}
@@ -0,0 +1,81 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+// testStore runs the same scenario on every store.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Round(time.Second)
+
+	rule1 := Rule{ID: "1", Tenant: "acme", HitID: "a", Kind: KindThreshold, Window: "5m", Threshold: 10, CreatedAt: now}
+	rule2 := Rule{ID: "2", Tenant: "acme", HitID: "b", Kind: KindThreshold, Window: "5m", Threshold: 10, CreatedAt: now.Add(-time.Minute)}
+	other := Rule{ID: "3", Tenant: "globex", HitID: "a", Kind: KindThreshold, Window: "5m", Threshold: 10, CreatedAt: now}
+
+	for _, rule := range []Rule{rule1, rule2, other} {
+		assert.NoError(t, s.Create(ctx, rule))
+	}
+
+	rule, err := s.Get(ctx, "acme", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, rule1, rule)
+
+	_, err = s.Get(ctx, "globex", "1")
+	assert.Equal(t, ErrNotFound, err)
+
+	rules, err := s.List(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{rule2, rule1}, rules)
+
+	rules, err = s.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	state, err := s.State(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, State{}, state)
+
+	assert.NoError(t, s.SetState(ctx, "1", State{Firing: true, LastNotified: now}))
+
+	state, err = s.State(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, State{Firing: true, LastNotified: now}, state)
+
+	assert.Equal(t, ErrNotFound, s.Delete(ctx, "globex", "1"))
+	assert.NoError(t, s.Delete(ctx, "acme", "1"))
+	assert.Equal(t, ErrNotFound, s.Delete(ctx, "acme", "1"))
+
+	state, err = s.State(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, State{}, state)
+
+	rules, err = s.List(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{rule2}, rules)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	testStore(t, NewRedisStore(client, "alert:"))
+
+	assert.True(t, s.Exists("alert:rules"))
+}
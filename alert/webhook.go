@@ -0,0 +1,138 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Headers of the webhook requests.
+const (
+	HeaderTimestamp = "X-Alert-Timestamp"
+	HeaderSignature = "X-Alert-Signature"
+)
+
+// Notifier sends the events of the rules.
+type Notifier interface {
+	Notify(ctx context.Context, rule Rule, event Event) error
+}
+
+var _ Notifier = (*Webhook)(nil)
+
+// Webhook posts the events as JSON to the webhook URL of the rules.
+//
+// Each request is signed with the secret of the rule: the X-Alert-Signature header is the hex encoded
+// HMAC-SHA256 of <timestamp>.<body>, where the timestamp is the X-Alert-Timestamp header, in unix seconds.
+// The requests failed with a network error, 5xx or 429 are retried.
+type Webhook struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	now     func() time.Time
+}
+
+type WebhookOption func(*Webhook)
+
+// WithHTTPClient sets the HTTP client. Default is NewHTTPClient with a timeout of 10 seconds,
+// that refuses the addresses that are not public.
+func WithHTTPClient(client *http.Client) func(*Webhook) {
+	return func(w *Webhook) {
+		w.client = client
+	}
+}
+
+// WithRetries sets the number of retries, and the delay before the first retry, doubled for each retry.
+// Default is 3 retries, after 1 second.
+func WithRetries(retries int, backoff time.Duration) func(*Webhook) {
+	return func(w *Webhook) {
+		w.retries = retries
+		w.backoff = backoff
+	}
+}
+
+func NewWebhook(opts ...WebhookOption) *Webhook {
+	w := &Webhook{
+		client:  NewHTTPClient(10 * time.Second),
+		retries: 3,
+		backoff: time.Second,
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Sign returns the signature of the body, sent at the timestamp in unix seconds, using the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Notify(ctx context.Context, rule Rule, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+
+	for retry := 0; ; retry++ {
+		retryable, err := w.post(ctx, rule, body)
+		if err == nil || !retryable || retry == w.retries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+	}
+}
+
+// post sends the request, and returns if it can be retried when it failed.
+func (w *Webhook) post(ctx context.Context, rule Rule, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := w.now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(rule.Secret, timestamp, body))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, ErrForbiddenAddress), errors.Wrap(err, "webhook")
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, errors.Errorf("webhook: status %d", res.StatusCode)
+}
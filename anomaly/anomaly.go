@@ -0,0 +1,219 @@
+// Package anomaly scores how abnormal the recent views of an ID are, compared to its history.
+package anomaly
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// Granularity is the interval of the scored count.
+type Granularity string
+
+const (
+	// Hourly scores the last complete hour, against the same hour of the previous weeks.
+	Hourly Granularity = "hour"
+	// Daily scores the last complete day, against the same weekday of the previous weeks.
+	Daily Granularity = "day"
+)
+
+func (g Granularity) interval() time.Duration {
+	if g == Daily {
+		return 24 * time.Hour
+	}
+
+	return time.Hour
+}
+
+// period is the number of intervals in a week, the season of the traffic.
+func (g Granularity) period() int {
+	if g == Daily {
+		return 7
+	}
+
+	return 7 * 24
+}
+
+// Stats is the expected count, and the z-score of the actual count.
+type Stats struct {
+	Mean float64 `json:"mean"`
+	// Stddev is at least the square root of the mean, the noise of a count, so a flat history does not score every change as abnormal.
+	Stddev float64 `json:"stddev"`
+	Score  float64 `json:"score"`
+}
+
+// Result is the score of the last complete interval.
+type Result struct {
+	Granularity Granularity `json:"granularity"`
+	// Timestamp is the start of the scored interval.
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+	// Seasonal compares the count to the same interval of the previous weeks.
+	Seasonal Stats `json:"seasonal"`
+	// EWMA compares the count to the exponentially weighted moving average of the previous intervals.
+	EWMA Stats `json:"ewma"`
+	// Score is the seasonal or the EWMA score closer to 0, so the count must be abnormal compared to both.
+	// It is positive for a spike, and negative for a drop.
+	Score     float64 `json:"score"`
+	Anomalous bool    `json:"anomalous"`
+}
+
+type Detector struct {
+	retriever store.ViewRetriever
+
+	seasons   int
+	alpha     float64
+	threshold float64
+
+	now func() time.Time
+}
+
+type Option func(*Detector)
+
+// WithSeasons sets the number of previous weeks compared. Default is 4.
+func WithSeasons(seasons int) func(*Detector) {
+	return func(d *Detector) {
+		d.seasons = seasons
+	}
+}
+
+// WithAlpha sets the weight of the latest count in the EWMA, between 0 and 1. Default is 0.3.
+func WithAlpha(alpha float64) func(*Detector) {
+	return func(d *Detector) {
+		d.alpha = alpha
+	}
+}
+
+// WithThreshold sets the absolute score from which the count is anomalous. Default is 3.
+func WithThreshold(threshold float64) func(*Detector) {
+	return func(d *Detector) {
+		d.threshold = threshold
+	}
+}
+
+func NewDetector(retriever store.ViewRetriever, opts ...Option) *Detector {
+	d := &Detector{
+		retriever: retriever,
+		seasons:   4,
+		alpha:     0.3,
+		threshold: 3,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Detect scores the last complete interval of the ID.
+func (d *Detector) Detect(ctx context.Context, tenant, id string, g Granularity) (Result, error) {
+	if g != Hourly && g != Daily {
+		return Result{}, errors.Errorf("granularity must be %s or %s", Hourly, Daily)
+	}
+
+	interval := g.interval()
+	to := d.now().UTC().Truncate(interval)
+	n := d.seasons*g.period() + 1
+
+	buckets, err := d.retriever.Histogram(ctx, store.HistogramQuery{
+		Tenant:   tenant,
+		ID:       id,
+		Interval: interval,
+		From:     to.Add(-time.Duration(n) * interval),
+		To:       to,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if len(buckets) != n {
+		return Result{}, errors.Errorf("histogram has %d buckets, expected %d", len(buckets), n)
+	}
+
+	counts := make([]int64, n)
+	for i, bucket := range buckets {
+		counts[i] = bucket.Count
+	}
+
+	r := Result{
+		Granularity: g,
+		Timestamp:   buckets[n-1].Timestamp,
+		Count:       counts[n-1],
+		Seasonal:    seasonal(counts, g.period(), d.seasons),
+		EWMA:        ewma(counts, d.alpha),
+	}
+
+	r.Score = r.Seasonal.Score
+	if math.Abs(r.EWMA.Score) < math.Abs(r.Score) {
+		r.Score = r.EWMA.Score
+	}
+
+	r.Anomalous = math.Abs(r.Score) >= d.threshold
+
+	return r, nil
+}
+
+// seasonal scores the last count against the counts one period apart before it.
+func seasonal(counts []int64, period, seasons int) Stats {
+	last := len(counts) - 1
+
+	var samples []float64
+	for k := 1; k <= seasons && last-k*period >= 0; k++ {
+		samples = append(samples, float64(counts[last-k*period]))
+	}
+
+	var mean, variance float64
+
+	for _, x := range samples {
+		mean += x
+	}
+	if len(samples) > 0 {
+		mean /= float64(len(samples))
+	}
+
+	for _, x := range samples {
+		variance += (x - mean) * (x - mean)
+	}
+	if len(samples) > 0 {
+		variance /= float64(len(samples))
+	}
+
+	return stats(counts[last], mean, math.Sqrt(variance))
+}
+
+// ewma scores the last count against the exponentially weighted moving average and variance of the counts before it.
+func ewma(counts []int64, alpha float64) Stats {
+	last := len(counts) - 1
+
+	var mean, variance float64
+
+	for i, c := range counts[:last] {
+		x := float64(c)
+
+		if i == 0 {
+			mean = x
+			continue
+		}
+
+		diff := x - mean
+		mean += alpha * diff
+		variance = (1 - alpha) * (variance + alpha*diff*diff)
+	}
+
+	return stats(counts[last], mean, math.Sqrt(variance))
+}
+
+func stats(count int64, mean, stddev float64) Stats {
+	stddev = math.Max(stddev, math.Sqrt(math.Max(mean, 1)))
+
+	return Stats{
+		Mean:   mean,
+		Stddev: stddev,
+		Score:  (float64(count) - mean) / stddev,
+	}
+}
@@ -0,0 +1,128 @@
+package anomaly
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeasonal(t *testing.T) {
+	// The last count against the counts 2 and 4 intervals before.
+	s := seasonal([]int64{100, 0, 140, 0, 180}, 2, 2)
+	assert.Equal(t, Stats{Mean: 120, Stddev: 20, Score: 3}, s)
+
+	// Not enough history, only the previous season is compared.
+	s = seasonal([]int64{0, 140, 0, 180}, 2, 4)
+	assert.Equal(t, float64(140), s.Mean)
+
+	// The stddev of a flat history is the noise of the count.
+	s = seasonal([]int64{9, 9, 12}, 1, 2)
+	assert.Equal(t, Stats{Mean: 9, Stddev: 3, Score: 1}, s)
+
+	// No history.
+	s = seasonal([]int64{5}, 1, 2)
+	assert.Equal(t, Stats{Mean: 0, Stddev: 1, Score: 5}, s)
+}
+
+func TestEWMA(t *testing.T) {
+	s := ewma([]int64{0, 10, 15}, 0.5)
+	assert.Equal(t, Stats{Mean: 5, Stddev: 5, Score: 2}, s)
+
+	s = ewma([]int64{4, 4, 4, 4, 2}, 0.3)
+	assert.Equal(t, Stats{Mean: 4, Stddev: 2, Score: -1}, s)
+}
+
+func TestDetect(t *testing.T) {
+	now := time.Date(2020, 9, 14, 12, 30, 0, 0, time.UTC)
+
+	var counts []int64
+
+	retriever := &mock.ViewRetriever{
+		OnHistogram: func(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+			assert.Equal(t, "acme", q.Tenant)
+			assert.Equal(t, "1", q.ID)
+
+			var buckets []store.Bucket
+			for i, c := range counts {
+				buckets = append(buckets, store.Bucket{Timestamp: q.From.Add(time.Duration(i) * q.Interval), Count: c})
+			}
+
+			assert.Equal(t, q.To, q.From.Add(time.Duration(len(counts))*q.Interval))
+
+			return buckets, nil
+		},
+	}
+
+	d := NewDetector(retriever, WithSeasons(1))
+	d.now = func() time.Time { return now }
+
+	flat := func(n int, count, last int64) {
+		counts = make([]int64, n)
+		for i := range counts {
+			counts[i] = count
+		}
+
+		counts[n-1] = last
+	}
+
+	// A spike of the last hour.
+	flat(7*24+1, 16, 36)
+
+	r, err := d.Detect(context.Background(), "acme", "1", Hourly)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 9, 14, 11, 0, 0, 0, time.UTC), r.Timestamp)
+	assert.Equal(t, int64(36), r.Count)
+	assert.Equal(t, Stats{Mean: 16, Stddev: 4, Score: 5}, r.Seasonal)
+	assert.Equal(t, float64(5), r.Score)
+	assert.True(t, r.Anomalous)
+
+	// The last day is as usual.
+	flat(7+1, 16, 20)
+
+	r, err = d.Detect(context.Background(), "acme", "1", Daily)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 9, 13, 0, 0, 0, 0, time.UTC), r.Timestamp)
+	assert.Equal(t, float64(1), r.Score)
+	assert.False(t, r.Anomalous)
+
+	// The score closer to 0 is kept: the count is usual for this hour of the week, but not compared to the previous hours.
+	flat(7*24+1, 0, 50)
+	counts[0] = 50
+
+	r, err = d.Detect(context.Background(), "acme", "1", Hourly)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), r.Score)
+	assert.True(t, r.EWMA.Score > 3)
+	assert.False(t, r.Anomalous)
+
+	_, err = d.Detect(context.Background(), "acme", "1", "week")
+	assert.EqualError(t, err, "granularity must be hour or day")
+}
+
+func TestDetectDrop(t *testing.T) {
+	retriever := &mock.ViewRetriever{
+		OnHistogram: func(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+			buckets := make([]store.Bucket, 7*24*4+1)
+			for i := range buckets {
+				buckets[i].Count = 100
+			}
+
+			// No view in the last hour.
+			buckets[len(buckets)-1].Count = 0
+
+			return buckets, nil
+		},
+	}
+
+	r, err := NewDetector(retriever).Detect(context.Background(), "acme", "1", Hourly)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(-10), r.Score)
+	assert.False(t, math.IsNaN(r.EWMA.Score))
+	assert.True(t, r.Anomalous)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/alert"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+
+	"github.com/go-chi/chi"
+)
+
+// WithAlerts serves the alert rules of the tenant at /alerts. Listing the rules requires the read scope,
+// creating and deleting them the write scope.
+func WithAlerts(rules alert.Store) func(*Handler) {
+	return func(h *Handler) {
+		h.alerts = rules
+	}
+}
+
+type alertRequest struct {
+	HitID      string     `json:"hit_id"`
+	Kind       alert.Kind `json:"kind"`
+	Window     string     `json:"window"`
+	Threshold  int64      `json:"threshold"`
+	Baseline   string     `json:"baseline"`
+	Factor     float64    `json:"factor"`
+	WebhookURL string     `json:"webhook_url"`
+	// Optional, generated if empty.
+	Secret string `json:"secret"`
+	// Optional, e.g. 30m.
+	Cooldown string `json:"cooldown"`
+}
+
+// alertResponse is a rule. The secret is only returned when the rule is created.
+type alertResponse struct {
+	ID         string     `json:"id"`
+	HitID      string     `json:"hit_id"`
+	Kind       alert.Kind `json:"kind"`
+	Window     string     `json:"window"`
+	Threshold  int64      `json:"threshold"`
+	Baseline   string     `json:"baseline,omitempty"`
+	Factor     float64    `json:"factor,omitempty"`
+	WebhookURL string     `json:"webhook_url"`
+	Secret     string     `json:"secret,omitempty"`
+	Cooldown   string     `json:"cooldown"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAlertResponse(rule alert.Rule) alertResponse {
+	return alertResponse{
+		ID:         rule.ID,
+		HitID:      rule.HitID,
+		Kind:       rule.Kind,
+		Window:     rule.Window,
+		Threshold:  rule.Threshold,
+		Baseline:   rule.Baseline,
+		Factor:     rule.Factor,
+		WebhookURL: rule.WebhookURL,
+		Cooldown:   rule.Cooldown.String(),
+		CreatedAt:  rule.CreatedAt,
+	}
+}
+
+func (h *Handler) handleCreateAlert() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req alertRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		rule := alert.Rule{
+			ID:         randomHex(8),
+			Tenant:     auth.TenantFromContext(ctx),
+			HitID:      req.HitID,
+			Kind:       req.Kind,
+			Window:     req.Window,
+			Threshold:  req.Threshold,
+			Baseline:   req.Baseline,
+			Factor:     req.Factor,
+			WebhookURL: req.WebhookURL,
+			Secret:     req.Secret,
+			CreatedAt:  time.Now().UTC(),
+		}
+
+		if rule.Secret == "" {
+			rule.Secret = randomHex(16)
+		}
+
+		if req.Cooldown != "" {
+			cooldown, err := time.ParseDuration(req.Cooldown)
+			if err != nil {
+				renderError(w, http.StatusBadRequest, "cooldown is invalid: "+err.Error())
+				return
+			}
+
+			rule.Cooldown = cooldown
+		}
+
+		if err := rule.Validate(); err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := h.alerts.Create(ctx, rule); err != nil {
+			logging.FromContext(ctx, h.logger).Error("create alert rule", logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		res := newAlertResponse(rule)
+		res.Secret = rule.Secret
+
+		render(w, http.StatusCreated, res)
+	}
+}
+
+func (h *Handler) handleListAlerts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		rules, err := h.alerts.List(ctx, auth.TenantFromContext(ctx))
+		if err != nil {
+			logging.FromContext(ctx, h.logger).Error("list alert rules", logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		res := make([]alertResponse, 0, len(rules))
+		for _, rule := range rules {
+			res = append(res, newAlertResponse(rule))
+		}
+
+		render(w, http.StatusOK, res)
+	}
+}
+
+func (h *Handler) handleGetAlert() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := chi.URLParam(r, "id")
+
+		rule, err := h.alerts.Get(ctx, auth.TenantFromContext(ctx), id)
+		if err == alert.ErrNotFound {
+			renderError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx, h.logger).Error("get alert rule", slog.String("rule_id", id), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		render(w, http.StatusOK, newAlertResponse(rule))
+	}
+}
+
+func (h *Handler) handleDeleteAlert() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := chi.URLParam(r, "id")
+
+		err := h.alerts.Delete(ctx, auth.TenantFromContext(ctx), id)
+		if err == alert.ErrNotFound {
+			renderError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx, h.logger).Error("delete alert rule", slog.String("rule_id", id), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
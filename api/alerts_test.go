@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/alert"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlerts(t *testing.T) {
+	rules := alert.NewMemoryStore()
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, nil, nil, WithAlerts(rules)))
+	other := auth.Anonymous("globex")(NewHandler(nil, nil, nil, WithAlerts(rules)))
+
+	do := func(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		return rr
+	}
+
+	rr := do(handler, "POST", "/alerts", `{"hit_id":"1","kind":"threshold","window":"5m","threshold":100,"webhook_url":"https://example.com/hook","cooldown":"30m"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var created alertResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEmpty(t, created.ID)
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, "30m0s", created.Cooldown)
+
+	rule, err := rules.Get(context.Background(), "acme", created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Secret, rule.Secret)
+
+	// The secret is not returned after the creation.
+	rr = do(handler, "GET", "/alerts/"+created.ID, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), created.Secret)
+
+	rr = do(handler, "GET", "/alerts", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var list []alertResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+
+	created.Secret = ""
+	assert.Equal(t, []alertResponse{created}, list)
+
+	// The rules of another tenant are not visible.
+	assert.Equal(t, "[]\n", do(other, "GET", "/alerts", "").Body.String())
+	assert.Equal(t, http.StatusNotFound, do(other, "GET", "/alerts/"+created.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(other, "DELETE", "/alerts/"+created.ID, "").Code)
+
+	rr = do(handler, "POST", "/alerts", `{"hit_id":"1","kind":"threshold","window":"2h","threshold":100,"webhook_url":"https://example.com/hook"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "window must be one of")
+
+	rr = do(handler, "POST", "/alerts", `{"hit_id":"1","kind":"threshold","window":"5m","threshold":100,"webhook_url":"https://example.com/hook","cooldown":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	assert.Equal(t, http.StatusNoContent, do(handler, "DELETE", "/alerts/"+created.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(handler, "GET", "/alerts/"+created.ID, "").Code)
+}
+
+func TestAlertsScopes(t *testing.T) {
+	rules := alert.NewMemoryStore()
+
+	keys := auth.NewAuthenticator(auth.NewMemoryKeyStore([]auth.Key{
+		{ID: "dashboard", Secret: "s3cret", Tenant: "acme", Scopes: []auth.Scope{auth.ScopeRead}},
+	}))
+	handler := keys.Middleware(NewHandler(nil, nil, nil, WithAlerts(rules)))
+
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(auth.HeaderAPIKey, "dashboard.s3cret")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	// The read scope lists the rules, but doesn't change them.
+	assert.Equal(t, http.StatusOK, do("GET", "/alerts", ""))
+	assert.Equal(t, http.StatusForbidden, do("POST", "/alerts", `{"hit_id":"1","kind":"threshold","window":"5m","threshold":100,"webhook_url":"https://example.com/hook"}`))
+	assert.Equal(t, http.StatusForbidden, do("DELETE", "/alerts/1", ""))
+}
+
+func TestAlertsDisabled(t *testing.T) {
+	handler := auth.Anonymous("acme")(NewHandler(nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/alerts", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/anomaly"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+
+	"github.com/go-chi/chi"
+)
+
+// WithAnomaly serves the anomaly score of an ID at GET /analytics/{id}/anomaly.
+func WithAnomaly(detector *anomaly.Detector) func(*Handler) {
+	return func(h *Handler) {
+		h.detector = detector
+	}
+}
+
+type anomalyResponse struct {
+	ID string `json:"id"`
+	anomaly.Result
+}
+
+func (h *Handler) handleAnomaly() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		ctx, span := tracer.Start(r.Context(), "api.Anomaly")
+		defer span.End()
+
+		span.SetAttributes(tracing.IDAttribute(id))
+
+		granularity := anomaly.Granularity(r.URL.Query().Get("granularity"))
+		if granularity == "" {
+			granularity = anomaly.Hourly
+		}
+
+		if granularity != anomaly.Hourly && granularity != anomaly.Daily {
+			renderError(w, http.StatusBadRequest, "granularity must be hour or day")
+			return
+		}
+
+		result, err := h.detector.Detect(ctx, auth.TenantFromContext(ctx), id, granularity)
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logging.FromContext(ctx, h.logger).Error("detect anomaly", slog.String("id", id), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		render(w, http.StatusOK, anomalyResponse{ID: id, Result: result})
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/anomaly"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomaly(t *testing.T) {
+	retriever := &mock.ViewRetriever{
+		OnHistogram: func(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+			assert.Equal(t, "acme", q.Tenant)
+			assert.Equal(t, "1", q.ID)
+			assert.Equal(t, 24*time.Hour, q.Interval)
+
+			buckets := make([]store.Bucket, 7+1)
+			for i := range buckets {
+				buckets[i] = store.Bucket{Timestamp: q.From.Add(time.Duration(i) * q.Interval), Count: 100}
+			}
+
+			buckets[7].Count = 200
+
+			return buckets, nil
+		},
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, retriever, nil, WithAnomaly(anomaly.NewDetector(retriever, anomaly.WithSeasons(1)))))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/anomaly?granularity=day", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var res anomalyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "1", res.ID)
+	assert.Equal(t, anomaly.Daily, res.Granularity)
+	assert.Equal(t, int64(200), res.Count)
+	assert.Equal(t, float64(10), res.Score)
+	assert.True(t, res.Anomalous)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/anomaly?granularity=week", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestAnomalyDisabled(t *testing.T) {
+	handler := auth.Anonymous("acme")(NewHandler(nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/anomaly", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -2,39 +2,142 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/alert"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/anomaly"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/export"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/skew"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/api")
+
 type Handler struct {
-	logger        *log.Logger
+	logger        *slog.Logger
 	router        chi.Router
 	viewTracker   store.ViewTracker
 	viewRetriever store.ViewRetriever
+
+	trackMiddlewares []func(http.Handler) http.Handler
+	filters          *filter.Chain
+	window           *skew.Window
+
+	hub             *live.Hub
+	streamInterval  time.Duration
+	streamHeartbeat time.Duration
+
+	alerts alert.Store
+
+	detector *anomaly.Detector
+
+	exporter *export.Exporter
+
+	purger              store.ViewPurger
+	taskOwners          retention.TaskOwners
+	erased              func(ctx context.Context, tenant, id string)
+	erasurePollInterval time.Duration
+}
+
+type Option func(*Handler)
+
+// WithTrackMiddleware adds middlewares to the Track and Bulk Track routes, run after the scope is checked, e.g. the rate limiting.
+func WithTrackMiddleware(middlewares ...func(http.Handler) http.Handler) func(*Handler) {
+	return func(h *Handler) {
+		h.trackMiddlewares = append(h.trackMiddlewares, middlewares...)
+	}
 }
 
-func NewHandler(viewTracker store.ViewTracker, viewRetriever store.ViewRetriever, logger *log.Logger) *Handler {
+// WithFilters discards the hits filtered by the chain, e.g. the bots and the duplicates, before they are tracked.
+// The discarded hits still get 204 No Content, and their counts are served at GET /analytics/_discarded.
+func WithFilters(chain *filter.Chain) func(*Handler) {
+	return func(h *Handler) {
+		h.filters = chain
+	}
+}
+
+// WithTimestampWindow validates the timestamps sent by the clients. Default is to accept every timestamp.
+func WithTimestampWindow(window *skew.Window) func(*Handler) {
+	return func(h *Handler) {
+		h.window = window
+	}
+}
+
+// NewHandler creates the API handler. The logger is used when the request has no logger from logging.Middleware,
+// and it can be nil.
+//
+// The requests must be authenticated before reaching the handler, using auth.Authenticator or auth.Anonymous.
+// Tracking requires the write scope, retrieving requires the read scope, and erasing requires the delete scope.
+// The views are tracked and retrieved for the tenant of the key.
+func NewHandler(viewTracker store.ViewTracker, viewRetriever store.ViewRetriever, logger *slog.Logger, opts ...Option) *Handler {
 	h := &Handler{
 		viewTracker:   viewTracker,
 		viewRetriever: viewRetriever,
-		logger:        logger,
+		logger:        logging.OrDiscard(logger),
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
 
 	r := chi.NewRouter()
 
 	r.Route("/analytics", func(r chi.Router) {
-		r.Post("/", h.handleTrackView())
+		r.With(auth.Require(auth.ScopeWrite)).With(h.trackMiddlewares...).Post("/", h.handleTrackView())
+
+		r.With(auth.Require(auth.ScopeWrite)).With(h.trackMiddlewares...).Post("/_bulk", h.handleBulkTrackView())
+
+		r.With(auth.Require(auth.ScopeRead)).Get("/{id}", h.handleRetrieveView())
+
+		r.With(auth.Require(auth.ScopeRead)).Get("/{id}/hits", h.handleHits())
 
-		r.Get("/{id}", h.handleRetrieveView())
+		if h.hub != nil {
+			r.With(auth.Require(auth.ScopeRead)).Get("/{id}/stream", h.handleStreamView())
+		}
+
+		if h.detector != nil {
+			r.With(auth.Require(auth.ScopeRead)).Get("/{id}/anomaly", h.handleAnomaly())
+		}
+
+		if h.exporter != nil {
+			r.With(auth.Require(auth.ScopeRead)).Get("/{id}/export", h.handleExport())
+		}
+
+		if h.filters != nil {
+			r.With(auth.Require(auth.ScopeRead)).Get("/_discarded", h.handleDiscarded())
+		}
+
+		if h.purger != nil {
+			r.With(auth.Require(auth.ScopeDelete)).Delete("/{id}", h.handleErase())
+
+			r.With(auth.Require(auth.ScopeDelete)).Get("/_tasks/{task}", h.handleTaskStatus())
+		}
 	})
 
+	if h.alerts != nil {
+		r.Route("/alerts", func(r chi.Router) {
+			r.With(auth.Require(auth.ScopeWrite)).Post("/", h.handleCreateAlert())
+			r.With(auth.Require(auth.ScopeRead)).Get("/", h.handleListAlerts())
+			r.With(auth.Require(auth.ScopeRead)).Get("/{id}", h.handleGetAlert())
+			r.With(auth.Require(auth.ScopeWrite)).Delete("/{id}", h.handleDeleteAlert())
+		})
+	}
+
 	h.router = r
 
 	return h
@@ -43,9 +146,14 @@ func NewHandler(viewTracker store.ViewTracker, viewRetriever store.ViewRetriever
 func (h *Handler) handleTrackView() http.HandlerFunc {
 	type request struct {
 		ID string `json:"id"`
+		// Optional, default is the time of the request.
+		Timestamp *time.Time `json:"timestamp"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "api.TrackView")
+		defer span.End()
+
 		var req request
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -63,10 +171,41 @@ func (h *Handler) handleTrackView() http.HandlerFunc {
 			return
 		}
 
-		if err := h.viewTracker.Track(r.Context(), store.ViewTrack{
+		span.SetAttributes(tracing.IDAttribute(req.ID))
+
+		timestamp, late, err := h.timestamp(req.Timestamp, time.Now())
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		view := store.ViewTrack{
+			Tenant:    auth.TenantFromContext(ctx),
 			ID:        req.ID,
-			Timestamp: time.Now(),
-		}); err != nil {
+			Timestamp: timestamp,
+			Late:      late,
+		}
+
+		hit := filter.NewHit(r, view)
+		hit.Timestamped = req.Timestamp != nil
+
+		if h.filters != nil && !h.filters.Keep(ctx, hit) {
+			span.SetAttributes(attribute.Bool("hit.discarded", true))
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := h.viewTracker.Track(ctx, view); err != nil {
+			tracing.RecordError(span, err)
+
+			// The client retries the failed hit, it is not a duplicate.
+			if h.filters != nil {
+				h.filters.Forget(ctx, hit)
+			}
+
+			logging.FromContext(ctx, h.logger).Error("track view", slog.String("id", req.ID), logging.Error(err))
+
 			renderError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -75,23 +214,46 @@ func (h *Handler) handleTrackView() http.HandlerFunc {
 	}
 }
 
-func (h *Handler) handleRetrieveView() http.HandlerFunc {
-	type response struct {
-		ID     string            `json:"id"`
-		Counts []store.ViewCount `json:"counts"`
+// timestamp returns the timestamp of a hit, and if it is late. The hits without timestamp get the server time.
+func (h *Handler) timestamp(timestamp *time.Time, now time.Time) (time.Time, bool, error) {
+	if timestamp == nil {
+		return now, false, nil
 	}
 
+	return h.window.Check(*timestamp)
+}
+
+type retrieveResponse struct {
+	ID     string            `json:"id"`
+	Counts []store.ViewCount `json:"counts"`
+}
+
+func (h *Handler) handleRetrieveView() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 
-		counts, err := h.viewRetriever.Retrieve(r.Context(), id,
-			store.FiveMinute, store.OneHour, store.OneDay, store.OneWeek, store.OneMonth)
+		ctx, span := tracer.Start(r.Context(), "api.RetrieveView")
+		defer span.End()
+
+		span.SetAttributes(tracing.IDAttribute(id))
+
+		q, err := viewQuery(r, auth.TenantFromContext(ctx), id)
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		counts, err := h.viewRetriever.Retrieve(ctx, q)
 		if err != nil {
+			tracing.RecordError(span, err)
+
+			logging.FromContext(ctx, h.logger).Error("retrieve view", slog.String("id", id), logging.Error(err))
+
 			renderError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		var res response
+		var res retrieveResponse
 		res.ID = id
 		res.Counts = counts
 
@@ -99,6 +261,32 @@ func (h *Handler) handleRetrieveView() http.HandlerFunc {
 	}
 }
 
+func (h *Handler) handleDiscarded() http.HandlerFunc {
+	type response struct {
+		Total     int64                   `json:"total"`
+		Discarded map[filter.Reason]int64 `json:"discarded"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		counts, err := h.filters.Discarded(ctx, auth.TenantFromContext(ctx))
+		if err != nil {
+			logging.FromContext(ctx, h.logger).Error("discarded hits", logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		res := response{Discarded: counts}
+		for _, count := range counts {
+			res.Total += count
+		}
+
+		render(w, http.StatusOK, res)
+	}
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
 }
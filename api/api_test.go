@@ -9,28 +9,34 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/skew"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestTrack(t *testing.T) {
 	expectedID := "1"
-	var lastID string
+	var lastID, lastTenant string
 
 	mockStore := &mock.Store{
 		ViewTrackerStore: &mock.ViewTracker{
 			OnTrack: func(ctx context.Context, v store.ViewTrack) error {
 				lastID = v.ID
+				lastTenant = v.Tenant
 
 				return nil
 			},
 		},
 	}
 
-	handler := NewHandler(mockStore.ViewTracker(), nil, nil)
+	handler := auth.Anonymous(store.DefaultTenant)(NewHandler(mockStore.ViewTracker(), nil, nil))
 
 	type request struct {
 		ID string `json:"id"`
@@ -64,7 +70,7 @@ func TestTrack(t *testing.T) {
 		},
 		{
 			name:     "success",
-			wantCode: http.StatusOK,
+			wantCode: http.StatusNoContent,
 			body: func() []byte {
 				req := request{}
 				req.ID = expectedID
@@ -95,11 +101,12 @@ func TestTrack(t *testing.T) {
 
 			assert.Equal(t, tc.wantCode, w.Code, "status code")
 
-			// If success, we expect response equal to request.
-			if w.Code == 200 {
-				assert.NoError(t, compareJSON(body, response))
+			// If success, we expect an empty response, and the ID to be tracked.
+			if w.Code == http.StatusNoContent {
+				assert.Empty(t, response)
 
 				assert.Equal(t, expectedID, lastID)
+				assert.Equal(t, store.DefaultTenant, lastTenant)
 			}
 		})
 	}
@@ -108,8 +115,12 @@ func TestTrack(t *testing.T) {
 func TestRetrieve(t *testing.T) {
 	mockStore := &mock.Store{
 		ViewRetrieverStore: &mock.ViewRetriever{
-			OnRetrieve: func(ctx context.Context, id string, ranges ...store.Range) (counts []store.ViewCount, err error) {
-				if id == "1" {
+			OnRetrieve: func(ctx context.Context, q store.ViewQuery) (counts []store.ViewCount, err error) {
+				if q.Tenant != store.DefaultTenant {
+					return nil, fmt.Errorf("unexpected tenant %s", q.Tenant)
+				}
+
+				if q.ID == "1" {
 					return []store.ViewCount{
 						{
 							Description: "1 minute ago",
@@ -117,7 +128,7 @@ func TestRetrieve(t *testing.T) {
 						},
 					}, nil
 				}
-				if id == "2" {
+				if q.ID == "2" {
 					return []store.ViewCount{
 						{
 							Description: "1 minute ago",
@@ -135,7 +146,7 @@ func TestRetrieve(t *testing.T) {
 		Counts []store.ViewCount `json:"counts"`
 	}
 
-	handler := NewHandler(nil, mockStore.ViewRetriever(), nil)
+	handler := auth.Anonymous(store.DefaultTenant)(NewHandler(nil, mockStore.ViewRetriever(), nil))
 
 	tests := []struct {
 		name     string
@@ -211,6 +222,231 @@ func TestRetrieve(t *testing.T) {
 	}
 }
 
+func TestAuth(t *testing.T) {
+	tracked := map[string]int{}
+
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+				tracked[v.Tenant]++
+				return nil
+			},
+		},
+		ViewRetrieverStore: &mock.ViewRetriever{
+			OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+				return []store.ViewCount{{Description: q.Tenant, Count: int64(tracked[q.Tenant])}}, nil
+			},
+		},
+	}
+
+	keys := auth.NewMemoryKeyStore([]auth.Key{
+		{ID: "acme-sdk", Secret: "s1", Tenant: "acme", Scopes: []auth.Scope{auth.ScopeWrite}},
+		{ID: "acme-dashboard", Secret: "s2", Tenant: "acme", Scopes: []auth.Scope{auth.ScopeRead}},
+		{ID: "globex", Secret: "s3", Tenant: "globex", Scopes: []auth.Scope{auth.ScopeWrite, auth.ScopeRead}},
+	})
+
+	handler := auth.NewAuthenticator(keys).Middleware(NewHandler(mockStore.ViewTracker(), mockStore.ViewRetriever(), nil))
+
+	tests := []struct {
+		name     string
+		method   string
+		apiKey   string
+		wantCode int
+	}{
+		{name: "track without key", method: "POST", wantCode: http.StatusUnauthorized},
+		{name: "track wrong secret", method: "POST", apiKey: "acme-sdk.s2", wantCode: http.StatusUnauthorized},
+		{name: "track with read key", method: "POST", apiKey: "acme-dashboard.s2", wantCode: http.StatusForbidden},
+		{name: "track with write key", method: "POST", apiKey: "acme-sdk.s1", wantCode: http.StatusNoContent},
+		{name: "retrieve with write key", method: "GET", apiKey: "acme-sdk.s1", wantCode: http.StatusForbidden},
+		{name: "retrieve with read key", method: "GET", apiKey: "acme-dashboard.s2", wantCode: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var request *http.Request
+			if tc.method == "POST" {
+				request = httptest.NewRequest("POST", "/analytics", bytes.NewReader([]byte(`{"id":"1"}`)))
+			} else {
+				request = httptest.NewRequest("GET", "/analytics/1", nil)
+			}
+
+			if tc.apiKey != "" {
+				request.Header.Set(auth.HeaderAPIKey, tc.apiKey)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, request)
+
+			assert.Equal(t, tc.wantCode, w.Code, "status code")
+		})
+	}
+
+	// Only the acme tenant tracked a view, globex can't see it.
+	request := httptest.NewRequest("GET", "/analytics/1", nil)
+	request.Header.Set(auth.HeaderAPIKey, "globex.s3")
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, compareJSON([]byte(`{"id":"1","counts":[{"reference":"globex","count":0}]}`), w.Body.Bytes()))
+	assert.Equal(t, 1, tracked["acme"])
+}
+
+func TestTrackMiddleware(t *testing.T) {
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+				return nil
+			},
+		},
+		ViewRetrieverStore: &mock.ViewRetriever{
+			OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+				return []store.ViewCount{}, nil
+			},
+		},
+	}
+
+	reject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+	}
+
+	handler := auth.Anonymous(store.DefaultTenant)(NewHandler(mockStore.ViewTracker(), mockStore.ViewRetriever(), nil, WithTrackMiddleware(reject)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics", bytes.NewReader([]byte(`{"id":"1"}`))))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Only the Track route has the middlewares.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/analytics/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestFilters(t *testing.T) {
+	var tracked int
+	var failed bool
+
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+				if failed {
+					return errors.New("elastic is down")
+				}
+
+				tracked++
+				return nil
+			},
+		},
+	}
+
+	chain := filter.NewChain(filter.NewMemoryCounter(), nil,
+		filter.Bot(filter.DefaultBotUserAgents),
+		filter.Dedup(filter.NewMemoryMarker(), time.Minute))
+
+	handler := auth.Anonymous(store.DefaultTenant)(NewHandler(mockStore.ViewTracker(), nil, nil, WithFilters(chain)))
+
+	track := func(userAgent string) int {
+		request := httptest.NewRequest("POST", "/analytics", bytes.NewReader([]byte(`{"id":"1"}`)))
+		request.Header.Set("User-Agent", userAgent)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request)
+
+		return w.Code
+	}
+
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:68.0) Gecko/20100101 Firefox/68.0"
+
+	// The discarded hits get the same response.
+	assert.Equal(t, http.StatusNoContent, track(browser))
+	assert.Equal(t, http.StatusNoContent, track(browser))
+	assert.Equal(t, http.StatusNoContent, track("Googlebot/2.1"))
+	assert.Equal(t, 1, tracked)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/analytics/_discarded", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"total":2,"discarded":{"bot":1,"duplicate":1}}`, w.Body.String())
+
+	// The retry of a hit failed to be tracked is not a duplicate.
+	other := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15) Safari/605.1.15"
+
+	failed = true
+	assert.Equal(t, http.StatusInternalServerError, track(other))
+
+	failed = false
+	assert.Equal(t, http.StatusNoContent, track(other))
+	assert.Equal(t, 2, tracked)
+}
+
+func TestTrackTimestamp(t *testing.T) {
+	var tracked []store.ViewTrack
+
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+				tracked = append(tracked, v)
+				return nil
+			},
+			OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+				tracked = append(tracked, vs...)
+				return nil
+			},
+		},
+	}
+
+	window := skew.NewWindow(24*time.Hour, 5*time.Minute, skew.PolicyLate)
+
+	handler := auth.Anonymous(store.DefaultTenant)(NewHandler(mockStore.ViewTracker(), nil, nil, WithTimestampWindow(window)))
+
+	recent := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	track := func(timestamp time.Time) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"id":"1","timestamp":%q}`, timestamp.Format(time.RFC3339))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics", bytes.NewReader([]byte(body))))
+
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, track(recent).Code)
+	assert.Equal(t, http.StatusNoContent, track(old).Code)
+
+	w := track(future)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), skew.ErrInFuture.Error())
+
+	if assert.Len(t, tracked, 2) {
+		assert.Equal(t, recent, tracked[0].Timestamp.UTC())
+		assert.False(t, tracked[0].Late)
+
+		assert.Equal(t, old, tracked[1].Timestamp.UTC())
+		assert.True(t, tracked[1].Late)
+	}
+
+	// The bulk hits are checked the same way.
+	body := fmt.Sprintf("{\"id\":\"1\",\"timestamp\":%q}\n{\"id\":\"2\",\"timestamp\":%q}", old.Format(time.RFC3339), future.Format(time.RFC3339))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics/_bulk", bytes.NewReader([]byte(body))))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"accepted":1,"discarded":0,"rejected":1,"errors":[{"line":2,"message":"`+skew.ErrInFuture.Error()+`"}]}`, w.Body.String())
+
+	if assert.Len(t, tracked, 3) {
+		assert.True(t, tracked[2].Late)
+	}
+}
+
 func compareJSON(expected, actual []byte) error {
 	if bytes.Equal(bytes.TrimSpace(actual), expected) {
 		return nil
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Maximum number of hits in a bulk request.
+	maxBulkHits = 10000
+	// Maximum size of a bulk request body, the largest body whose signature is checked.
+	maxBulkBody = auth.MaxSignedBody
+)
+
+// bulkHit is a hit of the bulk request. The timestamp is optional, default is the time of the request.
+type bulkHit struct {
+	ID        string     `json:"id"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+// LineError is the error of a hit of the bulk request. Line is the 1-based line of the NDJSON, or position in the JSON array.
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type BulkResponse struct {
+	Accepted  int         `json:"accepted"`
+	Discarded int         `json:"discarded"`
+	Rejected  int         `json:"rejected"`
+	Errors    []LineError `json:"errors"`
+}
+
+// handleBulkTrackView tracks the hits of a JSON array, or of NDJSON, one hit per line.
+// The invalid hits are rejected with their line, the others are tracked in a single batch.
+func (h *Handler) handleBulkTrackView() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), "api.BulkTrackView")
+		defer span.End()
+
+		body := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxBulkBody))
+
+		var lines []bulkLine
+		var err error
+
+		if isJSONArray(r, body) {
+			lines, err = readJSONArray(body)
+		} else {
+			lines, err = readNDJSON(body)
+		}
+
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if len(lines) == 0 {
+			renderError(w, http.StatusBadRequest, "body is empty")
+			return
+		}
+
+		if len(lines) > maxBulkHits {
+			renderError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("too many hits, maximum is %d", maxBulkHits))
+			return
+		}
+
+		tenant := auth.TenantFromContext(ctx)
+		now := time.Now()
+
+		res := BulkResponse{Errors: []LineError{}}
+		views := make([]store.ViewTrack, 0, len(lines))
+		hits := make([]filter.Hit, 0, len(lines))
+
+		for _, line := range lines {
+			view, timestamped, err := h.parseBulkHit(line.hit, tenant, now)
+			if err != nil {
+				res.Rejected++
+				res.Errors = append(res.Errors, LineError{Line: line.n, Message: err.Error()})
+
+				continue
+			}
+
+			hit := filter.NewHit(r, view)
+			hit.Timestamped = timestamped
+
+			if h.filters != nil && !h.filters.Keep(ctx, hit) {
+				res.Discarded++
+				continue
+			}
+
+			views = append(views, view)
+			hits = append(hits, hit)
+		}
+
+		span.SetAttributes(
+			attribute.Int("batch.size", len(views)),
+			attribute.Int("batch.rejected", res.Rejected),
+			attribute.Int("batch.discarded", res.Discarded))
+
+		if len(views) > 0 {
+			if err := h.viewTracker.BatchTrack(ctx, views); err != nil {
+				tracing.RecordError(span, err)
+
+				// The client retries the failed batch, its hits are not duplicates.
+				if h.filters != nil {
+					h.filters.Forget(ctx, hits...)
+				}
+
+				logging.FromContext(ctx, h.logger).Error("bulk track view", slog.Int("batch_size", len(views)), logging.Error(err))
+
+				renderError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		res.Accepted = len(views)
+
+		render(w, http.StatusOK, res)
+	}
+}
+
+func (h *Handler) parseBulkHit(line json.RawMessage, tenant string, now time.Time) (store.ViewTrack, bool, error) {
+	var hit bulkHit
+
+	if err := json.Unmarshal(line, &hit); err != nil {
+		return store.ViewTrack{}, false, err
+	}
+
+	if hit.ID == "" {
+		return store.ViewTrack{}, false, errors.New("id is empty")
+	}
+
+	timestamp, late, err := h.timestamp(hit.Timestamp, now)
+	if err != nil {
+		return store.ViewTrack{}, false, err
+	}
+
+	return store.ViewTrack{
+		Tenant:    tenant,
+		ID:        hit.ID,
+		Timestamp: timestamp,
+		Late:      late,
+	}, hit.Timestamp != nil, nil
+}
+
+// isJSONArray returns true if the body is a JSON array, by the content type or by the first character.
+func isJSONArray(r *http.Request, body *bufio.Reader) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-ndjson" {
+		return false
+	}
+
+	for {
+		c, err := body.Peek(1)
+		if err != nil {
+			return false
+		}
+
+		switch c[0] {
+		case ' ', '\t', '\r', '\n':
+			body.ReadByte()
+		default:
+			return c[0] == '['
+		}
+	}
+}
+
+// bulkLine is a hit of the body, with its line.
+type bulkLine struct {
+	n   int
+	hit json.RawMessage
+}
+
+func readJSONArray(body io.Reader) ([]bulkLine, error) {
+	var lines []bulkLine
+
+	dec := json.NewDecoder(body)
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	for dec.More() {
+		line := bulkLine{n: len(lines) + 1}
+		if err := dec.Decode(&line.hit); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line.n)
+		}
+
+		lines = append(lines, line)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// readNDJSON returns the lines of the body. The blank lines are skipped, but still counted.
+func readNDJSON(body io.Reader) ([]bulkLine, error) {
+	var lines []bulkLine
+
+	scanner := bufio.NewScanner(body)
+
+	for n := 1; scanner.Scan(); n++ {
+		hit := bytes.TrimSpace(scanner.Bytes())
+		if len(hit) == 0 {
+			continue
+		}
+
+		lines = append(lines, bulkLine{n: n, hit: append(json.RawMessage{}, hit...)})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
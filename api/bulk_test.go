@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkTrack(t *testing.T) {
+	var tracked []store.ViewTrack
+
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+				tracked = vs
+				return nil
+			},
+		},
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(mockStore.ViewTracker(), nil, nil))
+
+	timestamp := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantIDs     []string
+		wantRes     BulkResponse
+	}{
+		{
+			name:     "empty body",
+			body:     "",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "malformed array",
+			body:     `[{"id":"1"},`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "json array",
+			body:     ` [{"id":"1","timestamp":"2020-03-01T10:00:00Z"}, {"id":""}, {"id":2}, {"id":"3"}]`,
+			wantCode: http.StatusOK,
+			wantIDs:  []string{"1", "3"},
+			wantRes: BulkResponse{
+				Accepted: 2,
+				Rejected: 2,
+				Errors: []LineError{
+					{Line: 2, Message: "id is empty"},
+					{Line: 3, Message: "json: cannot unmarshal number into Go struct field bulkHit.id of type string"},
+				},
+			},
+		},
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        "{\"id\":\"1\",\"timestamp\":\"2020-03-01T10:00:00Z\"}\n\n{\"id\":\n{\"id\":\"3\"}\n",
+			wantCode:    http.StatusOK,
+			wantIDs:     []string{"1", "3"},
+			wantRes: BulkResponse{
+				Accepted: 2,
+				Rejected: 1,
+				Errors:   []LineError{{Line: 3, Message: "unexpected end of JSON input"}},
+			},
+		},
+		{
+			name:     "all rejected",
+			body:     `{"id":""}`,
+			wantCode: http.StatusOK,
+			wantRes: BulkResponse{
+				Rejected: 1,
+				Errors:   []LineError{{Line: 1, Message: "id is empty"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracked = nil
+
+			request := httptest.NewRequest("POST", "/analytics/_bulk", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				request.Header.Set("Content-Type", tc.contentType)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, request)
+
+			if !assert.Equal(t, tc.wantCode, w.Code, "status code") || tc.wantCode != http.StatusOK {
+				return
+			}
+
+			var res BulkResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(t, tc.wantRes, res)
+
+			var ids []string
+			for _, v := range tracked {
+				ids = append(ids, v.ID)
+				assert.Equal(t, "acme", v.Tenant)
+			}
+
+			assert.Equal(t, tc.wantIDs, ids)
+
+			if len(tracked) > 0 {
+				assert.Equal(t, timestamp, tracked[0].Timestamp.UTC(), "client timestamp")
+				assert.WithinDuration(t, time.Now(), tracked[1].Timestamp, time.Minute, "default timestamp")
+			}
+		})
+	}
+}
+
+func TestBulkTrackDedup(t *testing.T) {
+	var tracked []store.ViewTrack
+
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+				tracked = append(tracked, vs...)
+				return nil
+			},
+		},
+	}
+
+	chain := filter.NewChain(filter.NewMemoryCounter(), nil, filter.Dedup(filter.NewMemoryMarker(), time.Minute))
+
+	handler := auth.Anonymous("acme")(NewHandler(mockStore.ViewTracker(), nil, nil, WithFilters(chain)))
+
+	bulk := func(body string) BulkResponse {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics/_bulk", strings.NewReader(body)))
+
+		var res BulkResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+		return res
+	}
+
+	// The hits of an ID buffered offline are not duplicates, they have their own time.
+	res := bulk(`[{"id":"1","timestamp":"2020-03-01T10:00:00Z"}, {"id":"1","timestamp":"2020-03-01T10:05:00Z"}]`)
+	assert.Equal(t, BulkResponse{Accepted: 2, Errors: []LineError{}}, res)
+
+	// The same hits sent again, and the hits without time, are.
+	res = bulk(`[{"id":"1","timestamp":"2020-03-01T10:00:00Z"}, {"id":"2"}, {"id":"2"}]`)
+	assert.Equal(t, BulkResponse{Accepted: 1, Discarded: 2, Errors: []LineError{}}, res)
+
+	assert.Len(t, tracked, 3)
+}
+
+func TestBulkTrackError(t *testing.T) {
+	mockStore := &mock.Store{
+		ViewTrackerStore: &mock.ViewTracker{
+			OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+				return errors.New("queue is full")
+			},
+		},
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(mockStore.ViewTracker(), nil, nil))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics/_bulk", bytes.NewReader([]byte(`[{"id":"1"}]`))))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Too many hits.
+	body := strings.Repeat("{\"id\":\"1\"}\n", maxBulkHits+1)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics/_bulk", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
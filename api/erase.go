@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/go-chi/chi"
+)
+
+// erasureTimeout is the max time waited for an erasure task, before giving up calling the erased func.
+const erasureTimeout = time.Hour
+
+// WithErasure deletes the views of an ID at DELETE /analytics/{id}, as a task whose progress is served at GET /analytics/_tasks/{task}.
+// The tasks are recorded in the owners, so a tenant only gets the progress of its own tasks.
+// The erased func, if not nil, is called once the task completes, e.g. to erase the views from the archive and refresh the streams of the ID.
+func WithErasure(purger store.ViewPurger, owners retention.TaskOwners, erased func(ctx context.Context, tenant, id string)) func(*Handler) {
+	return func(h *Handler) {
+		h.purger = purger
+		h.taskOwners = owners
+		h.erased = erased
+		h.erasurePollInterval = 2 * time.Second
+	}
+}
+
+type erasureResponse struct {
+	Task string `json:"task"`
+	// Status is the path of the progress of the task.
+	Status string `json:"status"`
+}
+
+func (h *Handler) handleErase() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		ctx, span := tracer.Start(r.Context(), "api.Erase")
+		defer span.End()
+
+		span.SetAttributes(tracing.IDAttribute(id))
+
+		tenant := auth.TenantFromContext(ctx)
+		logger := logging.FromContext(ctx, h.logger)
+
+		taskID, err := h.purger.Purge(ctx, store.PurgeFilter{Tenant: tenant, ID: id})
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logger.Error("erase", slog.String("id", id), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		logger.Info("erasing views", slog.String("id", id), slog.String("task", taskID))
+
+		// The task carries on anyway, only its progress is not served.
+		if err := h.taskOwners.Add(ctx, tenant, taskID); err != nil {
+			logger.Error("record erasure task", slog.String("task", taskID), logging.Error(err))
+		}
+
+		if h.erased != nil {
+			// The task carries on after the response, and so does the wait.
+			go h.awaitErasure(context.WithoutCancel(ctx), logger, tenant, id, taskID)
+		}
+
+		res := erasureResponse{Task: taskID, Status: "/analytics/_tasks/" + url.PathEscape(taskID)}
+
+		w.Header().Set("Location", res.Status)
+		render(w, http.StatusAccepted, res)
+	}
+}
+
+// awaitErasure calls the erased func once the task deleting the views of the ID completes.
+func (h *Handler) awaitErasure(ctx context.Context, logger *slog.Logger, tenant, id, taskID string) {
+	ctx, cancel := context.WithTimeout(ctx, erasureTimeout)
+	defer cancel()
+
+	if _, err := retention.Wait(ctx, h.purger, taskID, h.erasurePollInterval, nil); err != nil {
+		logger.Error("wait erasure", slog.String("id", id), logging.Error(err))
+		return
+	}
+
+	h.erased(ctx, tenant, id)
+}
+
+type taskResponse struct {
+	Task      string `json:"task"`
+	Completed bool   `json:"completed"`
+	Total     int64  `json:"total"`
+	Deleted   int64  `json:"deleted"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (h *Handler) handleTaskStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID := chi.URLParam(r, "task")
+
+		ctx, span := tracer.Start(r.Context(), "api.TaskStatus")
+		defer span.End()
+
+		// The task IDs are <node>:<number>.
+		if node, number, ok := strings.Cut(taskID, ":"); !ok || node == "" || number == "" {
+			renderError(w, http.StatusBadRequest, "invalid task")
+			return
+		}
+
+		logger := logging.FromContext(ctx, h.logger)
+
+		// The tasks of the other tenants, and the other tasks of the cluster, are not found.
+		owns, err := h.taskOwners.Owns(ctx, auth.TenantFromContext(ctx), taskID)
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logger.Error("task owner", slog.String("task", taskID), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if !owns {
+			renderError(w, http.StatusNotFound, store.ErrTaskNotFound.Error())
+			return
+		}
+
+		status, err := h.purger.PurgeStatus(ctx, taskID)
+		if errors.Is(err, store.ErrTaskNotFound) {
+			renderError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logger.Error("task status", slog.String("task", taskID), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		render(w, http.StatusOK, taskResponse{
+			Task:      taskID,
+			Completed: status.Completed,
+			Total:     status.Total,
+			Deleted:   status.Deleted,
+			Error:     status.Error,
+		})
+	}
+}
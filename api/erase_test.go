@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErase(t *testing.T) {
+	purger := &mock.ViewPurger{
+		OnPurge: func(ctx context.Context, f store.PurgeFilter) (string, error) {
+			if f.ID == "broken" {
+				return "", errors.New("elastic is down")
+			}
+
+			assert.Equal(t, store.PurgeFilter{Tenant: "acme", ID: "1"}, f)
+
+			return "node:42", nil
+		},
+		OnPurgeStatus: func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+			if taskID == "node:43" {
+				return store.PurgeStatus{}, store.ErrTaskNotFound
+			}
+
+			assert.Equal(t, "node:42", taskID)
+
+			return store.PurgeStatus{Completed: true, Total: 3, Deleted: 3}, nil
+		},
+	}
+
+	owners := retention.NewMemoryTaskOwners()
+	erased := make(chan string, 1)
+
+	handler := NewHandler(nil, nil, nil, WithErasure(purger, owners, func(ctx context.Context, tenant, id string) {
+		erased <- tenant + "/" + id
+	}))
+	handler.erasurePollInterval = time.Millisecond
+
+	anonymous := auth.Anonymous("acme")(handler)
+
+	rr := httptest.NewRecorder()
+	anonymous.ServeHTTP(rr, httptest.NewRequest("DELETE", "/analytics/1", nil))
+
+	assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	assert.Equal(t, "/analytics/_tasks/node:42", rr.Header().Get("Location"))
+	assert.JSONEq(t, `{"task":"node:42","status":"/analytics/_tasks/node:42"}`, rr.Body.String())
+
+	select {
+	case id := <-erased:
+		assert.Equal(t, "acme/1", id)
+	case <-time.After(time.Second):
+		t.Fatal("erased not called")
+	}
+
+	rr = httptest.NewRecorder()
+	anonymous.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/_tasks/node:42", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"task":"node:42","completed":true,"total":3,"deleted":3}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	anonymous.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/_tasks/42", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// The tasks of the other tenants are not found.
+	rr = httptest.NewRecorder()
+	auth.Anonymous("globex")(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/_tasks/node:42", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Neither are the tasks no longer known by the store.
+	assert.NoError(t, owners.Add(context.Background(), "acme", "node:43"))
+
+	rr = httptest.NewRecorder()
+	anonymous.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/_tasks/node:43", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"message":"task not found"}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	anonymous.ServeHTTP(rr, httptest.NewRequest("DELETE", "/analytics/broken", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	// The read and write scopes don't allow to erase.
+	keys := auth.NewAuthenticator(auth.NewMemoryKeyStore([]auth.Key{
+		{ID: "dashboard", Secret: "s3cret", Tenant: "acme", Scopes: []auth.Scope{auth.ScopeWrite, auth.ScopeRead}},
+	}))
+
+	req := httptest.NewRequest("DELETE", "/analytics/1", nil)
+	req.Header.Set(auth.HeaderAPIKey, "dashboard.s3cret")
+
+	rr = httptest.NewRecorder()
+	keys.Middleware(handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
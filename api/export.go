@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/export"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/go-chi/chi"
+)
+
+// exportWriteTimeout is the time to write a page of an export, the write deadline of the server being too short for an export.
+const exportWriteTimeout = 30 * time.Second
+
+// exportErrorTrailer is the trailer set when the export fails once the response is sent, the status being already OK.
+const exportErrorTrailer = "X-Export-Error"
+
+// WithExport serves the views of an ID, or their counts per interval, as a file at GET /analytics/{id}/export.
+func WithExport(exporter *export.Exporter) func(*Handler) {
+	return func(h *Handler) {
+		h.exporter = exporter
+	}
+}
+
+// exportWriter sends the headers on the first write, so an error before any row is still rendered as an error,
+// and extends the write deadline of the server on each write.
+type exportWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	header  func()
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.header()
+		e.started = true
+	}
+
+	if err := e.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+
+	return e.w.Write(p)
+}
+
+// Flush sends the rows written to the client, it is called by the exporter after each page.
+func (e *exportWriter) Flush() {
+	e.rc.Flush()
+}
+
+func (h *Handler) handleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		params := r.URL.Query()
+
+		ctx, span := tracer.Start(r.Context(), "api.Export")
+		defer span.End()
+
+		span.SetAttributes(tracing.IDAttribute(id))
+
+		format, err := export.ParseFormat(paramOr(params.Get("format"), string(export.CSV)))
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		kind, err := export.ParseKind(paramOr(params.Get("kind"), string(export.Hits)))
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if params.Get("from") == "" {
+			renderError(w, http.StatusBadRequest, "from is required")
+			return
+		}
+
+		from, err := time.Parse(time.RFC3339, params.Get("from"))
+		if err != nil {
+			renderError(w, http.StatusBadRequest, "from must be a RFC 3339 time")
+			return
+		}
+
+		to := time.Now()
+		if params.Get("to") != "" {
+			if to, err = time.Parse(time.RFC3339, params.Get("to")); err != nil {
+				renderError(w, http.StatusBadRequest, "to must be a RFC 3339 time")
+				return
+			}
+		}
+
+		if !to.After(from) {
+			renderError(w, http.StatusBadRequest, "to must be after from")
+			return
+		}
+
+		interval, err := time.ParseDuration(paramOr(params.Get("interval"), "1h"))
+		if err != nil || interval < time.Second {
+			renderError(w, http.StatusBadRequest, "interval must be a duration of at least 1s, e.g. 1h")
+			return
+		}
+
+		out := &exportWriter{
+			w:  w,
+			rc: http.NewResponseController(w),
+			header: func() {
+				filename := id + "-" + string(kind) + "." + string(format)
+
+				w.Header().Set("Content-Type", format.ContentType())
+				w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+				w.Header().Set("Trailer", exportErrorTrailer)
+				w.WriteHeader(http.StatusOK)
+			},
+		}
+
+		tenant := auth.TenantFromContext(ctx)
+
+		if kind == export.Buckets {
+			_, err = h.exporter.Buckets(ctx, out, format, store.HistogramQuery{Tenant: tenant, ID: id, Interval: interval, From: from, To: to})
+		} else {
+			_, err = h.exporter.Hits(ctx, out, format, store.HitQuery{Tenant: tenant, ID: id, From: from, To: to})
+		}
+
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logging.FromContext(ctx, h.logger).Error("export", slog.String("id", id), logging.Error(err))
+
+			if !out.started {
+				renderError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			// The rows sent are incomplete, which the client can only know from the trailer.
+			w.Header().Set(exportErrorTrailer, err.Error())
+		}
+	}
+}
+
+// paramOr returns the param, or the default value if it is empty.
+func paramOr(param, defaultValue string) string {
+	if param == "" {
+		return defaultValue
+	}
+
+	return param
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/export"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	retriever := &mock.ViewRetriever{
+		OnHits: func(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+			assert.Equal(t, "acme", q.Tenant)
+			assert.Equal(t, from, q.From)
+			assert.Equal(t, from.Add(time.Hour), q.To)
+
+			switch {
+			case q.ID == "broken":
+				return store.HitPage{}, errors.New("elastic is down")
+			case q.After == "":
+				return store.HitPage{Hits: []store.ViewTrack{{Tenant: "acme", ID: q.ID, Timestamp: from}}, Next: "next"}, nil
+			case q.ID == "flaky":
+				return store.HitPage{}, errors.New("elastic is down")
+			default:
+				return store.HitPage{Hits: []store.ViewTrack{{Tenant: "acme", ID: q.ID, Timestamp: from.Add(time.Minute)}}}, nil
+			}
+		},
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, retriever, nil, WithExport(export.NewExporter(retriever))))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/export?from=2020-01-01T00:00:00Z&to=2020-01-01T01:00:00Z", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=1-hits.csv`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, "tenant,id,timestamp\nacme,1,2020-01-01T00:00:00Z\nacme,1,2020-01-01T00:01:00Z\n", rr.Body.String())
+	assert.Empty(t, rr.Result().Trailer.Get(exportErrorTrailer))
+
+	for _, query := range []string{
+		"from=2020-01-01T00:00:00Z&format=xlsx",
+		"from=2020-01-01T00:00:00Z&kind=views",
+		"to=2020-01-01T01:00:00Z",
+		"from=2020-01-01T01:00:00Z&to=2020-01-01T00:00:00Z",
+		"from=2020-01-01T00:00:00Z&kind=buckets&interval=1ms",
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/export?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+
+	// Nothing is sent yet, the error is rendered.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/broken/export?from=2020-01-01T00:00:00Z&to=2020-01-01T01:00:00Z", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	// The first page is sent, the error is in the trailer.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/flaky/export?from=2020-01-01T00:00:00Z&to=2020-01-01T01:00:00Z", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "tenant,id,timestamp\nacme,flaky,2020-01-01T00:00:00Z\n", rr.Body.String())
+	assert.Equal(t, "elastic is down", rr.Result().Trailer.Get(exportErrorTrailer))
+}
+
+func TestExportDisabled(t *testing.T) {
+	handler := auth.Anonymous("acme")(NewHandler(nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/export?from=2020-01-01T00:00:00Z", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	defaultHitLimit = 100
+	maxHitLimit     = 1000
+	// defaultHitRange is the range listed when from is not set.
+	defaultHitRange = 24 * time.Hour
+)
+
+type hitsResponse struct {
+	ID   string            `json:"id"`
+	Hits []store.ViewTrack `json:"hits"`
+	// Next is the cursor of the next page, omitted on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// handleHits lists the hits of an ID, newest first, a page at a time.
+func (h *Handler) handleHits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		params := r.URL.Query()
+
+		ctx, span := tracer.Start(r.Context(), "api.Hits")
+		defer span.End()
+
+		span.SetAttributes(tracing.IDAttribute(id))
+
+		cursor := params.Get("cursor")
+
+		// The cursor keeps the range of the first page, so the pages never shift with now.
+		var from, to time.Time
+		if cursor == "" {
+			var ok bool
+			if from, to, ok = hitRange(w, params.Get("from"), params.Get("to")); !ok {
+				return
+			}
+		}
+
+		limit, err := strconv.Atoi(paramOr(params.Get("limit"), strconv.Itoa(defaultHitLimit)))
+		if err != nil || limit < 1 || limit > maxHitLimit {
+			renderError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxHitLimit))
+			return
+		}
+
+		page, err := h.viewRetriever.Hits(ctx, store.HitQuery{
+			Tenant: auth.TenantFromContext(ctx),
+			ID:     id,
+			From:   from,
+			To:     to,
+			Newest: true,
+			Size:   limit,
+			After:  cursor,
+		})
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrCursorExpired) {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			tracing.RecordError(span, err)
+
+			logging.FromContext(ctx, h.logger).Error("hits", slog.String("id", id), logging.Error(err))
+
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		render(w, http.StatusOK, hitsResponse{ID: id, Hits: page.Hits, Next: page.Next})
+	}
+}
+
+// hitRange parses the range of the first page of hits, rendering the error if it is invalid.
+func hitRange(w http.ResponseWriter, fromParam, toParam string) (from, to time.Time, ok bool) {
+	to = time.Now()
+	if toParam != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, toParam); err != nil {
+			renderError(w, http.StatusBadRequest, "to must be a RFC 3339 time")
+			return from, to, false
+		}
+	}
+
+	from = to.Add(-defaultHitRange)
+	if fromParam != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			renderError(w, http.StatusBadRequest, "from must be a RFC 3339 time")
+			return from, to, false
+		}
+	}
+
+	if !to.After(from) {
+		renderError(w, http.StatusBadRequest, "to must be after from")
+		return from, to, false
+	}
+
+	return from, to, true
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHits(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	retriever := &mock.ViewRetriever{
+		OnHits: mock.Hits([]store.ViewTrack{
+			{Tenant: "acme", ID: "1", Timestamp: from.Add(time.Minute)},
+			{Tenant: "acme", ID: "1", Timestamp: from.Add(2 * time.Minute)},
+			{Tenant: "acme", ID: "1", Timestamp: from.Add(3 * time.Minute)},
+			{Tenant: "acme", ID: "1", Timestamp: from.Add(2 * time.Hour)},
+			{Tenant: "acme", ID: "2", Timestamp: from.Add(time.Minute)},
+			{Tenant: "globex", ID: "1", Timestamp: from.Add(time.Minute)},
+		}),
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, retriever, nil))
+
+	// Page through the hits, newest first.
+	var timestamps []time.Time
+
+	// The next pages keep the range of the first page.
+	url := "/analytics/1/hits?from=2020-01-01T00:00:00Z&to=2020-01-01T01:00:00Z&limit=2"
+
+	for pages := 0; pages < 10; pages++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+
+		if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+			return
+		}
+
+		var res hitsResponse
+		if !assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res)) {
+			return
+		}
+
+		assert.Equal(t, "1", res.ID)
+
+		for _, hit := range res.Hits {
+			timestamps = append(timestamps, hit.Timestamp)
+		}
+
+		if res.Next == "" {
+			break
+		}
+
+		url = "/analytics/1/hits?limit=2&cursor=" + res.Next
+	}
+
+	assert.Equal(t, []time.Time{from.Add(3 * time.Minute), from.Add(2 * time.Minute), from.Add(time.Minute)}, timestamps)
+
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2020-01-01T00:00:00Z&from=2020-01-01T01:00:00Z",
+		"limit=0",
+		"limit=1001",
+		"cursor=not-a-cursor",
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/hits?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
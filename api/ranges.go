@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// defaultRanges are the ranges counted when the request has none.
+var defaultRanges = []store.Range{store.FiveMinute, store.OneHour, store.OneDay, store.OneWeek, store.OneMonth}
+
+// viewQuery returns the query of the counts of the ID, with the ranges, tz, week_start and compare parameters of the request.
+func viewQuery(r *http.Request, tenant, id string) (store.ViewQuery, error) {
+	params := r.URL.Query()
+
+	q := store.ViewQuery{
+		Tenant:    tenant,
+		ID:        id,
+		Ranges:    defaultRanges,
+		Location:  time.UTC,
+		WeekStart: time.Monday,
+	}
+
+	if tz := params.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		// Local is the zone of the server, not of the customer.
+		if err != nil || tz == "Local" {
+			return store.ViewQuery{}, errors.New("tz must be a IANA time zone, e.g. Europe/Paris")
+		}
+
+		q.Location = loc
+	}
+
+	if weekStart := params.Get("week_start"); weekStart != "" {
+		day, ok := parseWeekday(weekStart)
+		if !ok {
+			return store.ViewQuery{}, errors.New("week_start must be a day, e.g. monday")
+		}
+
+		q.WeekStart = day
+	}
+
+	if compare := params.Get("compare"); compare != "" {
+		var err error
+		if q.Compare, err = strconv.ParseBool(compare); err != nil {
+			return store.ViewQuery{}, errors.New("compare must be true or false")
+		}
+	}
+
+	if names := params.Get("ranges"); names != "" {
+		q.Ranges = nil
+		seen := make(map[store.Range]bool)
+
+		for _, name := range strings.Split(names, ",") {
+			rang, err := store.ParseRange(strings.TrimSpace(name))
+			if err != nil {
+				return store.ViewQuery{}, err
+			}
+
+			if seen[rang] {
+				return store.ViewQuery{}, fmt.Errorf("range %q is repeated", name)
+			}
+
+			seen[rang] = true
+			q.Ranges = append(q.Ranges, rang)
+		}
+	}
+
+	return q, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrieveCalendarRanges(t *testing.T) {
+	var got store.ViewQuery
+
+	retriever := &mock.ViewRetriever{
+		OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+			got = q
+			return []store.ViewCount{}, nil
+		},
+	}
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, retriever, nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1?tz=Europe/Paris&week_start=sunday&ranges=today,yesterday,this_week,1h&compare=true", nil))
+
+	if assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		assert.Equal(t, []store.Range{store.Today, store.Yesterday, store.ThisWeek, store.OneHour}, got.Ranges)
+		assert.Equal(t, "Europe/Paris", got.Location.String())
+		assert.Equal(t, time.Sunday, got.WeekStart)
+		assert.True(t, got.Compare)
+	}
+
+	// The defaults.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1", nil))
+
+	if assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		assert.Equal(t, defaultRanges, got.Ranges)
+		assert.Equal(t, time.UTC, got.Location)
+		assert.Equal(t, time.Monday, got.WeekStart)
+		assert.False(t, got.Compare)
+	}
+
+	for _, query := range []string{
+		"tz=Mars/Olympus",
+		"tz=Local",
+		"week_start=someday",
+		"ranges=today,1y",
+		"ranges=today,today",
+		"compare=maybe",
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
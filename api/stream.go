@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
+
+	"github.com/go-chi/chi"
+)
+
+// A write to a stream taking longer is a slow client, and the stream is closed.
+const streamWriteTimeout = 10 * time.Second
+
+// WithStream serves the counts of an ID as Server-Sent Events at GET /analytics/{id}/stream, pushed when new views
+// of the ID are indexed, as notified by the hub. The counts are sent at most once per interval, and a comment
+// is sent every heartbeat so the proxies keep the connection open.
+func WithStream(hub *live.Hub, interval, heartbeat time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.hub = hub
+		h.streamInterval = interval
+		h.streamHeartbeat = heartbeat
+	}
+}
+
+// handleStreamView sends the counts once connected, and then every time they may have changed, until the hub is closed.
+// A slow client never blocks the others: the notifications received while the counts are sent are coalesced,
+// and the stream is closed if a write takes longer than streamWriteTimeout.
+func (h *Handler) handleStreamView() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		ctx := r.Context()
+		tenant := auth.TenantFromContext(ctx)
+		logger := logging.FromContext(ctx, h.logger).With(slog.String("id", id))
+
+		rc := http.NewResponseController(w)
+
+		// write sends the event, extending the write deadline of the server, which is too short for a stream.
+		write := func(event string) error {
+			if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && err != http.ErrNotSupported {
+				return err
+			}
+
+			if _, err := fmt.Fprint(w, event); err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		q, err := viewQuery(r, tenant, id)
+		if err != nil {
+			renderError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		sendCounts := func() error {
+			counts, err := h.viewRetriever.Retrieve(ctx, q)
+			if err != nil {
+				// The counts are sent again on the next notification.
+				logger.Error("stream retrieve view", logging.Error(err))
+				return nil
+			}
+
+			data, err := json.Marshal(retrieveResponse{ID: id, Counts: counts})
+			if err != nil {
+				return err
+			}
+
+			return write("event: counts\ndata: " + string(data) + "\n\n")
+		}
+
+		sub := h.hub.Subscribe(tenant, id)
+		defer h.hub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if err := sendCounts(); err != nil {
+			logger.Debug("stream closed", logging.Error(err))
+			return
+		}
+
+		interval := time.NewTicker(h.streamInterval)
+		defer interval.Stop()
+
+		heartbeat := time.NewTicker(h.streamHeartbeat)
+		defer heartbeat.Stop()
+
+		var pending bool
+
+		for {
+			var err error
+
+			select {
+			case <-ctx.Done():
+				return
+
+			case _, ok := <-sub.C:
+				// The hub is closed, the server is shutting down.
+				if !ok {
+					return
+				}
+
+				pending = true
+
+			case <-interval.C:
+				if pending {
+					pending = false
+					err = sendCounts()
+				}
+
+			case <-heartbeat.C:
+				err = write(": heartbeat\n\n")
+			}
+
+			if err != nil {
+				logger.Debug("stream closed", logging.Error(err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	var count int64
+
+	retriever := &mock.ViewRetriever{
+		OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+			assert.Equal(t, "acme", q.Tenant)
+
+			return []store.ViewCount{{Description: "5 minutes ago", Count: atomic.LoadInt64(&count)}}, nil
+		},
+	}
+
+	hub := live.NewHub()
+
+	handler := auth.Anonymous("acme")(NewHandler(nil, retriever, nil, WithStream(hub, 10*time.Millisecond, 50*time.Millisecond)))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/analytics/1/stream", nil)
+
+	res, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(res.Body)
+
+	// next returns the next event, or the comment.
+	next := func() string {
+		var event []string
+
+		for lines.Scan() {
+			if lines.Text() == "" {
+				return strings.Join(event, "\n")
+			}
+
+			event = append(event, lines.Text())
+		}
+
+		return ""
+	}
+
+	counts := func(event string) int64 {
+		var data retrieveResponse
+
+		if !assert.True(t, strings.HasPrefix(event, "event: counts\ndata: "), event) {
+			return -1
+		}
+
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "event: counts\ndata: ")), &data); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "1", data.ID)
+
+		return data.Counts[0].Count
+	}
+
+	assert.Equal(t, int64(0), counts(next()))
+	assert.Equal(t, 1, hub.Subscribers())
+
+	// Without notification, only the heartbeats are sent.
+	assert.Equal(t, ": heartbeat", next())
+
+	atomic.StoreInt64(&count, 2)
+	hub.Notify("acme", "1")
+
+	event := next()
+	if event == ": heartbeat" {
+		event = next()
+	}
+
+	assert.Equal(t, int64(2), counts(event))
+
+	hub.Close()
+
+	// The stream ends, possibly after a last heartbeat.
+	event = next()
+	if event == ": heartbeat" {
+		event = next()
+	}
+
+	assert.Equal(t, "", event, "the stream is not closed")
+
+	for i := 0; i < 100 && hub.Subscribers() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, 0, hub.Subscribers())
+}
+
+func TestStreamDisabled(t *testing.T) {
+	handler := auth.Anonymous("acme")(NewHandler(nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/analytics/1/stream", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
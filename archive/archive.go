@@ -0,0 +1,441 @@
+// Package archive keeps the batches consumed by the indexer in compressed, time-partitioned segments,
+// the source of truth to rebuild an index from, since the queue messages are deleted once consumed.
+//
+// A segment is a gzip file of records, each the archive time and a marshalled proto.ViewTrackBatchRequest, both length prefixed.
+// The segments are stored at <yyyy>/<mm>/<dd>/<hh>/<start>-<node>.gz, the UTC hour and the Unix time in nanoseconds
+// of their first record, and never span two hours.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+
+	"github.com/pkg/errors"
+)
+
+// partition is the layout of the hour of a segment key.
+const partition = "2006/01/02/15"
+
+type Archiver struct {
+	bucket Bucket
+	logger *slog.Logger
+
+	flushInterval  time.Duration
+	maxSegmentSize int
+	maxPending     int
+	// node is unique per archiver, so the archivers of several indexers never write the same key.
+	node string
+
+	now func() time.Time
+
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	start time.Time
+	// pending are the segments to store, complete or which failed to be stored, retried on the next flush.
+	pending []segment
+
+	// flushMu serializes the flushes, so a segment is stored once. The consumers are never blocked by the bucket.
+	flushMu sync.Mutex
+}
+
+type segment struct {
+	key  string
+	data []byte
+}
+
+type Option func(*Archiver)
+
+// WithLogger sets the logger of the failed flushes. Default is to discard the logs.
+func WithLogger(logger *slog.Logger) func(*Archiver) {
+	return func(a *Archiver) {
+		a.logger = logger
+	}
+}
+
+// WithFlushInterval sets the max age of a segment before it is stored. Default is 1 minute.
+func WithFlushInterval(interval time.Duration) func(*Archiver) {
+	return func(a *Archiver) {
+		a.flushInterval = interval
+	}
+}
+
+// WithMaxSegmentSize sets the compressed size from which a segment is stored. Default is 64 MiB.
+func WithMaxSegmentSize(size int) func(*Archiver) {
+	return func(a *Archiver) {
+		a.maxSegmentSize = size
+	}
+}
+
+func NewArchiver(bucket Bucket, opts ...Option) *Archiver {
+	node := make([]byte, 4)
+	rand.Read(node)
+
+	a := &Archiver{
+		bucket:         bucket,
+		flushInterval:  time.Minute,
+		maxSegmentSize: 64 << 20,
+		maxPending:     10,
+		node:           hex.EncodeToString(node),
+		now:            time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.logger = logging.OrDiscard(a.logger).With(slog.String("component", "archive"))
+
+	return a
+}
+
+// Archive appends the payload, a marshalled proto.ViewTrackBatchRequest, to the current segment.
+// The segment is stored by the next flush.
+func (a *Archiver) Archive(ctx context.Context, payload []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now().UTC()
+
+	// A segment never spans two hours, so a replay only reads the partitions of its range.
+	if a.gz != nil && !now.Truncate(time.Hour).Equal(a.start.Truncate(time.Hour)) {
+		a.seal()
+	}
+
+	if a.gz == nil {
+		a.buf.Reset()
+		a.gz = gzip.NewWriter(&a.buf)
+		a.start = now
+	}
+
+	if err := writeRecord(a.gz, uint64(now.UnixNano()), payload); err != nil {
+		return err
+	}
+
+	if a.buf.Len() >= a.maxSegmentSize {
+		a.seal()
+	}
+
+	return nil
+}
+
+// seal completes the current segment, to be stored by the next flush.
+func (a *Archiver) seal() {
+	if a.gz == nil {
+		return
+	}
+
+	if err := a.gz.Close(); err != nil {
+		a.logger.Error("close segment", logging.Error(err))
+	}
+
+	key := fmt.Sprintf("%s/%d-%s.gz", a.start.Format(partition), a.start.UnixNano(), a.node)
+
+	a.pending = append(a.pending, segment{key: key, data: append([]byte(nil), a.buf.Bytes()...)})
+	a.gz = nil
+}
+
+// Run flushes the current segment every flush interval, until the context is done, then flushes it a last time.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.Flush(context.Background())
+			return
+		case <-ticker.C:
+			a.Flush(ctx)
+		}
+	}
+}
+
+// Flush stores the current segment, and the segments which failed to be stored before.
+// It returns the number of segments still pending.
+func (a *Archiver) Flush(ctx context.Context) int {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	a.seal()
+	pending := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	for len(pending) > 0 {
+		s := pending[0]
+
+		if err := a.bucket.Put(ctx, s.key, s.data); err != nil {
+			a.logger.Error("store segment", slog.String("key", s.key), slog.Int("pending", len(pending)), logging.Error(err))
+			break
+		}
+
+		pending = pending[1:]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending = append(pending, a.pending...)
+
+	// Keep the memory bounded while the bucket is down.
+	for len(a.pending) > a.maxPending {
+		a.logger.Error("segment dropped, too many pending segments", slog.String("key", a.pending[0].key))
+		a.pending = a.pending[1:]
+	}
+
+	return len(a.pending)
+}
+
+// Replay calls fn with the batches archived in [from, to), segment by segment in order of their start.
+func Replay(ctx context.Context, bucket Bucket, from, to time.Time, fn func(batch *proto.ViewTrackBatchRequest) error) error {
+	for hour := from.UTC().Truncate(time.Hour); hour.Before(to); hour = hour.Add(time.Hour) {
+		keys, err := bucket.List(ctx, hour.Format(partition)+"/")
+		if err != nil {
+			return errors.Wrapf(err, "list %s", hour.Format(partition))
+		}
+
+		// The keys of an hour are sorted by start, the times having the same number of digits.
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if start, ok := segmentStart(key); !ok || !start.Before(to) {
+				continue
+			}
+
+			if err := replaySegment(ctx, bucket, key, from, to, fn); err != nil {
+				return errors.Wrapf(err, "segment %s", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// segmentStart returns the start of the segment of the key.
+func segmentStart(key string) (time.Time, bool) {
+	name := path.Base(key)
+
+	i := strings.IndexByte(name, '-')
+	if i < 0 {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
+
+func replaySegment(ctx context.Context, bucket Bucket, key string, from, to time.Time, fn func(batch *proto.ViewTrackBatchRequest) error) error {
+	return readSegment(ctx, bucket, key, func(nanos uint64, payload []byte) error {
+		if archived := time.Unix(0, int64(nanos)); archived.Before(from) || !archived.Before(to) {
+			return nil
+		}
+
+		batch := &proto.ViewTrackBatchRequest{}
+		if err := batch.Unmarshal(payload); err != nil {
+			return err
+		}
+
+		return fn(batch)
+	})
+}
+
+const (
+	// eraseLockKey is the key marked by the erasure in progress.
+	eraseLockKey = "erase"
+	// eraseLockTTL releases the lock of an erasure which never completed, e.g. its process crashed.
+	eraseLockTTL = time.Hour
+	// eraseLockRetry is the interval between the attempts to take the lock.
+	eraseLockRetry = time.Second
+)
+
+// Erase removes the views of the ID of the tenant from every stored segment, so a replay never indexes them again,
+// and returns the number of views removed. The segments not stored yet by the archivers are not erased.
+//
+// The segments are rewritten, so the erasures are serialized by the lock, e.g. a filter.RedisMarker shared by the servers
+// and the admin commands: two erasures rewriting the same segment at once would bring back the views erased by the first one.
+// Erase waits for the lock until the context is done.
+func Erase(ctx context.Context, bucket Bucket, lock filter.Marker, tenant, id string) (int, error) {
+	if err := lockErasure(ctx, lock); err != nil {
+		return 0, errors.Wrap(err, "lock")
+	}
+	// The lock expires anyway, if it fails to be released.
+	defer lock.Unmark(context.WithoutCancel(ctx), eraseLockKey)
+
+	keys, err := bucket.List(ctx, "")
+	if err != nil {
+		return 0, errors.Wrap(err, "list")
+	}
+
+	var total int
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		n, err := eraseSegment(ctx, bucket, key, tenant, id)
+		if err != nil {
+			return total, errors.Wrapf(err, "segment %s", key)
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+// lockErasure marks the lock of the erasures, waiting for the erasure in progress to complete.
+func lockErasure(ctx context.Context, lock filter.Marker) error {
+	ticker := time.NewTicker(eraseLockRetry)
+	defer ticker.Stop()
+
+	for {
+		locked, err := lock.Mark(ctx, eraseLockKey, eraseLockTTL)
+		if err != nil {
+			return err
+		}
+
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// eraseSegment rewrites the segment without the views of the ID, if it has any.
+func eraseSegment(ctx context.Context, bucket Bucket, key, tenant, id string) (int, error) {
+	var (
+		buf     bytes.Buffer
+		removed int
+	)
+
+	gz := gzip.NewWriter(&buf)
+
+	err := readSegment(ctx, bucket, key, func(nanos uint64, payload []byte) error {
+		batch := &proto.ViewTrackBatchRequest{}
+		if err := batch.Unmarshal(payload); err != nil {
+			return err
+		}
+
+		kept := batch.Requests[:0]
+		for _, req := range batch.Requests {
+			if v := req.ViewTrack(); v.Tenant == tenant && v.ID == id {
+				removed++
+				continue
+			}
+
+			kept = append(kept, req)
+		}
+
+		// Drop the record of a batch left empty.
+		if len(kept) == 0 {
+			return nil
+		}
+
+		if len(kept) < len(batch.Requests) {
+			batch.Requests = kept
+
+			var err error
+			if payload, err = batch.Marshal(); err != nil {
+				return err
+			}
+		}
+
+		return writeRecord(gz, nanos, payload)
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	return removed, bucket.Put(ctx, key, buf.Bytes())
+}
+
+// writeRecord writes the archive time in nanoseconds and the payload, both length prefixed.
+func writeRecord(w io.Writer, nanos uint64, payload []byte) error {
+	var header [2 * binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(header[:], nanos)
+	n += binary.PutUvarint(header[n:], uint64(len(payload)))
+
+	if _, err := w.Write(header[:n]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+
+	return err
+}
+
+// readSegment calls fn with the archive time and the payload of each record of the segment.
+func readSegment(ctx context.Context, bucket Bucket, key string, fn func(nanos uint64, payload []byte) error) error {
+	rc, err := bucket.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(gz)
+
+	for {
+		nanos, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		if err := fn(nanos, payload); err != nil {
+			return err
+		}
+	}
+}
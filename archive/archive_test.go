@@ -0,0 +1,224 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func payload(t *testing.T, ids ...string) []byte {
+	batch := &proto.ViewTrackBatchRequest{}
+	for _, id := range ids {
+		batch.Requests = append(batch.Requests, &proto.ViewTrackRequest{Id: []byte(id), Tenant: "acme"})
+	}
+
+	data, err := batch.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestArchiveReplay(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewDir(t.TempDir())
+
+	now := time.Date(2020, 9, 14, 10, 59, 0, 0, time.UTC)
+
+	a := NewArchiver(bucket)
+	a.now = func() time.Time { return now }
+
+	assert.NoError(t, a.Archive(ctx, payload(t, "1", "2")))
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, a.Archive(ctx, payload(t, "3")))
+
+	// The next hour starts a new segment.
+	now = now.Add(time.Minute)
+	assert.NoError(t, a.Archive(ctx, payload(t, "4")))
+
+	assert.Equal(t, 0, a.Flush(ctx))
+
+	keys, err := bucket.List(ctx, "2020/09/14/")
+	if assert.NoError(t, err) && assert.Len(t, keys, 2) {
+		assert.Regexp(t, `^2020/09/14/10/1600081140000000000-[0-9a-f]{8}\.gz$`, keys[0])
+		assert.Regexp(t, `^2020/09/14/11/1600081230000000000-[0-9a-f]{8}\.gz$`, keys[1])
+	}
+
+	var ids []string
+
+	replay := func(from, to time.Time) error {
+		ids = nil
+
+		return Replay(ctx, bucket, from, to, func(batch *proto.ViewTrackBatchRequest) error {
+			for _, req := range batch.Requests {
+				ids = append(ids, string(req.Id))
+			}
+
+			return nil
+		})
+	}
+
+	start := time.Date(2020, 9, 14, 10, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, replay(start, start.Add(2*time.Hour)))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ids)
+
+	// The records of a segment are filtered by their archive time.
+	assert.NoError(t, replay(start.Add(59*time.Minute+10*time.Second), start.Add(time.Hour)))
+	assert.Equal(t, []string{"3"}, ids)
+
+	assert.NoError(t, replay(start.Add(-time.Hour), start))
+	assert.Empty(t, ids)
+}
+
+// failingBucket fails the first puts.
+type failingBucket struct {
+	*Dir
+	failures int
+}
+
+func (b *failingBucket) Put(ctx context.Context, key string, data []byte) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("bucket is down")
+	}
+
+	return b.Dir.Put(ctx, key, data)
+}
+
+func TestArchiveFlushRetry(t *testing.T) {
+	ctx := context.Background()
+	bucket := &failingBucket{Dir: NewDir(t.TempDir()), failures: 1}
+
+	a := NewArchiver(bucket)
+
+	assert.NoError(t, a.Archive(ctx, payload(t, "1")))
+	assert.Equal(t, 1, a.Flush(ctx))
+
+	assert.NoError(t, a.Archive(ctx, payload(t, "2")))
+	assert.Equal(t, 0, a.Flush(ctx))
+
+	keys, err := bucket.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	rc, err := bucket.Get(ctx, keys[0])
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+
+		assert.NotEmpty(t, data)
+	}
+
+	// Nothing to flush.
+	assert.Equal(t, 0, a.Flush(ctx))
+
+	keys, err = bucket.List(ctx, "2021/")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestErase(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewDir(t.TempDir())
+
+	now := time.Date(2020, 9, 14, 10, 0, 0, 0, time.UTC)
+
+	a := NewArchiver(bucket)
+	a.now = func() time.Time { return now }
+
+	other := &proto.ViewTrackBatchRequest{Requests: []*proto.ViewTrackRequest{{Id: []byte("1"), Tenant: "globex"}}}
+	otherPayload, _ := other.Marshal()
+
+	assert.NoError(t, a.Archive(ctx, payload(t, "1", "2")))
+	assert.NoError(t, a.Archive(ctx, payload(t, "1")))
+	assert.NoError(t, a.Archive(ctx, otherPayload))
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, a.Archive(ctx, payload(t, "2")))
+
+	assert.Equal(t, 0, a.Flush(ctx))
+
+	lock := filter.NewMemoryMarker()
+
+	n, err := Erase(ctx, bucket, lock, "acme", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	var views []string
+
+	err = Replay(ctx, bucket, now.Add(-time.Hour), now.Add(time.Hour), func(batch *proto.ViewTrackBatchRequest) error {
+		for _, req := range batch.Requests {
+			views = append(views, req.Tenant+"/"+string(req.Id))
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme/2", "globex/1", "acme/2"}, views)
+
+	// Nothing left to erase.
+	n, err = Erase(ctx, bucket, lock, "acme", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestEraseConcurrently(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewDir(t.TempDir())
+
+	a := NewArchiver(bucket)
+	assert.NoError(t, a.Archive(ctx, payload(t, "1", "2", "3")))
+	assert.Equal(t, 0, a.Flush(ctx))
+
+	lock := filter.NewMemoryMarker()
+
+	// The erasures rewrite the same segment, neither brings back the views erased by the other.
+	var wg sync.WaitGroup
+
+	for _, id := range []string{"1", "2"} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			n, err := Erase(ctx, bucket, lock, "acme", id)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+		}()
+	}
+
+	wg.Wait()
+
+	var views []string
+
+	err := Replay(ctx, bucket, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(batch *proto.ViewTrackBatchRequest) error {
+		for _, req := range batch.Requests {
+			views = append(views, string(req.Id))
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, views)
+
+	// An erasure waits for the one in progress.
+	locked, _ := lock.Mark(ctx, eraseLockKey, time.Minute)
+	assert.True(t, locked)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = Erase(ctx, bucket, lock, "acme", "3")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
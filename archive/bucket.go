@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Bucket stores the segments of the archive, e.g. a local directory or a blob store.
+// The keys are slash separated paths.
+type Bucket interface {
+	// Put stores the data at the key, replacing it if it exists. A reader never sees a partial object.
+	Put(ctx context.Context, key string, data []byte) error
+
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// List returns the keys starting with the prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+var _ Bucket = (*Dir)(nil)
+
+// Dir stores the segments as files in a local directory.
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+func (d *Dir) Put(ctx context.Context, key string, data []byte) error {
+	name := filepath.Join(d.root, filepath.FromSlash(key))
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write a temporary file, renamed once complete.
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (d *Dir) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.root, filepath.FromSlash(key)))
+}
+
+func (d *Dir) List(ctx context.Context, prefix string) ([]string, error) {
+	// Walk the deepest directory of the prefix.
+	dir := path.Dir(prefix + "x")
+
+	var keys []string
+
+	err := filepath.WalkDir(filepath.Join(d.root, filepath.FromSlash(dir)), func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.root, name)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
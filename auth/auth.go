@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/httperror"
+
+	"github.com/pkg/errors"
+)
+
+// Scope is a permission granted to a key.
+type Scope string
+
+const (
+	// ScopeWrite allows to track views.
+	ScopeWrite Scope = "write"
+	// ScopeRead allows to retrieve counts.
+	ScopeRead Scope = "read"
+	// ScopeDelete allows to delete the views of an ID.
+	ScopeDelete Scope = "delete"
+)
+
+// Request headers.
+const (
+	// HeaderAPIKey carries the API key, formatted as <key id>.<secret>.
+	HeaderAPIKey = "X-API-Key"
+
+	// HMAC signed requests carry the key ID, the unix timestamp in seconds, and the hex encoded HMAC-SHA256 signature.
+	// Refer to Sign.
+	HeaderKeyID     = "X-Key-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// Key is an API key. Each key belongs to a tenant, and is granted a set of scopes.
+type Key struct {
+	ID     string  `json:"id" yaml:"id" toml:"id"`
+	Secret string  `json:"secret" yaml:"secret" toml:"secret"`
+	Tenant string  `json:"tenant" yaml:"tenant" toml:"tenant"`
+	Scopes []Scope `json:"scopes" yaml:"scopes" toml:"scopes"`
+}
+
+// HasScope returns true if the key is granted the scope.
+func (k *Key) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyStore looks up the keys by ID.
+type KeyStore interface {
+	// Get returns ErrKeyNotFound if there's no key with the ID.
+	Get(ctx context.Context, id string) (*Key, error)
+}
+
+type contextKey struct{}
+
+// WithKey returns a copy of ctx carrying the authenticated key.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFromContext returns the authenticated key, or nil if the request is not authenticated.
+func KeyFromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(contextKey{}).(*Key)
+	return key
+}
+
+// TenantFromContext returns the tenant of the authenticated key, or empty if the request is not authenticated.
+func TenantFromContext(ctx context.Context) string {
+	if key := KeyFromContext(ctx); key != nil {
+		return key.Tenant
+	}
+
+	return ""
+}
+
+// Authenticator authenticates the requests, using either an API key or a HMAC signature.
+type Authenticator struct {
+	keys    KeyStore
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+type Option func(*Authenticator)
+
+// WithMaxSkew sets the maximum difference between the signed timestamp and the server time. Default is 5 minutes.
+func WithMaxSkew(maxSkew time.Duration) func(*Authenticator) {
+	return func(a *Authenticator) {
+		a.maxSkew = maxSkew
+	}
+}
+
+func NewAuthenticator(keys KeyStore, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		keys:    keys,
+		maxSkew: 5 * time.Minute,
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// errUnauthorized is returned for every authentication failure, so the response doesn't reveal which part failed.
+var errUnauthorized = errors.New("unauthorized")
+
+// MaxSignedBody limits the body read to check a signature, the max body of the API, a Bulk Track request.
+// The key ID is checked first, but it is not a secret: the body is read before the signature is checked.
+const MaxSignedBody = 4 << 20
+
+var errBodyTooLarge = errors.Errorf("request body too large, the maximum is %d bytes", MaxSignedBody)
+
+// IsUnauthorized returns true if the error is an authentication failure, and not e.g. a key store failure.
+func IsUnauthorized(err error) bool {
+	return err == errUnauthorized
+}
+
+// Authenticate returns the key of the request.
+func (a *Authenticator) Authenticate(r *http.Request) (*Key, error) {
+	if apiKey := r.Header.Get(HeaderAPIKey); apiKey != "" {
+		return a.AuthenticateAPIKey(r.Context(), apiKey)
+	}
+
+	if r.Header.Get(HeaderSignature) != "" {
+		return a.authenticateSignature(r)
+	}
+
+	return nil, errUnauthorized
+}
+
+// AuthenticateAPIKey returns the key of the API key, formatted as <key id>.<secret>.
+func (a *Authenticator) AuthenticateAPIKey(ctx context.Context, apiKey string) (*Key, error) {
+	i := strings.IndexByte(apiKey, '.')
+	if i <= 0 {
+		return nil, errUnauthorized
+	}
+
+	key, err := a.getKey(ctx, apiKey[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Secret), []byte(apiKey[i+1:])) != 1 {
+		return nil, errUnauthorized
+	}
+
+	return key, nil
+}
+
+func (a *Authenticator) authenticateSignature(r *http.Request) (*Key, error) {
+	sig, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	// Reject old signatures, to limit replays.
+	if skew := a.now().Sub(time.Unix(timestamp, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, errUnauthorized
+	}
+
+	key, err := a.getKey(r.Context(), r.Header.Get(HeaderKeyID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the body to sign it, then restore it for the handler.
+	var body []byte
+
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, MaxSignedBody))
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errBodyTooLarge
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read body")
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := signature(key.Secret, r.Method, r.URL.RequestURI(), timestamp, body)
+
+	if !hmac.Equal(sig, expected) {
+		return nil, errUnauthorized
+	}
+
+	return key, nil
+}
+
+func (a *Authenticator) getKey(ctx context.Context, id string) (*Key, error) {
+	if id == "" {
+		return nil, errUnauthorized
+	}
+
+	key, err := a.keys.Get(ctx, id)
+	if err == ErrKeyNotFound {
+		return nil, errUnauthorized
+	}
+
+	return key, err
+}
+
+// Middleware authenticates every request, and adds the key into the request context.
+// It responds with 401 Unauthorized if the authentication fails.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := a.Authenticate(r)
+		if err == errUnauthorized {
+			httperror.Render(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if err == errBodyTooLarge {
+			httperror.Render(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		if err != nil {
+			httperror.Render(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithKey(r.Context(), key)))
+	})
+}
+
+// AnonymousKey returns the key given to every request when authentication is disabled, with every scope.
+func AnonymousKey(tenant string) *Key {
+	return &Key{
+		ID:     "anonymous",
+		Tenant: tenant,
+		Scopes: []Scope{ScopeWrite, ScopeRead, ScopeDelete},
+	}
+}
+
+// Anonymous is the middleware used when authentication is disabled.
+// Every request is given the AnonymousKey of the tenant.
+func Anonymous(tenant string) func(http.Handler) http.Handler {
+	key := AnonymousKey(tenant)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithKey(r.Context(), key)))
+		})
+	}
+}
+
+// Require responds with 403 Forbidden if the key of the request is not granted the scope,
+// or 401 Unauthorized if the request is not authenticated.
+func Require(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := KeyFromContext(r.Context())
+			if key == nil {
+				httperror.Render(w, http.StatusUnauthorized, errUnauthorized.Error())
+				return
+			}
+
+			if !key.HasScope(scope) {
+				httperror.Render(w, http.StatusForbidden, "key is not granted the "+string(scope)+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Sign returns the HMAC-SHA256 signature of the request, hex encoded, for the X-Signature header.
+// The signed message is the method, the request URI, the timestamp and the body, separated by new lines.
+func Sign(secret, method, requestURI string, timestamp int64, body []byte) string {
+	return hex.EncodeToString(signature(secret, method, requestURI, timestamp, body))
+}
+
+func signature(secret, method, requestURI string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + strconv.FormatInt(timestamp, 10) + "\n"))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKeys = NewMemoryKeyStore([]Key{
+	{ID: "sdk", Secret: "s3cret", Tenant: "acme", Scopes: []Scope{ScopeWrite}},
+})
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	a := NewAuthenticator(testKeys)
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantErr bool
+	}{
+		{name: "valid", apiKey: "sdk.s3cret"},
+		{name: "no key", apiKey: "", wantErr: true},
+		{name: "no secret", apiKey: "sdk", wantErr: true},
+		{name: "wrong secret", apiKey: "sdk.secret", wantErr: true},
+		{name: "unknown id", apiKey: "web.s3cret", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/analytics", nil)
+			r.Header.Set(HeaderAPIKey, tc.apiKey)
+
+			key, err := a.Authenticate(r)
+			if tc.wantErr {
+				assert.Equal(t, errUnauthorized, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, "acme", key.Tenant)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	a := NewAuthenticator(testKeys, WithMaxSkew(time.Minute))
+	a.now = func() time.Time { return now }
+
+	body := []byte(`{"id":"1"}`)
+
+	newRequest := func(secret string, timestamp time.Time, signedBody []byte) *http.Request {
+		r := httptest.NewRequest("POST", "/analytics?x=1", bytes.NewReader(body))
+		r.Header.Set(HeaderKeyID, "sdk")
+		r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		r.Header.Set(HeaderSignature, Sign(secret, "POST", "/analytics?x=1", timestamp.Unix(), signedBody))
+
+		return r
+	}
+
+	r := newRequest("s3cret", now.Add(-30*time.Second), body)
+
+	key, err := a.Authenticate(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sdk", key.ID)
+	}
+
+	// The body is still readable by the handler.
+	read, err := ioutil.ReadAll(r.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, read)
+
+	_, err = a.Authenticate(newRequest("wrong", now, body))
+	assert.Equal(t, errUnauthorized, err, "wrong secret")
+
+	_, err = a.Authenticate(newRequest("s3cret", now, []byte(`{"id":"2"}`)))
+	assert.Equal(t, errUnauthorized, err, "tampered body")
+
+	_, err = a.Authenticate(newRequest("s3cret", now.Add(-2*time.Minute), body))
+	assert.Equal(t, errUnauthorized, err, "expired timestamp")
+
+	// A known key ID is enough to send a body, it is not read past the limit.
+	large := bytes.Repeat([]byte(" "), MaxSignedBody+1)
+
+	r = httptest.NewRequest("POST", "/analytics?x=1", bytes.NewReader(large))
+	r.Header.Set(HeaderKeyID, "sdk")
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	r.Header.Set(HeaderSignature, Sign("s3cret", "POST", "/analytics?x=1", now.Unix(), large))
+
+	w := httptest.NewRecorder()
+	a.Middleware(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestMiddleware(t *testing.T) {
+	var tenant string
+
+	handler := NewAuthenticator(testKeys).Middleware(Require(ScopeWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = TenantFromContext(r.Context())
+	})))
+
+	serve := func(apiKey string) int {
+		r := httptest.NewRequest("POST", "/analytics", nil)
+		if apiKey != "" {
+			r.Header.Set(HeaderAPIKey, apiKey)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+	assert.Equal(t, http.StatusOK, serve("sdk.s3cret"))
+	assert.Equal(t, "acme", tenant)
+
+	// Scope not granted
+	handler = Anonymous("default")(Require(ScopeRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = TenantFromContext(r.Context())
+	})))
+
+	assert.Equal(t, http.StatusOK, serve(""))
+	assert.Equal(t, "default", tenant)
+
+	handler = NewAuthenticator(testKeys).Middleware(Require(ScopeRead)(http.NotFoundHandler()))
+	assert.Equal(t, http.StatusForbidden, serve("sdk.s3cret"))
+}
+
+func TestChainKeyStore(t *testing.T) {
+	other := NewMemoryKeyStore([]Key{
+		{ID: "web", Secret: "secret", Tenant: "globex", Scopes: []Scope{ScopeRead}},
+	})
+
+	chain := ChainKeyStore{testKeys, other}
+
+	key, err := chain.Get(context.Background(), "web")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "globex", key.Tenant)
+	}
+
+	_, err = chain.Get(context.Background(), "mobile")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
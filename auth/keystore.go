@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+var _ KeyStore = (*MemoryKeyStore)(nil)
+var _ KeyStore = (*RedisKeyStore)(nil)
+var _ KeyStore = (ChainKeyStore)(nil)
+
+// MemoryKeyStore holds a fixed set of keys, e.g. loaded from the config.
+type MemoryKeyStore struct {
+	keys map[string]*Key
+}
+
+func NewMemoryKeyStore(keys []Key) *MemoryKeyStore {
+	s := &MemoryKeyStore{
+		keys: make(map[string]*Key, len(keys)),
+	}
+
+	for i := range keys {
+		key := keys[i]
+		s.keys[key.ID] = &key
+	}
+
+	return s
+}
+
+func (s *MemoryKeyStore) Get(ctx context.Context, id string) (*Key, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// RedisKeyStore reads the keys from Redis hashes, so keys can be added and revoked without a restart.
+//
+// Each key is stored in the hash <prefix><id>, with the fields secret, tenant and scopes (comma separated), e.g.
+//
+//	HSET apikey:mobile secret s3cret tenant acme scopes write,read
+type RedisKeyStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisKeyStore(client *redis.Client, prefix string) *RedisKeyStore {
+	return &RedisKeyStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisKeyStore) Get(ctx context.Context, id string) (*Key, error) {
+	fields, err := s.client.HGetAllMap(s.prefix + id).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "redis key store")
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	key := &Key{
+		ID:     id,
+		Secret: fields["secret"],
+		Tenant: fields["tenant"],
+	}
+
+	for _, scope := range strings.Split(fields["scopes"], ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			key.Scopes = append(key.Scopes, Scope(scope))
+		}
+	}
+
+	// An incomplete key is never valid.
+	if key.Secret == "" || key.Tenant == "" {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// ChainKeyStore looks up the key in each store, in order, until it's found.
+type ChainKeyStore []KeyStore
+
+func (c ChainKeyStore) Get(ctx context.Context, id string) (*Key, error) {
+	for _, s := range c {
+		key, err := s.Get(ctx, id)
+		if err != ErrKeyNotFound {
+			return key, err
+		}
+	}
+
+	return nil, ErrKeyNotFound
+}
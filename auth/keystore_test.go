@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+func TestRedisKeyStore(t *testing.T) {
+	s, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	s.HSet("apikey:mobile", "secret", "s3cret", "tenant", "acme", "scopes", "write, read")
+	s.HSet("apikey:broken", "secret", "s3cret")
+
+	keys := NewRedisKeyStore(client, "apikey:")
+
+	key, err := keys.Get(context.Background(), "mobile")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Key{
+			ID:     "mobile",
+			Secret: "s3cret",
+			Tenant: "acme",
+			Scopes: []Scope{ScopeWrite, ScopeRead},
+		}, key)
+	}
+
+	_, err = keys.Get(context.Background(), "unknown")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = keys.Get(context.Background(), "broken")
+	assert.Equal(t, ErrKeyNotFound, err, "key without tenant")
+}
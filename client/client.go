@@ -0,0 +1,370 @@
+// Package client is the Go client of the analytics API, using the HTTP API or the gRPC API.
+package client
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum number of hits sent in a BatchTrack call, the limit of the server.
+const maxBatchHits = 10000
+
+// ErrClosed is returned by the calls made after Close.
+var ErrClosed = errors.New("client is closed")
+
+// Client tracks and retrieves the hits, retrying the calls failed with a server error or rate limited,
+// with an exponential backoff.
+//
+// Track queues the hits, and sends them in batches in the background, like queue.ViewTrackerQueue does on the server.
+// The batch is sent when it has batchSize hits, or every batchInterval. The batches are sent one at a time, in order.
+// A batch failed after the retries is dropped and logged. Close sends the queued hits before returning.
+type Client struct {
+	transport Transport
+	logger    *slog.Logger
+
+	batchSize     int
+	batchInterval time.Duration
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	queue chan Hit
+	flush chan chan struct{}
+	done  chan struct{}
+
+	// ctx is the context of the background batches, canceled if Close times out.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type Option func(*Client)
+
+// Default batch size is 256.
+func WithBatchSize(batchSize int) func(*Client) {
+	return func(c *Client) {
+		c.batchSize = batchSize
+	}
+}
+
+// Default batch interval is 1 second.
+func WithBatchInterval(batchInterval time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.batchInterval = batchInterval
+	}
+}
+
+// WithRetries sets the maximum number of retries of a call. Default is 3.
+func WithRetries(retries int) func(*Client) {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled for each retry up to max. Default is 100ms up to 5s.
+// The delay is randomized between half and all of it, and is at least the Retry-After of the server.
+func WithBackoff(min, max time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// The logger is used to log the dropped batches, and can be nil.
+func WithLogger(logger *slog.Logger) func(*Client) {
+	return func(c *Client) {
+		c.logger = logging.OrDiscard(logger)
+	}
+}
+
+// New creates the client, and starts sending the batches in the background. Close must be called to send the queued hits.
+func New(transport Transport, opts ...Option) *Client {
+	c := &Client{
+		transport:     transport,
+		logger:        logging.OrDiscard(nil),
+		batchSize:     256,
+		batchInterval: time.Second,
+		retries:       3,
+		minBackoff:    100 * time.Millisecond,
+		maxBackoff:    5 * time.Second,
+		flush:         make(chan chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.batchSize > maxBatchHits {
+		c.batchSize = maxBatchHits
+	}
+
+	c.queue = make(chan Hit, c.batchSize)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	go c.run()
+
+	return c
+}
+
+// Track queues the hit, blocking while the queue is full. The zero timestamp is set to now,
+// so the hit is counted at the time it is tracked, not the time it is sent.
+func (c *Client) Track(ctx context.Context, hit Hit) error {
+	if hit.ID == "" {
+		return errors.New("id is empty")
+	}
+
+	if hit.Timestamp.IsZero() {
+		hit.Timestamp = time.Now()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	select {
+	case c.queue <- hit:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BatchTrack sends the hits now, in batches of up to 10000 hits. The rejected hits have their index in hits.
+func (c *Client) BatchTrack(ctx context.Context, hits []Hit) (BatchResult, error) {
+	var res BatchResult
+
+	for offset := 0; offset < len(hits); offset += maxBatchHits {
+		end := offset + maxBatchHits
+		if end > len(hits) {
+			end = len(hits)
+		}
+
+		batch, err := c.batchTrack(ctx, hits[offset:end])
+		if err != nil {
+			return res, err
+		}
+
+		res.add(batch, offset)
+	}
+
+	return res, nil
+}
+
+func (c *Client) batchTrack(ctx context.Context, hits []Hit) (BatchResult, error) {
+	var res BatchResult
+
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = c.transport.BatchTrack(ctx, hits)
+
+		return err
+	})
+
+	return res, err
+}
+
+// Retrieve returns the hit counts of the ID.
+func (c *Client) Retrieve(ctx context.Context, id string) ([]store.ViewCount, error) {
+	var counts []store.ViewCount
+
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		counts, err = c.transport.Retrieve(ctx, id)
+
+		return err
+	})
+
+	return counts, err
+}
+
+// Flush sends the queued hits, and waits until they are sent or dropped.
+func (c *Client) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	c.mu.RLock()
+
+	if c.closed {
+		c.mu.RUnlock()
+		return ErrClosed
+	}
+
+	select {
+	case c.flush <- done:
+	case <-ctx.Done():
+		c.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	c.mu.RUnlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends the queued hits, and stops the client. If the context is done first, the remaining hits are dropped.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	close(c.queue)
+
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		c.cancel()
+		return nil
+	case <-ctx.Done():
+		c.cancel()
+		<-c.done
+		return ctx.Err()
+	}
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.batchInterval)
+	defer ticker.Stop()
+
+	buf := make([]Hit, 0, c.batchSize)
+
+	send := func() {
+		if len(buf) > 0 {
+			c.send(buf)
+			buf = buf[:0]
+		}
+	}
+
+	for {
+		select {
+		case hit, ok := <-c.queue:
+			// The client has been closed
+			if !ok {
+				send()
+				return
+			}
+
+			buf = append(buf, hit)
+
+			if len(buf) == c.batchSize {
+				send()
+			}
+
+		case <-ticker.C:
+			send()
+
+		case done := <-c.flush:
+			// Take the hits queued before the flush.
+		Drain:
+			for {
+				select {
+				case hit, ok := <-c.queue:
+					if !ok {
+						send()
+						close(done)
+						return
+					}
+
+					buf = append(buf, hit)
+
+					if len(buf) == c.batchSize {
+						send()
+					}
+				default:
+					break Drain
+				}
+			}
+
+			send()
+			close(done)
+		}
+	}
+}
+
+// send sends a batch of the queued hits, logging it if it is dropped.
+func (c *Client) send(hits []Hit) {
+	res, err := c.batchTrack(c.ctx, hits)
+	if err != nil {
+		c.logger.Error("client batch dropped", slog.Int("batch_size", len(hits)), logging.Error(err))
+		return
+	}
+
+	if res.Rejected > 0 {
+		c.logger.Warn("client batch rejected hits",
+			slog.Int("batch_size", len(hits)),
+			slog.Int("rejected", res.Rejected),
+			slog.String("error", res.Errors[0].Message))
+	}
+}
+
+// retry calls the function until it succeeds, fails with a permanent error, or the retries are exhausted.
+func (c *Client) retry(ctx context.Context, call func(ctx context.Context) error) error {
+	for retry := 0; ; retry++ {
+		err := call(ctx)
+		if err == nil || retry == c.retries || !temporary(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(c.backoff(retry, err))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func (c *Client) backoff(retry int, err error) time.Duration {
+	backoff := c.maxBackoff
+	if retry < 32 && c.minBackoff<<uint(retry) < c.maxBackoff {
+		backoff = c.minBackoff << uint(retry)
+	}
+
+	if backoff > 1 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > backoff {
+		backoff = statusErr.RetryAfter
+	}
+
+	return backoff
+}
+
+// temporary returns true if the call can be retried, i.e. a server error, too many requests, or a network error.
+func temporary(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,262 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/api"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/grpcapi"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// recorder is a view store recording the tracked views.
+type recorder struct {
+	mu    sync.Mutex
+	views []store.ViewTrack
+	calls int
+}
+
+func (r *recorder) tracker() *mock.ViewTracker {
+	return &mock.ViewTracker{
+		OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+			return r.record(v)
+		},
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			return r.record(vs...)
+		},
+	}
+}
+
+func (r *recorder) record(vs ...store.ViewTrack) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.views = append(r.views, vs...)
+	r.calls++
+
+	return nil
+}
+
+func (r *recorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.views))
+	for _, v := range r.views {
+		ids = append(ids, v.ID)
+	}
+
+	return ids
+}
+
+var retriever = &mock.ViewRetriever{
+	OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+		return []store.ViewCount{{Description: "5 minutes ago", Count: 2}}, nil
+	},
+}
+
+func newHTTPServer(t *testing.T, r *recorder) *httptest.Server {
+	srv := httptest.NewServer(auth.Anonymous(store.DefaultTenant)(api.NewHandler(r.tracker(), retriever, nil)))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newGRPCTransport(t *testing.T, r *recorder) *GRPCTransport {
+	lis := bufconn.Listen(1 << 20)
+
+	srv := grpcapi.NewServer(r.tracker(), retriever, grpcapi.Anonymous(store.DefaultTenant), nil).GRPCServer()
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+
+	return NewGRPCTransport(conn, "")
+}
+
+func TestTransports(t *testing.T) {
+	httpRecorder, grpcRecorder := &recorder{}, &recorder{}
+
+	transports := map[string]struct {
+		transport Transport
+		recorder  *recorder
+	}{
+		"http": {NewHTTPTransport(newHTTPServer(t, httpRecorder).URL), httpRecorder},
+		"grpc": {newGRPCTransport(t, grpcRecorder), grpcRecorder},
+	}
+
+	timestamp := time.Now().Add(-time.Hour).Round(time.Millisecond)
+
+	for name, tc := range transports {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			assert.NoError(t, tc.transport.Track(ctx, Hit{ID: "1", Timestamp: timestamp}))
+
+			res, err := tc.transport.BatchTrack(ctx, []Hit{{ID: "2"}, {ID: ""}, {ID: "3"}})
+			if assert.NoError(t, err) {
+				assert.Equal(t, 2, res.Accepted)
+				assert.Equal(t, 1, res.Rejected)
+				if assert.Len(t, res.Errors, 1) {
+					assert.Equal(t, 1, res.Errors[0].Index)
+				}
+			}
+
+			_, err = tc.transport.BatchTrack(ctx, nil)
+			if assert.IsType(t, &StatusError{}, err) {
+				assert.Equal(t, http.StatusBadRequest, err.(*StatusError).Code)
+			}
+
+			counts, err := tc.transport.Retrieve(ctx, "1")
+			if assert.NoError(t, err) {
+				assert.Equal(t, []store.ViewCount{{Description: "5 minutes ago", Count: 2}}, counts)
+			}
+
+			assert.Equal(t, []string{"1", "2", "3"}, tc.recorder.ids())
+			assert.True(t, timestamp.Equal(tc.recorder.views[0].Timestamp))
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	r := &recorder{}
+
+	chain := filter.NewChain(filter.NewMemoryCounter(), nil, filter.Bot(filter.DefaultBotUserAgents))
+
+	srv := httptest.NewServer(auth.Anonymous(store.DefaultTenant)(api.NewHandler(r.tracker(), retriever, nil, api.WithFilters(chain))))
+	defer srv.Close()
+
+	// The hits of the client are not discarded as bots.
+	assert.NoError(t, NewHTTPTransport(srv.URL).Track(context.Background(), Hit{ID: "1"}))
+	assert.NoError(t, NewHTTPTransport(srv.URL, WithUserAgent("Googlebot/2.1")).Track(context.Background(), Hit{ID: "2"}))
+
+	assert.Equal(t, []string{"1"}, r.ids())
+}
+
+func TestBatching(t *testing.T) {
+	r := &recorder{}
+
+	c := New(NewHTTPTransport(newHTTPServer(t, r).URL), WithBatchSize(2), WithBatchInterval(time.Hour))
+
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2", "3"} {
+		assert.NoError(t, c.Track(ctx, Hit{ID: id}))
+	}
+
+	assert.Error(t, c.Track(ctx, Hit{}))
+
+	assert.NoError(t, c.Flush(ctx))
+	assert.Equal(t, []string{"1", "2", "3"}, r.ids())
+	assert.Equal(t, 2, r.calls)
+
+	assert.NoError(t, c.Track(ctx, Hit{ID: "4"}))
+	assert.NoError(t, c.Close(ctx))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, r.ids())
+
+	// Every hit has the time it was tracked.
+	for _, v := range r.views {
+		assert.WithinDuration(t, time.Now(), v.Timestamp, time.Minute)
+	}
+
+	assert.Equal(t, ErrClosed, c.Track(ctx, Hit{ID: "5"}))
+	assert.Equal(t, ErrClosed, c.Flush(ctx))
+	assert.NoError(t, c.Close(ctx))
+}
+
+func TestRetry(t *testing.T) {
+	r := &recorder{}
+	handler := auth.Anonymous(store.DefaultTenant)(api.NewHandler(r.tracker(), retriever, nil))
+
+	var mu sync.Mutex
+	var responses []int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(responses) > 0 {
+			status := responses[0]
+			responses = responses[1:]
+
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "", status)
+
+			return
+		}
+
+		handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	respond := func(statuses ...int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		responses = statuses
+	}
+
+	c := New(NewHTTPTransport(srv.URL), WithRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+	defer c.Close(context.Background())
+
+	ctx := context.Background()
+
+	respond(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	counts, err := c.Retrieve(ctx, "1")
+	assert.NoError(t, err)
+	assert.Len(t, counts, 1)
+
+	respond(http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	_, err = c.BatchTrack(ctx, []Hit{{ID: "1"}})
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*StatusError).Code)
+	}
+
+	// The client errors are not retried.
+	respond(http.StatusBadRequest, http.StatusServiceUnavailable)
+
+	_, err = c.BatchTrack(ctx, []Hit{{ID: "1"}})
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*StatusError).Code)
+	}
+
+	assert.Empty(t, r.ids())
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		backoff := c.backoff(retry, nil)
+		assert.True(t, backoff >= want/2 && backoff <= want, "retry %d: %s", retry, backoff)
+	}
+
+	backoff := c.backoff(0, &StatusError{Code: http.StatusTooManyRequests, RetryAfter: 3 * time.Second})
+	assert.Equal(t, 3*time.Second, backoff)
+}
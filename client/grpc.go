@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var _ Transport = (*GRPCTransport)(nil)
+
+// GRPCTransport sends the calls to the gRPC ViewService.
+type GRPCTransport struct {
+	client proto.ViewServiceClient
+	apiKey string
+}
+
+// NewGRPCTransport creates the transport using the connection, e.g. from grpc.Dial. The API key can be empty
+// if the authentication is disabled. The messages use proto.Codec, so the connection needs no codec option.
+func NewGRPCTransport(conn *grpc.ClientConn, apiKey string) *GRPCTransport {
+	return &GRPCTransport{
+		client: proto.NewViewServiceClient(conn),
+		apiKey: apiKey,
+	}
+}
+
+func (t *GRPCTransport) Track(ctx context.Context, hit Hit) error {
+	_, err := t.client.Track(t.context(ctx), trackRequest(hit), grpc.ForceCodec(proto.Codec{}))
+
+	return grpcError(err)
+}
+
+func (t *GRPCTransport) BatchTrack(ctx context.Context, hits []Hit) (BatchResult, error) {
+	req := &proto.BatchTrackRequest{Hits: make([]*proto.TrackRequest, 0, len(hits))}
+	for _, hit := range hits {
+		req.Hits = append(req.Hits, trackRequest(hit))
+	}
+
+	res, err := t.client.BatchTrack(t.context(ctx), req, grpc.ForceCodec(proto.Codec{}))
+	if err != nil {
+		return BatchResult{}, grpcError(err)
+	}
+
+	result := BatchResult{
+		Accepted:  int(res.Accepted),
+		Discarded: int(res.Discarded),
+		Rejected:  int(res.Rejected),
+	}
+
+	for _, e := range res.Errors {
+		result.Errors = append(result.Errors, HitError{Index: int(e.Index), Message: e.Message})
+	}
+
+	return result, nil
+}
+
+func (t *GRPCTransport) Retrieve(ctx context.Context, id string) ([]store.ViewCount, error) {
+	res, err := t.client.Retrieve(t.context(ctx), &proto.RetrieveRequest{Id: id}, grpc.ForceCodec(proto.Codec{}))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	counts := make([]store.ViewCount, 0, len(res.Counts))
+	for _, count := range res.Counts {
+		counts = append(counts, store.ViewCount{Description: count.Reference, Count: count.Count})
+	}
+
+	return counts, nil
+}
+
+// context returns the context with the API key metadata.
+func (t *GRPCTransport) context(ctx context.Context) context.Context {
+	if t.apiKey == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", t.apiKey)
+}
+
+func trackRequest(hit Hit) *proto.TrackRequest {
+	req := &proto.TrackRequest{Id: hit.ID}
+	if !hit.Timestamp.IsZero() {
+		req.Timestamp = hit.Timestamp.UnixNano()
+	}
+
+	return req
+}
+
+// httpStatus are the HTTP status equivalent to the gRPC codes returned by the server.
+var httpStatus = map[codes.Code]int{
+	codes.InvalidArgument:   http.StatusBadRequest,
+	codes.Unauthenticated:   http.StatusUnauthorized,
+	codes.PermissionDenied:  http.StatusForbidden,
+	codes.NotFound:          http.StatusNotFound,
+	codes.ResourceExhausted: http.StatusTooManyRequests,
+	codes.Unimplemented:     http.StatusNotImplemented,
+	codes.Internal:          http.StatusInternalServerError,
+	codes.Unknown:           http.StatusInternalServerError,
+	codes.Unavailable:       http.StatusServiceUnavailable,
+}
+
+// grpcError returns the error as a *StatusError, if its code has an HTTP equivalent.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	code, ok := httpStatus[s.Code()]
+	if !ok {
+		return err
+	}
+
+	return &StatusError{Code: code, Message: s.Message()}
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUserAgent is the User-Agent header of the requests, so they are not discarded by the bot filter
+// as the default Go-http-client user agent of a library.
+const DefaultUserAgent = "redis-elasticsearch-go-example-client"
+
+var _ Transport = (*HTTPTransport)(nil)
+
+// HTTPTransport sends the calls to the HTTP API, e.g. http://localhost:8001.
+type HTTPTransport struct {
+	baseURL    string
+	apiKey     string
+	userAgent  string
+	httpClient *http.Client
+}
+
+type HTTPOption func(*HTTPTransport)
+
+// WithAPIKey sends the API key, formatted as <key id>.<secret>, in the X-API-Key header.
+func WithAPIKey(apiKey string) func(*HTTPTransport) {
+	return func(t *HTTPTransport) {
+		t.apiKey = apiKey
+	}
+}
+
+// WithUserAgent sets the User-Agent header, e.g. the user agent of the visitor when tracking its hits from a backend.
+// Default is DefaultUserAgent.
+func WithUserAgent(userAgent string) func(*HTTPTransport) {
+	return func(t *HTTPTransport) {
+		t.userAgent = userAgent
+	}
+}
+
+// WithHTTPClient sets the HTTP client. Default has a timeout of 10 seconds.
+func WithHTTPClient(httpClient *http.Client) func(*HTTPTransport) {
+	return func(t *HTTPTransport) {
+		t.httpClient = httpClient
+	}
+}
+
+func NewHTTPTransport(baseURL string, opts ...HTTPOption) *HTTPTransport {
+	t := &HTTPTransport{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		userAgent:  DefaultUserAgent,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// hit is a hit of the Track and Bulk Track requests.
+type hit struct {
+	ID        string     `json:"id"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+func newHit(h Hit) hit {
+	req := hit{ID: h.ID}
+	if !h.Timestamp.IsZero() {
+		req.Timestamp = &h.Timestamp
+	}
+
+	return req
+}
+
+func (t *HTTPTransport) Track(ctx context.Context, h Hit) error {
+	body, err := json.Marshal(newHit(h))
+	if err != nil {
+		return err
+	}
+
+	return t.do(ctx, http.MethodPost, "/analytics", body, http.StatusNoContent, nil)
+}
+
+func (t *HTTPTransport) BatchTrack(ctx context.Context, hits []Hit) (BatchResult, error) {
+	req := make([]hit, 0, len(hits))
+	for _, h := range hits {
+		req = append(req, newHit(h))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	var res struct {
+		Accepted  int `json:"accepted"`
+		Discarded int `json:"discarded"`
+		Rejected  int `json:"rejected"`
+		Errors    []struct {
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	if err := t.do(ctx, http.MethodPost, "/analytics/_bulk", body, http.StatusOK, &res); err != nil {
+		return BatchResult{}, err
+	}
+
+	result := BatchResult{
+		Accepted:  res.Accepted,
+		Discarded: res.Discarded,
+		Rejected:  res.Rejected,
+	}
+
+	// The lines of the JSON array are 1-based.
+	for _, e := range res.Errors {
+		result.Errors = append(result.Errors, HitError{Index: e.Line - 1, Message: e.Message})
+	}
+
+	return result, nil
+}
+
+func (t *HTTPTransport) Retrieve(ctx context.Context, id string) ([]store.ViewCount, error) {
+	var res struct {
+		Counts []store.ViewCount `json:"counts"`
+	}
+
+	if err := t.do(ctx, http.MethodGet, "/analytics/"+url.PathEscape(id), nil, http.StatusOK, &res); err != nil {
+		return nil, err
+	}
+
+	return res.Counts, nil
+}
+
+// do sends the request, and decodes the response into v, if not nil.
+// The error is a *StatusError if the response status is not the expected status.
+func (t *HTTPTransport) do(ctx context.Context, method, path string, body []byte, status int, v interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", t.userAgent)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if t.apiKey != "" {
+		req.Header.Set("X-API-Key", t.apiKey)
+	}
+
+	res, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// Drain the body, so the connection is reused.
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode != status {
+		return statusError(res)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(v), "decode response")
+}
+
+func statusError(res *http.Response) error {
+	e := &StatusError{Code: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body); err == nil && body.Message != "" {
+		e.Message = body.Message
+	}
+
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return e
+}
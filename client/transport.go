@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+// Hit is a hit to track. The zero timestamp is the time the server receives it.
+type Hit struct {
+	ID        string
+	Timestamp time.Time
+}
+
+// HitError is the error of a rejected hit of a batch. Index is the 0-based index of the hit in the batch.
+type HitError struct {
+	Index   int
+	Message string
+}
+
+// BatchResult is the result of the hits of a batch.
+type BatchResult struct {
+	Accepted  int
+	Discarded int
+	Rejected  int
+	Errors    []HitError
+}
+
+func (r *BatchResult) add(other BatchResult, offset int) {
+	r.Accepted += other.Accepted
+	r.Discarded += other.Discarded
+	r.Rejected += other.Rejected
+
+	for _, e := range other.Errors {
+		r.Errors = append(r.Errors, HitError{Index: e.Index + offset, Message: e.Message})
+	}
+}
+
+// Transport sends the calls to the server, e.g. using the HTTP API or the gRPC API.
+// A transport does not retry, the Client does.
+type Transport interface {
+	Track(ctx context.Context, hit Hit) error
+	BatchTrack(ctx context.Context, hits []Hit) (BatchResult, error)
+	Retrieve(ctx context.Context, id string) ([]store.ViewCount, error)
+}
+
+// StatusError is the error of a call rejected by the server.
+// Code is the HTTP status code, or the equivalent of the gRPC code.
+type StatusError struct {
+	Code    int
+	Message string
+	// RetryAfter is the delay requested by the server, e.g. when rate limited.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Message)
+}
+
+// Temporary returns true if the call can be retried, i.e. a server error or too many requests.
+func (e *StatusError) Temporary() bool {
+	return e.Code >= 500 || e.Code == 429
+}
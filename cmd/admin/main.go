@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/archive"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/config"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/export"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/elastic"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/redis"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+// Admin runs the maintenance operations on the storage, one command per invocation:
+//
+//	admin [-config_file config.yaml] <command> [flags]
+
+// command is an admin command. The args are the arguments after the command name.
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "init",
+		usage: "Create the indices, the index template, the lifecycle policy and the aliases",
+		run:   initIndices,
+	},
+	{
+		name:  "status",
+		usage: "Print the document counts and the sizes of the indices",
+		run:   status,
+	},
+	{
+		name:  "migrate",
+		usage: "Migrate the mapping of the indices to the latest version",
+		run:   migrate,
+	},
+	{
+		name:  "reindex",
+		usage: "Reindex the views into new indices, with the current settings",
+		run:   reindex,
+	},
+	{
+		name:  "delete-tenant",
+		usage: "Delete all the views of a tenant",
+		run:   deleteTenant,
+	},
+	{
+		name:  "delete-id",
+		usage: "Delete all the views of an ID, and erase them from the archive",
+		run:   deleteID,
+	},
+	{
+		name:  "purge",
+		usage: "Delete the views older than a duration",
+		run:   purge,
+	},
+	{
+		name:  "export",
+		usage: "Export the views of an ID, or their counts per interval, as CSV, NDJSON or Parquet",
+		run:   exportViews,
+	},
+	{
+		name:  "replay",
+		usage: "Index the views archived by the indexers in a time range into a new index",
+		run:   replay,
+	},
+}
+
+func main() {
+	configFlag := flag.String("config_file", "", "Configuration file, YAML or TOML, default is none")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := findCommand(flag.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Cancel the command on interrupt, a running ElasticSearch task carries on.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd.run(ctx, cfg, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-config_file file] <command> [flags]\n\nCommands:\n", os.Args[0])
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.usage)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -help' for the flags of a command.\n", os.Args[0])
+}
+
+// connectElastic connects to ElasticSearch. Only init creates the indices, the other commands verify they exist.
+func connectElastic(cfg *config.Config, verifyOnly bool) (*elastic.Store, error) {
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, slog.String("service", "admin"))
+	if err != nil {
+		return nil, err
+	}
+
+	elasticOpts := []elastic.Option{
+		elastic.WithLogger(logger),
+		elastic.WithTimeout(cfg.Elastic.Timeout),
+		elastic.WithIndex(cfg.Elastic.Index),
+		elastic.WithLateIndex(cfg.Elastic.LateIndex),
+		elastic.WithIndexSettings(cfg.Elastic.Shards, cfg.Elastic.Replicas),
+	}
+
+	if rollover := cfg.Elastic.Rollover; rollover.Enabled {
+		elasticOpts = append(elasticOpts, elastic.WithRollover(elastic.Rollover{MaxAge: rollover.MaxAge, MaxSize: rollover.MaxSize, Retention: rollover.Retention}))
+	}
+
+	if verifyOnly {
+		elasticOpts = append(elasticOpts, elastic.WithVerifyOnly())
+	}
+
+	return elastic.Connect(cfg.Elastic.URL, elasticOpts...)
+}
+
+func initIndices(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := connectElastic(cfg, false)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	version, err := db.MappingVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("done, mapping version %d, latest is %d\n", version, db.LatestMappingVersion())
+
+	return nil
+}
+
+func status(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := connectElastic(cfg, true)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	version, err := db.MappingVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := db.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("mapping version %d, latest is %d\n\n", version, db.LatestMappingVersion())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tHEALTH\tDOCS\tSIZE")
+
+	var docs, size int64
+
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.Health, s.Docs, formatBytes(s.SizeBytes))
+
+		docs += s.Docs
+		size += s.SizeBytes
+	}
+
+	fmt.Fprintf(w, "total\t\t%d\t%s\n", docs, formatBytes(size))
+
+	return w.Flush()
+}
+
+// formatBytes formats the size in the largest unit below it, e.g. 1.5mb.
+func formatBytes(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%db", size)
+	}
+
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cb", value, "kmgt"[exp])
+}
+
+func reindex(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := connectElastic(cfg, true)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	err = db.Reindex(ctx, func(index string, created, total int64) {
+		fmt.Printf("%s: reindexed %d of %d\n", index, created, total)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("done")
+
+	return nil
+}
+
+func deleteTenant(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("delete-tenant", flag.ExitOnError)
+	tenant := flags.String("tenant", "", "Tenant to delete, required")
+	wait := flags.Bool("wait", true, "Wait for the delete to complete, printing the progress")
+	pollInterval := flags.Duration("poll_interval", 2*time.Second, "Interval between the progress updates")
+	flags.Parse(args)
+
+	if *tenant == "" {
+		return errors.New("-tenant is required")
+	}
+
+	return runPurge(ctx, cfg, store.PurgeFilter{Tenant: *tenant}, fmt.Sprintf("the views of tenant %q", *tenant), *wait, *pollInterval)
+}
+
+func deleteID(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("delete-id", flag.ExitOnError)
+	tenant := flags.String("tenant", cfg.Auth.DefaultTenant, "Tenant of the ID")
+	id := flags.String("id", "", "ID to delete, required")
+	wait := flags.Bool("wait", true, "Wait for the delete to complete, printing the progress")
+	pollInterval := flags.Duration("poll_interval", 2*time.Second, "Interval between the progress updates")
+	flags.Parse(args)
+
+	if *id == "" {
+		return errors.New("-id is required")
+	}
+
+	if err := runPurge(ctx, cfg, store.PurgeFilter{Tenant: *tenant, ID: *id}, fmt.Sprintf("the views of ID %q of tenant %q", *id, *tenant), *wait, *pollInterval); err != nil {
+		return err
+	}
+
+	// A replay would index the views again. The erasures of the servers rewrite the same segments, one at a time.
+	if cfg.Archive.Enabled {
+		lock := filter.NewRedisMarker(redis.NewClient(cfg.Redis.Addr, cfg.Redis.DB), cfg.Archive.RedisKeyPrefix)
+
+		n, err := archive.Erase(ctx, archive.NewDir(cfg.Archive.Dir), lock, *tenant, *id)
+		if err != nil {
+			return errors.Wrap(err, "archive")
+		}
+
+		fmt.Printf("erased %d views from the archive\n", n)
+	}
+
+	// The streams of the ID get the counts without the deleted views, once they are deleted.
+	if cfg.Live.Enabled && *wait {
+		if err := live.Refresh(ctx, redis.NewClient(cfg.Redis.Addr, cfg.Redis.DB), cfg.Live.Channel, *tenant, *id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func purge(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	olderThan := flags.Duration("older-than", 0, "Delete the views older than the duration, e.g. 720h, required")
+	tenant := flags.String("tenant", "", "Only delete the views of the tenant, default is every tenant")
+	wait := flags.Bool("wait", true, "Wait for the delete to complete, printing the progress")
+	pollInterval := flags.Duration("poll_interval", 2*time.Second, "Interval between the progress updates")
+	flags.Parse(args)
+
+	if *olderThan <= 0 {
+		return errors.New("-older-than is required, and must be positive")
+	}
+
+	before := time.Now().Add(-*olderThan)
+
+	what := fmt.Sprintf("the views before %s", before.Format(time.RFC3339))
+	if *tenant != "" {
+		what += fmt.Sprintf(" of tenant %q", *tenant)
+	}
+
+	return runPurge(ctx, cfg, store.PurgeFilter{Tenant: *tenant, Before: before}, what, *wait, *pollInterval)
+}
+
+// runPurge starts deleting the views of the filter, described by what, and waits for the delete if wait is set.
+func runPurge(ctx context.Context, cfg *config.Config, f store.PurgeFilter, what string, wait bool, pollInterval time.Duration) error {
+	db, err := connectElastic(cfg, true)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	taskID, err := db.ViewPurger().Purge(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("deleting %s, task %s\n", what, taskID)
+
+	if !wait {
+		return nil
+	}
+
+	status, err := retention.Wait(ctx, db.ViewPurger(), taskID, pollInterval, func(s store.PurgeStatus) {
+		fmt.Printf("deleted %d of %d\n", s.Deleted, s.Total)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("done, deleted %d views\n", status.Deleted)
+
+	return nil
+}
+
+func migrate(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := connectElastic(cfg, true)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	version, err := db.MappingVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("mapping version %d, latest is %d\n", version, db.LatestMappingVersion())
+
+	applied, err := db.Migrate(ctx, func(m elastic.Migration, processed, total int64) {
+		fmt.Printf("version %d: migrated %d of %d\n", m.Version, processed, total)
+	})
+
+	for _, m := range applied {
+		fmt.Printf("applied version %d, %s\n", m.Version, m.Description)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("done, applied %d versions\n", len(applied))
+
+	return nil
+}
+
+func exportViews(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	tenant := flags.String("tenant", cfg.Auth.DefaultTenant, "Tenant of the ID")
+	id := flags.String("id", "", "ID to export, required")
+	from := flags.String("from", "", "Start of the range, RFC 3339, required")
+	to := flags.String("to", "", "End of the range, RFC 3339, default is now")
+	format := flags.String("format", string(export.CSV), "Format, csv, ndjson or parquet")
+	kind := flags.String("kind", string(export.Hits), "Export every view with hits, or the counts per interval with buckets")
+	interval := flags.Duration("interval", time.Hour, "Interval of the buckets")
+	output := flags.String("output", "", "File written, default is stdout")
+	flags.Parse(args)
+
+	if *id == "" || *from == "" {
+		return errors.New("-id and -from are required")
+	}
+
+	f, err := export.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	k, err := export.ParseKind(*kind)
+	if err != nil {
+		return err
+	}
+
+	start, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		return errors.Wrap(err, "-from")
+	}
+
+	end := time.Now()
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			return errors.Wrap(err, "-to")
+		}
+	}
+
+	db, err := connectElastic(cfg, true)
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+
+	exporter := export.NewExporter(db.ViewRetriever(), export.WithPageSize(cfg.Export.PageSize))
+
+	var n int64
+
+	if k == export.Buckets {
+		n, err = exporter.Buckets(ctx, w, f, store.HistogramQuery{Tenant: *tenant, ID: *id, Interval: *interval, From: start, To: end})
+	} else {
+		n, err = exporter.Hits(ctx, w, f, store.HitQuery{Tenant: *tenant, ID: *id, From: start, To: end})
+	}
+	if err != nil {
+		return err
+	}
+
+	// The rows may be written to stdout, the summary goes to stderr.
+	fmt.Fprintf(os.Stderr, "done, exported %d %s\n", n, k)
+
+	if *output == "" {
+		return nil
+	}
+
+	return w.Close()
+}
+
+// replay indexes the archived views into a target index, never the live one, to rebuild it or check a new mapping.
+// The target is then swapped in by pointing elastic.index at it.
+func replay(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := flags.String("from", "", "Start of the range of archive time, RFC 3339, required")
+	to := flags.String("to", "", "End of the range of archive time, RFC 3339, default is now")
+	index := flags.String("index", "", "Target index, created if it does not exist, required")
+	batchSize := flags.Int("batch_size", 1000, "Views per bulk request")
+	flags.Parse(args)
+
+	if *from == "" || *index == "" {
+		return errors.New("-from and -index are required")
+	}
+
+	if *index == cfg.Elastic.Index || *index == cfg.Elastic.LateIndex {
+		return errors.Errorf("-index must not be the live index %q", *index)
+	}
+
+	if *batchSize < 1 {
+		return errors.New("-batch_size must be positive")
+	}
+
+	start, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		return errors.Wrap(err, "-from")
+	}
+
+	end := time.Now()
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			return errors.Wrap(err, "-to")
+		}
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, slog.String("service", "admin"))
+	if err != nil {
+		return err
+	}
+
+	// The late views go to the late index of the target, as they do with the live indices.
+	db, err := elastic.Connect(cfg.Elastic.URL,
+		elastic.WithLogger(logger),
+		elastic.WithTimeout(cfg.Elastic.Timeout),
+		elastic.WithIndex(*index),
+		elastic.WithLateIndex(*index+"_late"),
+		elastic.WithIndexSettings(cfg.Elastic.Shards, cfg.Elastic.Replicas))
+	if err != nil {
+		return errors.Wrap(err, "elastic")
+	}
+
+	tracker := db.ViewTracker()
+
+	var (
+		views          []store.ViewTrack
+		batches, total int64
+	)
+
+	track := func() error {
+		if len(views) == 0 {
+			return nil
+		}
+
+		if err := tracker.BatchTrack(ctx, views); err != nil {
+			return errors.Wrapf(err, "after %d views", total)
+		}
+
+		total += int64(len(views))
+		views = views[:0]
+
+		fmt.Printf("%d views replayed\n", total)
+
+		return nil
+	}
+
+	err = archive.Replay(ctx, archive.NewDir(cfg.Archive.Dir), start, end, func(batch *proto.ViewTrackBatchRequest) error {
+		batches++
+
+		for _, req := range batch.Requests {
+			views = append(views, req.ViewTrack())
+
+			if len(views) >= *batchSize {
+				if err := track(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = track()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("done, replayed %d views of %d batches into %s\n", total, batches, *index)
+
+	return nil
+}
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
@@ -13,23 +11,31 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/client"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+
 	"github.com/namsral/flag"
 )
 
 var (
-	logger = log.New(os.Stdout, "indexer", log.LstdFlags|log.LUTC)
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(slog.String("service", "benchmark"))
 )
 
-// Benchmark will repeatedly call /counter/v1/statistics endpoint as fast as possible using a number of Goroutine, and
+// Benchmark will repeatedly call the Track API as fast as possible using a number of Goroutine, and
 // output the number of request per second.
 func main() {
 	numOfWorkersFlag := flag.Uint("w", 1, "Number of workers, default is 1")
 	hitIDFlag := flag.String("i", "1", "The hit ID to spam, default is '1'")
+	urlFlag := flag.String("u", "http://localhost:8001", "The URL of the server, default is 'http://localhost:8001'")
+	apiKeyFlag := flag.String("k", "", "The API key, default is none")
 	flag.Parse()
 
 	numOfWorkers := int(*numOfWorkersFlag)
 	hitID := *hitIDFlag
 
+	// Every Track is a request, without the batching of the client.
+	transport := client.NewHTTPTransport(*urlFlag, client.WithAPIKey(*apiKeyFlag))
+
 	fmt.Printf("using %d worker(s)", numOfWorkers)
 
 	stopCh := make(chan struct{})
@@ -43,8 +49,6 @@ func main() {
 		go func() {
 			defer stopWg.Done()
 
-			flood := floodTrack(hitID)
-
 			for {
 				select {
 				case <-stopCh:
@@ -52,14 +56,8 @@ func main() {
 				default:
 				}
 
-				res, err := flood()
-				if err != nil {
-					logger.Printf("ERROR: %v\n", err)
-					continue
-				}
-
-				if res.StatusCode != 200 {
-					logger.Printf("STATUS: %v\n", res.StatusCode)
+				if err := transport.Track(context.Background(), client.Hit{ID: hitID}); err != nil {
+					logger.Error("track", logging.Error(err))
 					continue
 				}
 
@@ -96,25 +94,3 @@ func main() {
 
 	stopWg.Wait()
 }
-
-func floodTrack(id string) func() (*http.Response, error) {
-	client := http.Client{
-		Timeout: 3 * time.Second,
-	}
-
-	type body struct {
-		ID string `json:"id"`
-	}
-
-	var b body
-	b.ID = id
-
-	j, err := json.Marshal(b)
-	if err != nil {
-		panic(err)
-	}
-
-	return func() (*http.Response, error) {
-		return client.Post("http://localhost:8001/analytics", "application/json", bytes.NewBuffer(j))
-	}
-}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/config"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/importer"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/elastic"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+// Import loads the views of NDJSON or CSV files into ElasticSearch, through the same BatchTrack as the indexer:
+//
+//	import [-config_file config.yaml] [flags] file...
+//
+// The progress is saved in the checkpoint file after each batch, so a failed import is resumed by running it again.
+func main() {
+	configFlag := flag.String("config_file", "", "Configuration file, YAML or TOML, default is none")
+	tenantFlag := flag.String("tenant", "", "Tenant of the views, default is auth.default_tenant")
+	formatFlag := flag.String("format", "", "Format of the files, ndjson or csv, default is from the extension")
+	batchSizeFlag := flag.Int("batch_size", 1000, "Views per bulk request")
+	concurrencyFlag := flag.Int("concurrency", 2, "Bulk requests at once")
+	rateFlag := flag.Int("rate", 0, "Max views imported per second, default is no limit")
+	retriesFlag := flag.Int("retries", 3, "Retries of a failed bulk request")
+	checkpointFlag := flag.String("checkpoint", "import-checkpoint.json", "Checkpoint file, to resume a failed import")
+	dryRunFlag := flag.Bool("dry_run", false, "Only parse and validate the files, and report the invalid lines, failing if any")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, slog.String("service", "import"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *batchSizeFlag < 1 || *concurrencyFlag < 1 || *rateFlag < 0 || *retriesFlag < 0 {
+		fmt.Fprintln(os.Stderr, "-batch_size and -concurrency must be positive, -rate and -retries must not be negative")
+		os.Exit(2)
+	}
+
+	tenant := *tenantFlag
+	if tenant == "" {
+		tenant = cfg.Auth.DefaultTenant
+	}
+
+	opts := []importer.Option{
+		importer.WithLogger(logger),
+		importer.WithBatchSize(*batchSizeFlag),
+		importer.WithConcurrency(*concurrencyFlag),
+		importer.WithRate(*rateFlag),
+		importer.WithRetries(*retriesFlag),
+		importer.WithMaxFuture(cfg.Timestamps.MaxFuture),
+	}
+
+	// A dry run tracks nothing, it doesn't need ElasticSearch.
+	var tracker store.ViewTracker
+
+	if *dryRunFlag {
+		opts = append(opts, importer.WithDryRun())
+	} else {
+		db, err := connectElastic(cfg, logger)
+		if err != nil {
+			logger.Error("elastic", logging.Error(err))
+			os.Exit(1)
+		}
+
+		tracker = db.ViewTracker()
+
+		checkpoint, err := importer.LoadCheckpoint(*checkpointFlag)
+		if err != nil {
+			logger.Error("checkpoint", logging.Error(err))
+			os.Exit(1)
+		}
+
+		opts = append(opts, importer.WithCheckpoint(checkpoint))
+	}
+
+	// Stop on interrupt, the batches being tracked are completed and checkpointed.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	imp := importer.NewImporter(tracker, tenant, opts...)
+
+	failed := false
+
+	for _, path := range flag.Args() {
+		if err := importFile(ctx, imp, path, *formatFlag, *dryRunFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// importFile imports the file, and prints the invalid lines. A dry run fails if a line is invalid.
+func importFile(ctx context.Context, imp *importer.Importer, path, format string, dryRun bool) error {
+	f, err := importer.FormatOf(path)
+	if format != "" {
+		f, err = importer.ParseFormat(format)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := imp.Import(ctx, path, f)
+
+	if res.ResumedAt > 0 {
+		fmt.Printf("%s: resumed after line %d\n", path, res.ResumedAt)
+	}
+
+	for _, lineErr := range res.Errors {
+		fmt.Printf("%s:%d: %v\n", path, lineErr.Line, lineErr.Err)
+	}
+
+	if res.Invalid > int64(len(res.Errors)) {
+		fmt.Printf("%s: %d more invalid lines\n", path, res.Invalid-int64(len(res.Errors)))
+	}
+
+	if dryRun {
+		fmt.Printf("%s: %d valid views, %d invalid lines\n", path, res.Imported, res.Invalid)
+
+		if err == nil && res.Invalid > 0 {
+			return errors.New("invalid lines")
+		}
+	} else {
+		fmt.Printf("%s: %d views imported, %d invalid lines skipped\n", path, res.Imported, res.Invalid)
+	}
+
+	return errors.Wrap(err, "import")
+}
+
+func connectElastic(cfg *config.Config, logger *slog.Logger) (*elastic.Store, error) {
+	elasticOpts := []elastic.Option{
+		elastic.WithLogger(logger),
+		elastic.WithTimeout(cfg.Elastic.Timeout),
+		elastic.WithIndex(cfg.Elastic.Index),
+		elastic.WithLateIndex(cfg.Elastic.LateIndex),
+		elastic.WithIndexSettings(cfg.Elastic.Shards, cfg.Elastic.Replicas),
+	}
+
+	if rollover := cfg.Elastic.Rollover; rollover.Enabled {
+		elasticOpts = append(elasticOpts, elastic.WithRollover(elastic.Rollover{MaxAge: rollover.MaxAge, MaxSize: rollover.MaxSize, Retention: rollover.Retention}))
+	}
+
+	if cfg.Elastic.VerifyOnly {
+		elasticOpts = append(elasticOpts, elastic.WithVerifyOnly())
+	}
+
+	return elastic.Connect(cfg.Elastic.URL, elasticOpts...)
+}
@@ -2,76 +2,208 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/archive"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/config"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/health"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/worker"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/elastic"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/redis"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/version"
 
 	"github.com/adjust/rmq"
 	"github.com/namsral/flag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Indexer is the consumer of the redis message queue. It takes messages from the queue and index them into ElasticSearch.
 //
-// The messages will be indexed into ElasticSearch in batch ,with batch size of 256, and poll duration of 1 seconds.
+// The messages will be indexed into ElasticSearch in batch, the prefetch limit and poll interval are configurable.
 // ElasticSearch likes it when documents are indexed in batch (bulk).
 // Refer to https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
 
-const (
-	prefetchLimit = 512
-)
-
 var (
-	logger = log.New(os.Stdout, "indexer", log.LstdFlags|log.LUTC)
+	tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/cmd/indexer")
 )
 
 func main() {
-	logger.Printf("version.BuildTime: %v, version.Commit: %v\n", version.BuildTime, version.Commit)
-
-	elasticURLFlag := flag.String("elastic_url", "http://127.0.0.1:9200", "ElasticSearch server URL, must include protocol, default is http://127.0.0.1:9200")
-	redisAddrFlag := flag.String("redis_addr", "127.0.0.1:6379", "Redis host addr,  default is 127.0.0.1:6379")
-	numWorkersFlag := flag.Uint("workers", 10, "Number of workers used to index to ElasticSearch, default is 10")
+	configFlag := flag.String("config_file", "", "Configuration file, YAML or TOML, default is none")
+	printConfigFlag := flag.Bool("print-config", false, "Print the configuration and exit")
 	flag.Parse()
 
-	elasticURL := *elasticURLFlag
-	redisAddr := *redisAddrFlag
-	numWorkers := *numWorkersFlag
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *printConfigFlag {
+		if err := cfg.Print(os.Stdout); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, slog.String("service", "indexer"))
+	if err != nil {
+		panic(err)
+	}
+
+	logger.Info("version", slog.String("build_time", version.BuildTime), slog.String("commit", version.Commit))
 
-	db, err := elastic.Connect(elasticURL)
+	shutdownTracing, err := tracing.Setup("indexer", cfg.Tracing.Exporter, os.Stdout)
 	if err != nil {
 		panic(err)
 	}
 
-	connection := rmq.OpenConnection("consumer", "tcp", redisAddr, 0)
+	elasticOpts := []elastic.Option{
+		elastic.WithLogger(logger),
+		elastic.WithTimeout(cfg.Elastic.Timeout),
+		elastic.WithIndex(cfg.Elastic.Index),
+		elastic.WithLateIndex(cfg.Elastic.LateIndex),
+		elastic.WithIndexSettings(cfg.Elastic.Shards, cfg.Elastic.Replicas),
+	}
+
+	if rollover := cfg.Elastic.Rollover; rollover.Enabled {
+		elasticOpts = append(elasticOpts, elastic.WithRollover(elastic.Rollover{MaxAge: rollover.MaxAge, MaxSize: rollover.MaxSize, Retention: rollover.Retention}))
+	}
+
+	if cfg.Elastic.VerifyOnly {
+		elasticOpts = append(elasticOpts, elastic.WithVerifyOnly())
+	}
+
+	db, err := elastic.Connect(cfg.Elastic.URL, elasticOpts...)
+	if err != nil {
+		panic(err)
+	}
+
+	redisClient := redis.NewClient(cfg.Redis.Addr, cfg.Redis.DB)
+
+	connection := rmq.OpenConnectionWithRedisClient("consumer", redisClient)
+
+	var viewTracker store.ViewTracker = db.ViewTracker()
+
+	// Publish the indexed views, so the servers push the new counts to their subscribers.
+	if cfg.Live.Enabled {
+		viewTracker = live.NewViewTracker(viewTracker, redisClient, cfg.Live.Channel, logger)
+	}
+
+	// Keep the consumed batches, the queue messages are deleted once acked.
+	var archiver *archive.Archiver
+
+	archiveCtx, stopArchive := context.WithCancel(context.Background())
+	archiveDone := make(chan struct{})
+
+	if cfg.Archive.Enabled {
+		archiver = archive.NewArchiver(archive.NewDir(cfg.Archive.Dir),
+			archive.WithLogger(logger),
+			archive.WithFlushInterval(cfg.Archive.FlushInterval),
+			archive.WithMaxSegmentSize(cfg.Archive.MaxSegmentMB<<20))
+
+		go func() {
+			defer close(archiveDone)
+			archiver.Run(archiveCtx)
+		}()
+	} else {
+		close(archiveDone)
+	}
 
 	workers := worker.NewWorkerPool()
-	workers.Start(int(numWorkers))
+	workers.Start(cfg.Indexer.Workers)
+
+	singleQueue := connection.OpenQueue(cfg.Redis.SingleQueue)
+	singleQueue.StartConsuming(cfg.Indexer.PrefetchLimit, cfg.Indexer.PollInterval)
+	singleQueue.AddConsumer("queue_1", singleConsumer(viewTracker, workers, archiver, logger))
+
+	batchQueue := connection.OpenQueue(cfg.Redis.BatchQueue)
+	batchQueue.StartConsuming(cfg.Indexer.PrefetchLimit, cfg.Indexer.PollInterval)
+	batchQueue.AddConsumer("queue_1", batchConsumer(viewTracker, workers, archiver, logger))
+
+	janitor := retention.NewJanitor(db.ViewPurger(), logger,
+		retention.WithInterval(cfg.Retention.Interval),
+		retention.WithRetention(cfg.Retention.Default, cfg.Retention.Tenants))
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	janitorDone := make(chan struct{})
+
+	if janitor.Enabled() {
+		go func() {
+			defer close(janitorDone)
+			janitor.Run(janitorCtx)
+		}()
+	} else {
+		close(janitorDone)
+	}
+
+	healthHandler := health.NewHandler()
+	healthHandler.AddCheck("elastic", db.Ping)
+	healthHandler.AddCheck("redis", func(ctx context.Context) error {
+		return redis.Ping(ctx, redisClient)
+	})
+
+	adminSrv := &http.Server{
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		Addr:         ":" + strconv.Itoa(cfg.Indexer.AdminPort),
+		Handler:      healthHandler,
+	}
 
-	singleQueue := connection.OpenQueue("view_single")
-	singleQueue.StartConsuming(prefetchLimit, 400*time.Millisecond)
-	singleQueue.AddConsumer("queue_1", singleConsumer(db.ViewTracker(), workers))
+	logger.Info("starting admin server", slog.Int("port", cfg.Indexer.AdminPort))
 
-	batchQueue := connection.OpenQueue("view_batch")
-	batchQueue.StartConsuming(prefetchLimit, 400*time.Millisecond)
-	batchQueue.AddConsumer("queue_1", batchConsumer(db.ViewTracker(), workers))
+	go func() {
+		err := adminSrv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			panic(fmt.Errorf("error starting admin server: %v", err))
+		}
+	}()
 
 	// Wait for terminate signal
 	shutdownSignal := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignal, os.Interrupt, syscall.SIGTERM)
 	<-shutdownSignal
 
+	healthHandler.Drain()
+
 	singleQueue.Close()
 
 	batchQueue.Close()
 
 	workers.Stop()
+
+	// Store the last segment, once every consumed batch is archived.
+	stopArchive()
+	<-archiveDone
+
+	stopJanitor()
+	<-janitorDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := adminSrv.Shutdown(ctx); err != nil {
+		logger.Error("shutdown admin server", logging.Error(err))
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("shutdown tracing", logging.Error(err))
+	}
 }
 
 // A helper type to implement Consume interface
@@ -81,7 +213,8 @@ func (c ConsumerFunc) Consume(delivery rmq.Delivery) {
 	c(delivery)
 }
 
-func batchConsumer(viewTracker store.ViewTracker, workers *worker.Pool) ConsumerFunc {
+// batchConsumer tracks the views of the batches. They are archived first, if the archiver is not nil.
+func batchConsumer(viewTracker store.ViewTracker, workers *worker.Pool, archiver *archive.Archiver, logger *slog.Logger) ConsumerFunc {
 	return func(delivery rmq.Delivery) {
 		data := delivery.Payload()
 		batch := &proto.ViewTrackBatchRequest{}
@@ -89,25 +222,36 @@ func batchConsumer(viewTracker store.ViewTracker, workers *worker.Pool) Consumer
 		if err := batch.Unmarshal([]byte(data)); err != nil {
 			// For now, we ignore messages with Unmarshal error.
 
-			logger.Printf("ERROR unmarshal message: %v", data)
+			logger.Error("unmarshal message", slog.String("payload", data), logging.Error(err))
 
 			delivery.Ack()
 
 			return
 		}
 
+		ctx, span := tracer.Start(tracing.Extract(context.Background(), batch.TraceContext), "indexer.Consume view_batch",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.Int("batch.size", len(batch.Requests))))
+
+		if archiver != nil {
+			if err := archiver.Archive(ctx, []byte(data)); err != nil {
+				logger.Error("archive batch", slog.Int("batch_size", len(batch.Requests)), logging.Error(err))
+			}
+		}
+
 		tracks := make([]store.ViewTrack, 0, len(batch.Requests))
 
 		for _, req := range batch.Requests {
-			tracks = append(tracks, store.ViewTrack{
-				ID:        string(req.Id),
-				Timestamp: time.Unix(0, req.Timestamp),
-			})
+			tracks = append(tracks, req.ViewTrack())
 		}
 
 		workers.Queue(func() {
-			if err := viewTracker.BatchTrack(context.Background(), tracks); err != nil {
-				logger.Printf("ERROR batch track: %v\n", err)
+			defer span.End()
+
+			if err := viewTracker.BatchTrack(ctx, tracks); err != nil {
+				tracing.RecordError(span, err)
+
+				logger.Error("batch track", slog.Int("batch_size", len(tracks)), logging.Error(err))
 			}
 
 			delivery.Ack()
@@ -115,7 +259,8 @@ func batchConsumer(viewTracker store.ViewTracker, workers *worker.Pool) Consumer
 	}
 }
 
-func singleConsumer(viewTracker store.ViewTracker, workers *worker.Pool) ConsumerFunc {
+// singleConsumer tracks the views. They are archived first as batches of one view, if the archiver is not nil.
+func singleConsumer(viewTracker store.ViewTracker, workers *worker.Pool, archiver *archive.Archiver, logger *slog.Logger) ConsumerFunc {
 	return func(delivery rmq.Delivery) {
 		data := delivery.Payload()
 		req := &proto.ViewTrackRequest{}
@@ -123,25 +268,47 @@ func singleConsumer(viewTracker store.ViewTracker, workers *worker.Pool) Consume
 		if err := req.Unmarshal([]byte(data)); err != nil {
 			// For now, we ignore messages with Unmarshal error.
 
-			logger.Printf("ERROR unmarshal message: %v", data)
+			logger.Error("unmarshal message", slog.String("payload", data), logging.Error(err))
 
 			delivery.Ack()
 
 			return
 		}
 
-		track := store.ViewTrack{
-			ID:        string(req.Id),
-			Timestamp: time.Unix(0, req.Timestamp),
+		track := req.ViewTrack()
+
+		ctx, span := tracer.Start(tracing.Extract(context.Background(), req.TraceContext), "indexer.Consume view_single",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(tracing.IDAttribute(track.ID)))
+
+		if archiver != nil {
+			if err := archiveSingle(ctx, archiver, req); err != nil {
+				logger.Error("archive view", slog.String("id", track.ID), logging.Error(err))
+			}
 		}
 
 		workers.Queue(func() {
-			if err := viewTracker.Track(context.Background(), track); err != nil {
-				logger.Printf("ERROR track: %v\n", err)
+			defer span.End()
 
+			if err := viewTracker.Track(ctx, track); err != nil {
+				tracing.RecordError(span, err)
+
+				logger.Error("track", slog.String("id", track.ID), logging.Error(err))
 			}
 
 			delivery.Ack()
 		})
 	}
 }
+
+// archiveSingle archives the request as a batch, the only message of the archive.
+func archiveSingle(ctx context.Context, archiver *archive.Archiver, req *proto.ViewTrackRequest) error {
+	batch := &proto.ViewTrackBatchRequest{Requests: []*proto.ViewTrackRequest{req}}
+
+	data, err := batch.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return archiver.Archive(ctx, data)
+}
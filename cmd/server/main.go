@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,8 +12,27 @@ import (
 	"syscall"
 	"time"
 
+	// The time zones of the calendar ranges, when the system has none.
+	_ "time/tzdata"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/alert"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/anomaly"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/api"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/archive"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/config"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/export"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/grpcapi"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/health"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/queue"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/ratelimit"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/retention"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/skew"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/elastic"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/redis"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/version"
@@ -20,54 +40,194 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/namsral/flag"
+	"google.golang.org/grpc"
+	goredis "gopkg.in/redis.v3"
 )
 
-// Server provides HTTP APIs to track and retrieve views.
+// Server provides HTTP and gRPC APIs to track and retrieve views.
 // It acts as the producer of the message queue, where it'll insert hit messages into the queue.
 
-var (
-	logger = log.New(os.Stdout, "server", log.LstdFlags|log.LUTC)
-)
-
 func main() {
-	logger.Printf("version.BuildTime: %v, version.Commit: %v\n", version.BuildTime, version.Commit)
-
-	portFlag := flag.Int("port", 8001, "API server port, default is 8001")
-	elasticURLFlag := flag.String("elastic_url", "http://127.0.0.1:9200", "Elastic server URL, must include protocol, default is http://127.0.0.1:9200")
-	redisAddrFlag := flag.String("redis_addr", "127.0.0.1:6379", "Redis host addr,  default is 127.0.0.1:6379")
+	configFlag := flag.String("config_file", "", "Configuration file, YAML or TOML, default is none")
+	printConfigFlag := flag.Bool("print-config", false, "Print the configuration and exit")
 
 	flag.Parse()
 
-	port := *portFlag
-	elasticURL := *elasticURLFlag
-	redisAddr := *redisAddrFlag
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *printConfigFlag {
+		if err := cfg.Print(os.Stdout); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, slog.String("service", "server"))
+	if err != nil {
+		panic(err)
+	}
+
+	logger.Info("version", slog.String("build_time", version.BuildTime), slog.String("commit", version.Commit))
+
+	shutdownTracing, err := tracing.Setup("server", cfg.Tracing.Exporter, os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+
+	elasticOpts := []elastic.Option{
+		elastic.WithLogger(logger),
+		elastic.WithTimeout(cfg.Elastic.Timeout),
+		elastic.WithIndex(cfg.Elastic.Index),
+		elastic.WithLateIndex(cfg.Elastic.LateIndex),
+		elastic.WithIndexSettings(cfg.Elastic.Shards, cfg.Elastic.Replicas),
+	}
 
-	elasticDb, err := elastic.Connect(elasticURL)
+	if rollover := cfg.Elastic.Rollover; rollover.Enabled {
+		elasticOpts = append(elasticOpts, elastic.WithRollover(elastic.Rollover{MaxAge: rollover.MaxAge, MaxSize: rollover.MaxSize, Retention: rollover.Retention}))
+	}
+
+	if cfg.Elastic.VerifyOnly {
+		elasticOpts = append(elasticOpts, elastic.WithVerifyOnly())
+	}
+
+	elasticDb, err := elastic.Connect(cfg.Elastic.URL, elasticOpts...)
 	if err != nil {
 		panic(err)
 	}
 
-	redisTrackerQueue := redis.Connect(redisAddr, 0)
+	redisTrackerQueue := redis.Connect(cfg.Redis.Addr, cfg.Redis.DB, redis.WithQueues(cfg.Redis.SingleQueue, cfg.Redis.BatchQueue))
 
 	// If you don't want to redis, you can use the elastic store directly. Refer to below code
-	//viewTrackerQueue := queue.NewViewTrackerQueue(redisTrackerQueue, logger, queue.WithBatchSize(256), queue.WithBatchInterval(3*time.Second))
+	//viewTrackerQueue := queue.NewViewTrackerQueue(elasticDb.ViewTracker(), logger, queue.WithBatchSize(cfg.Queue.BatchSize), queue.WithBatchInterval(cfg.Queue.BatchInterval))
+
+	viewTrackerQueue := queue.NewViewTrackerQueue(redisTrackerQueue, logger,
+		queue.WithBatchSize(cfg.Queue.BatchSize),
+		queue.WithBatchInterval(cfg.Queue.BatchInterval))
+
+	redisClient := redis.NewClient(cfg.Redis.Addr, cfg.Redis.DB)
+
+	window := skew.NewWindow(cfg.Timestamps.MaxPast, cfg.Timestamps.MaxFuture, skew.Policy(cfg.Timestamps.Policy))
+
+	apiOpts := []api.Option{api.WithTimestampWindow(window)}
+	grpcOpts := []grpcapi.Option{grpcapi.WithTimestampWindow(window)}
+
+	if cfg.RateLimit.Enabled {
+		limits := rateLimits(cfg.RateLimit, redisClient, logger)
+
+		apiOpts = append(apiOpts, api.WithTrackMiddleware(limits.Middleware))
+		grpcOpts = append(grpcOpts, grpcapi.WithRateLimit(limits))
+	}
+
+	if cfg.Filter.Enabled {
+		filters, err := filterChain(cfg.Filter, redisClient, logger)
+		if err != nil {
+			panic(err)
+		}
 
-	viewTrackerQueue := queue.NewViewTrackerQueue(redisTrackerQueue, logger, queue.WithBatchSize(256), queue.WithBatchInterval(3*time.Second))
+		apiOpts = append(apiOpts, api.WithFilters(filters))
+		grpcOpts = append(grpcOpts, grpcapi.WithFilters(filters))
+	}
+
+	hub := live.NewHub()
+	liveCtx, stopLive := context.WithCancel(context.Background())
+
+	if cfg.Live.Enabled {
+		go listenIndexedViews(liveCtx, redisClient, cfg.Live.Channel, hub, logger)
+
+		apiOpts = append(apiOpts, api.WithStream(hub, cfg.Live.Interval, cfg.Live.Heartbeat))
+	}
+
+	alertsCtx, stopAlerts := context.WithCancel(context.Background())
+	alertsDone := make(chan struct{})
+
+	if cfg.Alerts.Enabled {
+		rules, evaluator := newAlerts(cfg.Alerts, redisClient, elasticDb.ViewRetriever(), logger)
+
+		go func() {
+			defer close(alertsDone)
+
+			evaluator.Run(alertsCtx)
+		}()
+
+		apiOpts = append(apiOpts, api.WithAlerts(rules))
+	} else {
+		close(alertsDone)
+	}
+
+	if cfg.Anomaly.Enabled {
+		detector := anomaly.NewDetector(elasticDb.ViewRetriever(),
+			anomaly.WithSeasons(cfg.Anomaly.Seasons),
+			anomaly.WithAlpha(cfg.Anomaly.Alpha),
+			anomaly.WithThreshold(cfg.Anomaly.Threshold))
+
+		apiOpts = append(apiOpts, api.WithAnomaly(detector))
+	}
+
+	if cfg.Export.Enabled {
+		apiOpts = append(apiOpts, api.WithExport(export.NewExporter(elasticDb.ViewRetriever(), export.WithPageSize(cfg.Export.PageSize))))
+	}
+
+	if cfg.Erasure.Enabled {
+		// The erasures of the replicas and the admin commands rewrite the same segments, one at a time.
+		archiveLock := filter.NewRedisMarker(redisClient, cfg.Archive.RedisKeyPrefix)
 
-	apiHandler := api.NewHandler(viewTrackerQueue, elasticDb.ViewRetriever(), logger)
+		erased := func(ctx context.Context, tenant, id string) {
+			// A replay would index the views again. The archive is shared with the indexers, as for the admin commands.
+			if cfg.Archive.Enabled {
+				n, err := archive.Erase(ctx, archive.NewDir(cfg.Archive.Dir), archiveLock, tenant, id)
+				if err != nil {
+					logger.Error("erase archive", slog.String("id", id), logging.Error(err))
+				} else {
+					logger.Info("erased archive", slog.String("id", id), slog.Int("views", n))
+				}
+			}
+
+			// The streams of the ID get the counts without the deleted views.
+			if cfg.Live.Enabled {
+				if err := live.Refresh(ctx, redisClient, cfg.Live.Channel, tenant, id); err != nil {
+					logger.Error("refresh streams", slog.String("id", id), logging.Error(err))
+				}
+			}
+		}
+
+		owners := retention.NewRedisTaskOwners(redisClient, cfg.Erasure.RedisKeyPrefix, cfg.Erasure.TaskTTL)
+
+		apiOpts = append(apiOpts, api.WithErasure(elasticDb.ViewPurger(), owners, erased))
+	}
+
+	apiHandler := api.NewHandler(viewTrackerQueue, elasticDb.ViewRetriever(), logger, apiOpts...)
+
+	healthHandler := health.NewHandler()
+	healthHandler.AddCheck("elastic", elasticDb.Ping)
+	healthHandler.AddCheck("redis", redisTrackerQueue.Ping)
+	healthHandler.AddCheck("queue", viewTrackerQueue.Check)
+
+	authenticator := newAuthenticator(cfg.Auth, redisClient)
 
 	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(logging.Middleware(logger))
 	router.Use(middleware.Recoverer)
-	router.Mount("/", apiHandler)
+	router.Handle("/healthz", healthHandler)
+	router.Handle("/readyz", healthHandler)
+	router.Group(func(r chi.Router) {
+		r.Use(authMiddleware(cfg.Auth, authenticator))
+		r.Mount("/", apiHandler)
+	})
 
 	srv := &http.Server{
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		Addr:         ":" + strconv.Itoa(port),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		Addr:         ":" + strconv.Itoa(cfg.Server.Port),
 		Handler:      router,
 	}
 
-	fmt.Printf("starting server on port %d\n", port)
+	logger.Info("starting server", slog.Int("port", cfg.Server.Port))
 
 	go func() {
 		err := srv.ListenAndServe()
@@ -76,18 +236,226 @@ func main() {
 		}
 	}()
 
+	var grpcSrv *grpc.Server
+
+	if cfg.Server.GRPCPort != 0 {
+		authenticate := grpcapi.Anonymous(cfg.Auth.DefaultTenant)
+		if cfg.Auth.Enabled {
+			authenticate = grpcapi.APIKey(authenticator)
+		}
+
+		grpcSrv = grpcapi.NewServer(viewTrackerQueue, elasticDb.ViewRetriever(), authenticate, logger, grpcOpts...).GRPCServer()
+
+		lis, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.Server.GRPCPort))
+		if err != nil {
+			panic(fmt.Errorf("error starting grpc server: %v", err))
+		}
+
+		logger.Info("starting grpc server", slog.Int("port", cfg.Server.GRPCPort))
+
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				panic(fmt.Errorf("error starting grpc server: %v", err))
+			}
+		}()
+	}
+
 	// Wait for terminate signal
 	shutdownSignal := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignal, os.Interrupt, syscall.SIGTERM)
 	<-shutdownSignal
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	// Fail the readiness check, so no new traffic is routed to the server while it drains.
+	healthHandler.Drain()
+
+	// Keep serving until the load balancers notice the failed readiness check, so the requests routed meanwhile are not refused.
+	logger.Info("draining", slog.Duration("delay", cfg.Server.DrainDelay))
+	time.Sleep(cfg.Server.DrainDelay)
+
+	// End the streams, so they don't hold the shutdown.
+	stopLive()
+	hub.Close()
+
+	// Stop evaluating the alert rules, and wait for the webhooks being delivered.
+	stopAlerts()
+	<-alertsDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	// Shut down gracefully, but wait no longer than 60 seconds before stopping.
+	// Shut down gracefully, but wait no longer than the shutdown timeout before stopping.
 	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Printf("error shutting down server: %v\n", err)
+		logger.Error("shutting down server", logging.Error(err))
+	}
+
+	if grpcSrv != nil {
+		stopGRPC(ctx, grpcSrv)
 	}
 
 	viewTrackerQueue.Stop(ctx)
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("shutting down tracing", logging.Error(err))
+	}
+}
+
+// listenIndexedViews notifies the hub of the views indexed by the indexer, until the context is done.
+// The subscription is retried every second if it fails.
+func listenIndexedViews(ctx context.Context, redisClient *goredis.Client, channel string, hub *live.Hub, logger *slog.Logger) {
+	for {
+		err := live.Listen(ctx, redisClient, channel, hub, logger)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Error("listen indexed views", slog.String("channel", channel), logging.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// newAlerts returns the store of the alert rules, and their evaluator.
+// With the redis backend, the rules are evaluated by a single replica per interval.
+func newAlerts(cfg config.Alerts, redisClient *goredis.Client, retriever store.ViewRetriever, logger *slog.Logger) (alert.Store, *alert.Evaluator) {
+	client := alert.NewHTTPClient(cfg.WebhookTimeout)
+	if cfg.WebhookAllowPrivate {
+		client = &http.Client{Timeout: cfg.WebhookTimeout}
+	}
+
+	webhook := alert.NewWebhook(
+		alert.WithHTTPClient(client),
+		alert.WithRetries(cfg.WebhookRetries, time.Second),
+	)
+
+	if cfg.Backend == "redis" {
+		rules := alert.NewRedisStore(redisClient, cfg.RedisKeyPrefix)
+		lock := filter.NewRedisMarker(redisClient, cfg.RedisKeyPrefix+"lock:")
+
+		return rules, alert.NewEvaluator(rules, retriever, webhook, logger, alert.WithInterval(cfg.Interval), alert.WithLock(lock))
+	}
+
+	rules := alert.NewMemoryStore()
+
+	return rules, alert.NewEvaluator(rules, retriever, webhook, logger, alert.WithInterval(cfg.Interval))
+}
+
+// stopGRPC stops the gRPC server gracefully, but waits no longer than the context before closing the connections.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// authMiddleware returns the middleware authenticating the API requests, or giving every request the default tenant
+// if the authentication is disabled.
+func authMiddleware(cfg config.Auth, authenticator *auth.Authenticator) func(http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return auth.Anonymous(cfg.DefaultTenant)
+	}
+
+	return authenticator.Middleware
+}
+
+// newAuthenticator returns the authenticator of the API keys of the config, and of Redis if enabled.
+func newAuthenticator(cfg config.Auth, redisClient *goredis.Client) *auth.Authenticator {
+	keys := make([]auth.Key, 0, len(cfg.Keys))
+
+	for _, key := range cfg.Keys {
+		scopes := make([]auth.Scope, 0, len(key.Scopes))
+		for _, scope := range key.Scopes {
+			scopes = append(scopes, auth.Scope(scope))
+		}
+
+		keys = append(keys, auth.Key{
+			ID:     key.ID,
+			Secret: key.Secret,
+			Tenant: key.Tenant,
+			Scopes: scopes,
+		})
+	}
+
+	keyStore := auth.ChainKeyStore{auth.NewMemoryKeyStore(keys)}
+
+	if cfg.RedisKeys {
+		keyStore = append(keyStore, auth.NewRedisKeyStore(redisClient, cfg.RedisKeyPrefix))
+	}
+
+	return auth.NewAuthenticator(keyStore, auth.WithMaxSkew(cfg.MaxSkew))
+}
+
+// rateLimits returns the limits of the Track requests of both APIs, with a rule for every non zero limit.
+func rateLimits(cfg config.RateLimit, redisClient *goredis.Client, logger *slog.Logger) *ratelimit.Limits {
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.Backend == "redis" {
+		limiter = ratelimit.NewRedisLimiter(redisClient, cfg.RedisKeyPrefix)
+	}
+
+	var rules []ratelimit.Rule
+
+	for _, rule := range []struct {
+		name  string
+		by    ratelimit.By
+		limit config.Limit
+	}{
+		{"ip", ratelimit.ByIP, cfg.PerIP},
+		{"api_key", ratelimit.ByAPIKey, cfg.PerAPIKey},
+		{"id", ratelimit.ByID, cfg.PerID},
+	} {
+		if rule.limit.Requests == 0 {
+			continue
+		}
+
+		rules = append(rules, ratelimit.Rule{
+			Name: rule.name,
+			By:   rule.by,
+			Rate: ratelimit.Rate{Requests: rule.limit.Requests, Period: rule.limit.Period},
+		})
+	}
+
+	return ratelimit.New(limiter, logger, rules...)
+}
+
+// filterChain returns the chain of the enabled filters, cheapest first, so the dedup only marks the hits kept by the others.
+func filterChain(cfg config.Filter, redisClient *goredis.Client, logger *slog.Logger) (*filter.Chain, error) {
+	var filters []filter.Filter
+
+	if cfg.Bots {
+		filters = append(filters, filter.Bot(append(append([]string{}, filter.DefaultBotUserAgents...), cfg.BotUserAgents...)))
+	}
+
+	if len(cfg.DenyIPs) > 0 {
+		denyIP, err := filter.DenyIP(cfg.DenyIPs)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, denyIP)
+	}
+
+	var counter filter.Counter = filter.NewMemoryCounter()
+	var marker filter.Marker = filter.NewMemoryMarker()
+
+	if cfg.Backend == "redis" {
+		counter = filter.NewRedisCounter(redisClient, cfg.RedisKeyPrefix+"discarded:")
+		marker = filter.NewRedisMarker(redisClient, cfg.RedisKeyPrefix+"dedup:")
+	}
+
+	if cfg.DedupWindow > 0 {
+		filters = append(filters, filter.Dedup(marker, cfg.DedupWindow))
+	}
+
+	return filter.NewChain(counter, logger, filters...), nil
 }
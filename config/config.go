@@ -0,0 +1,636 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of every binary. Each binary only uses the sections it needs.
+//
+// The configuration is loaded from the defaults, then the YAML or TOML file, then the env overrides.
+// A field with the `env` tag can be overridden by the named env variable.
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	Indexer    Indexer    `yaml:"indexer" toml:"indexer"`
+	Queue      Queue      `yaml:"queue" toml:"queue"`
+	Elastic    Elastic    `yaml:"elastic" toml:"elastic"`
+	Redis      Redis      `yaml:"redis" toml:"redis"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Tracing    Tracing    `yaml:"tracing" toml:"tracing"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	Retention  Retention  `yaml:"retention" toml:"retention"`
+	RateLimit  RateLimit  `yaml:"rate_limit" toml:"rate_limit"`
+	Filter     Filter     `yaml:"filter" toml:"filter"`
+	Timestamps Timestamps `yaml:"timestamps" toml:"timestamps"`
+	Live       Live       `yaml:"live" toml:"live"`
+	Alerts     Alerts     `yaml:"alerts" toml:"alerts"`
+	Anomaly    Anomaly    `yaml:"anomaly" toml:"anomaly"`
+	Export     Export     `yaml:"export" toml:"export"`
+	Archive    Archive    `yaml:"archive" toml:"archive"`
+	Erasure    Erasure    `yaml:"erasure" toml:"erasure"`
+}
+
+type Server struct {
+	Port int `yaml:"port" toml:"port" env:"PORT"`
+	// Port of the gRPC API, 0 disables it.
+	GRPCPort        int           `yaml:"grpc_port" toml:"grpc_port" env:"GRPC_PORT"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// Time the server keeps serving once the readiness check fails, before shutting down,
+	// so the load balancers stop routing the new requests to it first.
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay" env:"SERVER_DRAIN_DELAY"`
+}
+
+type Indexer struct {
+	// Number of workers used to index to ElasticSearch.
+	Workers   int `yaml:"workers" toml:"workers" env:"WORKERS"`
+	AdminPort int `yaml:"admin_port" toml:"admin_port" env:"ADMIN_PORT"`
+	// Maximum number of unacked messages fetched from each Redis queue.
+	PrefetchLimit int           `yaml:"prefetch_limit" toml:"prefetch_limit" env:"INDEXER_PREFETCH_LIMIT"`
+	PollInterval  time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"INDEXER_POLL_INTERVAL"`
+}
+
+// Queue is the in-process batching of the server, before the views are sent to Redis.
+type Queue struct {
+	BatchSize     int           `yaml:"batch_size" toml:"batch_size" env:"QUEUE_BATCH_SIZE"`
+	BatchInterval time.Duration `yaml:"batch_interval" toml:"batch_interval" env:"QUEUE_BATCH_INTERVAL"`
+}
+
+type Elastic struct {
+	URL     string        `yaml:"url" toml:"url" env:"ELASTIC_URL"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"ELASTIC_TIMEOUT"`
+	Index   string        `yaml:"index" toml:"index" env:"ELASTIC_INDEX"`
+	// Index of the late views, see timestamps.policy.
+	LateIndex string   `yaml:"late_index" toml:"late_index" env:"ELASTIC_LATE_INDEX"`
+	Shards    int      `yaml:"shards" toml:"shards" env:"ELASTIC_SHARDS"`
+	Replicas  int      `yaml:"replicas" toml:"replicas" env:"ELASTIC_REPLICAS"`
+	Rollover  Rollover `yaml:"rollover" toml:"rollover"`
+	// Only verify the indices exist at start, instead of creating them. They are created by the admin init command.
+	VerifyOnly bool `yaml:"verify_only" toml:"verify_only" env:"ELASTIC_VERIFY_ONLY"`
+}
+
+// Rollover writes the views to time-based indices managed by a lifecycle policy, instead of the single index.
+type Rollover struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"ELASTIC_ROLLOVER_ENABLED"`
+	// The write index is rolled over when it is older than max_age, or larger than max_size, e.g. 50gb, if not empty.
+	MaxAge  time.Duration `yaml:"max_age" toml:"max_age" env:"ELASTIC_ROLLOVER_MAX_AGE"`
+	MaxSize string        `yaml:"max_size" toml:"max_size" env:"ELASTIC_ROLLOVER_MAX_SIZE"`
+	// The indices are deleted once rolled over for retention. Zero keeps them forever.
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"ELASTIC_ROLLOVER_RETENTION"`
+}
+
+type Redis struct {
+	Addr        string `yaml:"addr" toml:"addr" env:"REDIS_ADDR"`
+	DB          int    `yaml:"db" toml:"db" env:"REDIS_DB"`
+	SingleQueue string `yaml:"single_queue" toml:"single_queue" env:"REDIS_SINGLE_QUEUE"`
+	BatchQueue  string `yaml:"batch_queue" toml:"batch_queue" env:"REDIS_BATCH_QUEUE"`
+}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACE_EXPORTER"`
+}
+
+// Auth is the authentication of the analytics API.
+type Auth struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AUTH_ENABLED"`
+	// Tenant of every request when the authentication is disabled.
+	DefaultTenant string `yaml:"default_tenant" toml:"default_tenant" env:"AUTH_DEFAULT_TENANT"`
+	// Maximum difference between the timestamp of a signed request and the server time.
+	MaxSkew time.Duration `yaml:"max_skew" toml:"max_skew" env:"AUTH_MAX_SKEW"`
+	Keys    []APIKey      `yaml:"keys,omitempty" toml:"keys"`
+	// Also look up the keys in Redis, in the hashes <redis_key_prefix><key id>.
+	RedisKeys      bool   `yaml:"redis_keys" toml:"redis_keys" env:"AUTH_REDIS_KEYS"`
+	RedisKeyPrefix string `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"AUTH_REDIS_KEY_PREFIX"`
+}
+
+type APIKey struct {
+	ID     string `yaml:"id" toml:"id"`
+	Secret string `yaml:"secret" toml:"secret"`
+	Tenant string `yaml:"tenant" toml:"tenant"`
+	// read and/or write
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+}
+
+// Retention is how long the views are kept, applied by the indexer. Zero keeps the views forever.
+type Retention struct {
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"RETENTION_INTERVAL"`
+	// Retention of the tenants without their own.
+	Default time.Duration `yaml:"default" toml:"default" env:"RETENTION_DEFAULT"`
+	// Retention of each tenant, overriding the default.
+	Tenants map[string]time.Duration `yaml:"tenants,omitempty" toml:"tenants"`
+}
+
+// RateLimit limits the Track requests of the server, using token buckets.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// memory, the limits are per server replica, or redis, the limits are shared by every replica.
+	Backend        string `yaml:"backend" toml:"backend" env:"RATE_LIMIT_BACKEND"`
+	RedisKeyPrefix string `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"RATE_LIMIT_REDIS_KEY_PREFIX"`
+	// Limits by client IP and by API key, counting the requests, and by hit ID, counting the hits. A zero limit is disabled.
+	PerIP     Limit `yaml:"per_ip" toml:"per_ip"`
+	PerAPIKey Limit `yaml:"per_api_key" toml:"per_api_key"`
+	PerID     Limit `yaml:"per_id" toml:"per_id"`
+}
+
+// Limit allows Requests per Period, with bursts up to Requests.
+type Limit struct {
+	Requests int           `yaml:"requests" toml:"requests"`
+	Period   time.Duration `yaml:"period" toml:"period"`
+}
+
+// Filter discards the bot and duplicate hits before they are tracked by the server.
+type Filter struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"FILTER_ENABLED"`
+	// Discard the hits of the common bots, and of the extra user agent substrings.
+	Bots          bool     `yaml:"bots" toml:"bots" env:"FILTER_BOTS"`
+	BotUserAgents []string `yaml:"bot_user_agents,omitempty" toml:"bot_user_agents" env:"FILTER_BOT_USER_AGENTS"`
+	// Discard the hits from the IPs or CIDR ranges.
+	DenyIPs []string `yaml:"deny_ips,omitempty" toml:"deny_ips" env:"FILTER_DENY_IPS"`
+	// Discard the hits of the same ID from the same client within the window. Zero disables it.
+	DedupWindow time.Duration `yaml:"dedup_window" toml:"dedup_window" env:"FILTER_DEDUP_WINDOW"`
+	// memory, per server replica, or redis, shared by every replica. Used for the dedup and the discarded counts.
+	Backend        string `yaml:"backend" toml:"backend" env:"FILTER_BACKEND"`
+	RedisKeyPrefix string `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"FILTER_REDIS_KEY_PREFIX"`
+}
+
+// Timestamps validates the hit timestamps sent by the clients. The hits without timestamp get the server time.
+type Timestamps struct {
+	MaxPast   time.Duration `yaml:"max_past" toml:"max_past" env:"TIMESTAMPS_MAX_PAST"`
+	MaxFuture time.Duration `yaml:"max_future" toml:"max_future" env:"TIMESTAMPS_MAX_FUTURE"`
+	// reject, clamp or late. Refer to the skew package.
+	Policy string `yaml:"policy" toml:"policy" env:"TIMESTAMPS_POLICY"`
+}
+
+// Live pushes the counts to the subscribers of GET /analytics/{id}/stream, when the indexer indexes new views.
+// It must be enabled on both the indexer, which publishes the indexed views, and the server.
+type Live struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"LIVE_ENABLED"`
+	// Redis pub/sub channel of the indexed views.
+	Channel string `yaml:"channel" toml:"channel" env:"LIVE_CHANNEL"`
+	// Minimum interval between the counts sent to a subscriber.
+	Interval  time.Duration `yaml:"interval" toml:"interval" env:"LIVE_INTERVAL"`
+	Heartbeat time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"LIVE_HEARTBEAT"`
+}
+
+// Alerts serves the alert rules at /alerts, and evaluates them on the server.
+type Alerts struct {
+	Enabled  bool          `yaml:"enabled" toml:"enabled" env:"ALERTS_ENABLED"`
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"ALERTS_INTERVAL"`
+	// memory, the rules are lost on restart, or redis, the rules are shared and evaluated by a single replica.
+	Backend        string `yaml:"backend" toml:"backend" env:"ALERTS_BACKEND"`
+	RedisKeyPrefix string `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"ALERTS_REDIS_KEY_PREFIX"`
+	// Retries of a failed webhook delivery.
+	WebhookRetries int           `yaml:"webhook_retries" toml:"webhook_retries" env:"ALERTS_WEBHOOK_RETRIES"`
+	WebhookTimeout time.Duration `yaml:"webhook_timeout" toml:"webhook_timeout" env:"ALERTS_WEBHOOK_TIMEOUT"`
+	// Allow the webhooks on loopback, private and link-local addresses, e.g. in development.
+	WebhookAllowPrivate bool `yaml:"webhook_allow_private" toml:"webhook_allow_private" env:"ALERTS_WEBHOOK_ALLOW_PRIVATE"`
+}
+
+// Anomaly serves the anomaly score of an ID at GET /analytics/{id}/anomaly. Refer to the anomaly package.
+type Anomaly struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"ANOMALY_ENABLED"`
+	// Number of previous weeks compared.
+	Seasons int `yaml:"seasons" toml:"seasons" env:"ANOMALY_SEASONS"`
+	// Weight of the latest count in the EWMA.
+	Alpha float64 `yaml:"alpha" toml:"alpha" env:"ANOMALY_ALPHA"`
+	// Absolute score from which the count is anomalous.
+	Threshold float64 `yaml:"threshold" toml:"threshold" env:"ANOMALY_THRESHOLD"`
+}
+
+// Export serves the views of an ID as a file at GET /analytics/{id}/export. Refer to the export package.
+type Export struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"EXPORT_ENABLED"`
+	// Number of views read from ElasticSearch at a time.
+	PageSize int `yaml:"page_size" toml:"page_size" env:"EXPORT_PAGE_SIZE"`
+}
+
+// Archive keeps the batches consumed by the indexer in compressed segments, to replay them with the admin replay command.
+// Refer to the archive package.
+type Archive struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"ARCHIVE_ENABLED"`
+	// Directory of the segments, partitioned by hour.
+	Dir string `yaml:"dir" toml:"dir" env:"ARCHIVE_DIR"`
+	// Max age of a segment before it is stored, the batches of a crashed indexer not yet stored are lost.
+	FlushInterval time.Duration `yaml:"flush_interval" toml:"flush_interval" env:"ARCHIVE_FLUSH_INTERVAL"`
+	// Compressed size in megabytes from which a segment is stored.
+	MaxSegmentMB int `yaml:"max_segment_mb" toml:"max_segment_mb" env:"ARCHIVE_MAX_SEGMENT_MB"`
+	// The erasures of the server and the admin commands are serialized by a Redis lock, since they rewrite the segments.
+	RedisKeyPrefix string `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"ARCHIVE_REDIS_KEY_PREFIX"`
+}
+
+// Erasure deletes the views of an ID at DELETE /analytics/{id}, with the delete scope.
+// The streams of the ID are refreshed once deleted, when live is enabled.
+type Erasure struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"ERASURE_ENABLED"`
+	// The tasks are recorded in Redis with their tenant, so a tenant only gets the progress of its own tasks, for the TTL.
+	RedisKeyPrefix string        `yaml:"redis_key_prefix" toml:"redis_key_prefix" env:"ERASURE_REDIS_KEY_PREFIX"`
+	TaskTTL        time.Duration `yaml:"task_ttl" toml:"task_ttl" env:"ERASURE_TASK_TTL"`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8001,
+			GRPCPort:        8003,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			ShutdownTimeout: 60 * time.Second,
+			DrainDelay:      5 * time.Second,
+		},
+		Indexer: Indexer{
+			Workers:       10,
+			AdminPort:     8002,
+			PrefetchLimit: 512,
+			PollInterval:  400 * time.Millisecond,
+		},
+		Queue: Queue{
+			BatchSize:     256,
+			BatchInterval: 3 * time.Second,
+		},
+		Elastic: Elastic{
+			URL:       "http://127.0.0.1:9200",
+			Timeout:   3 * time.Second,
+			Index:     "views",
+			LateIndex: "views_late",
+			Shards:    2,
+			Replicas:  0,
+			Rollover: Rollover{
+				Enabled: false,
+				MaxAge:  24 * time.Hour,
+				MaxSize: "50gb",
+			},
+		},
+		Redis: Redis{
+			Addr:        "127.0.0.1:6379",
+			DB:          0,
+			SingleQueue: "view_single",
+			BatchQueue:  "view_batch",
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+		},
+		Auth: Auth{
+			Enabled:        false,
+			DefaultTenant:  "default",
+			MaxSkew:        5 * time.Minute,
+			RedisKeyPrefix: "apikey:",
+		},
+		Retention: Retention{
+			Interval: time.Hour,
+			Default:  0,
+		},
+		RateLimit: RateLimit{
+			Enabled:        false,
+			Backend:        "memory",
+			RedisKeyPrefix: "ratelimit:",
+			PerIP:          Limit{Requests: 50, Period: time.Second},
+			PerAPIKey:      Limit{Requests: 1000, Period: time.Second},
+			PerID:          Limit{Requests: 10, Period: time.Second},
+		},
+		Filter: Filter{
+			Enabled:        false,
+			Bots:           true,
+			DedupWindow:    30 * time.Second,
+			Backend:        "memory",
+			RedisKeyPrefix: "filter:",
+		},
+		Timestamps: Timestamps{
+			MaxPast:   24 * time.Hour,
+			MaxFuture: 5 * time.Minute,
+			Policy:    "reject",
+		},
+		Live: Live{
+			Enabled:   false,
+			Channel:   "views:indexed",
+			Interval:  time.Second,
+			Heartbeat: 15 * time.Second,
+		},
+		Alerts: Alerts{
+			Enabled:        false,
+			Interval:       time.Minute,
+			Backend:        "memory",
+			RedisKeyPrefix: "alert:",
+			WebhookRetries: 3,
+			WebhookTimeout: 10 * time.Second,
+		},
+		Anomaly: Anomaly{
+			Enabled:   false,
+			Seasons:   4,
+			Alpha:     0.3,
+			Threshold: 3,
+		},
+		Export: Export{
+			Enabled:  false,
+			PageSize: 1000,
+		},
+		Archive: Archive{
+			Enabled:        false,
+			Dir:            "archive",
+			FlushInterval:  time.Minute,
+			MaxSegmentMB:   64,
+			RedisKeyPrefix: "archive:",
+		},
+		Erasure: Erasure{
+			Enabled:        false,
+			RedisKeyPrefix: "erasure:",
+			TaskTTL:        7 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load loads the configuration from the file at path, if not empty, then applies the env overrides and validates it.
+// The file format is chosen by the extension: .yaml, .yml or .toml.
+func Load(path string) (*Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := decodeFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func decodeFile(path string, cfg *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "config file")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+
+		// An empty file is a valid configuration.
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return errors.Wrapf(err, "config file %s", path)
+		}
+
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return errors.Wrapf(err, "config file %s", path)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return errors.Errorf("config file %s: unknown field %s", path, undecoded[0])
+		}
+
+	default:
+		return errors.Errorf("config file %s: unsupported format, must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// Validate returns an error describing every invalid value.
+func (c *Config) Validate() error {
+	var v validator
+
+	v.check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	v.check(c.Server.GRPCPort >= 0 && c.Server.GRPCPort <= 65535, "server.grpc_port must be between 0 and 65535")
+	v.check(c.Server.GRPCPort != c.Server.Port, "server.port and server.grpc_port must be different")
+	v.check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	v.check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	v.check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	v.check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+
+	v.check(c.Indexer.Workers > 0, "indexer.workers must be positive")
+	v.check(c.Indexer.AdminPort > 0 && c.Indexer.AdminPort <= 65535, "indexer.admin_port must be between 1 and 65535")
+	v.check(c.Indexer.PrefetchLimit > 0, "indexer.prefetch_limit must be positive")
+	v.check(c.Indexer.PollInterval > 0, "indexer.poll_interval must be positive")
+
+	v.check(c.Queue.BatchSize > 0, "queue.batch_size must be positive")
+	v.check(c.Queue.BatchInterval > 0, "queue.batch_interval must be positive")
+
+	if u, err := url.Parse(c.Elastic.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		v.add("elastic.url must be an absolute URL, including the protocol")
+	}
+	v.check(c.Elastic.Timeout > 0, "elastic.timeout must be positive")
+	v.check(c.Elastic.Index != "" && c.Elastic.Index == strings.ToLower(c.Elastic.Index), "elastic.index must be a non empty lowercase name")
+	v.check(c.Elastic.LateIndex != "" && c.Elastic.LateIndex == strings.ToLower(c.Elastic.LateIndex), "elastic.late_index must be a non empty lowercase name")
+	v.check(c.Elastic.LateIndex != c.Elastic.Index, "elastic.index and elastic.late_index must be different")
+	v.check(c.Elastic.Shards > 0, "elastic.shards must be positive")
+	v.check(c.Elastic.Replicas >= 0, "elastic.replicas must not be negative")
+
+	if c.Elastic.Rollover.Enabled {
+		v.check(c.Elastic.Rollover.MaxAge >= time.Second, "elastic.rollover.max_age must be at least 1s")
+		v.check(c.Elastic.Rollover.Retention >= 0, "elastic.rollover.retention must not be negative")
+		v.check(!strings.HasPrefix(c.Elastic.LateIndex, c.Elastic.Index+"-"), "elastic.late_index must not start with elastic.index and a dash, the name of the rollover indices")
+	}
+
+	v.check(c.Redis.Addr != "", "redis.addr must be set")
+	v.check(c.Redis.DB >= 0, "redis.db must not be negative")
+	v.check(c.Redis.SingleQueue != "", "redis.single_queue must be set")
+	v.check(c.Redis.BatchQueue != "", "redis.batch_queue must be set")
+	v.check(c.Redis.SingleQueue != c.Redis.BatchQueue, "redis.single_queue and redis.batch_queue must be different")
+
+	v.check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "log.level must be one of debug, info, warn or error")
+	v.check(oneOf(c.Tracing.Exporter, "none", "stdout"), "tracing.exporter must be one of none or stdout")
+
+	v.check(c.Auth.DefaultTenant != "", "auth.default_tenant must be set")
+	v.check(c.Auth.MaxSkew > 0, "auth.max_skew must be positive")
+	v.check(!c.Auth.Enabled || len(c.Auth.Keys) > 0 || c.Auth.RedisKeys, "auth.keys must be set, or auth.redis_keys enabled, when auth is enabled")
+	v.check(!c.Auth.RedisKeys || c.Auth.RedisKeyPrefix != "", "auth.redis_key_prefix must be set when auth.redis_keys is enabled")
+
+	keyIDs := make(map[string]bool, len(c.Auth.Keys))
+
+	for i, key := range c.Auth.Keys {
+		v.check(key.ID != "" && !strings.Contains(key.ID, "."), fmt.Sprintf("auth.keys[%d].id must be set, without dot", i))
+		v.check(!keyIDs[key.ID], fmt.Sprintf("auth.keys[%d].id is duplicated", i))
+		v.check(key.Secret != "", fmt.Sprintf("auth.keys[%d].secret must be set", i))
+		v.check(key.Tenant != "", fmt.Sprintf("auth.keys[%d].tenant must be set", i))
+		v.check(len(key.Scopes) > 0, fmt.Sprintf("auth.keys[%d].scopes must be set", i))
+
+		for _, scope := range key.Scopes {
+			v.check(oneOf(scope, "read", "write", "delete"), fmt.Sprintf("auth.keys[%d].scopes must be read, write or delete", i))
+		}
+
+		keyIDs[key.ID] = true
+	}
+
+	v.check(c.Retention.Interval > 0, "retention.interval must be positive")
+	v.check(c.Retention.Default >= 0, "retention.default must not be negative")
+
+	tenants := make([]string, 0, len(c.Retention.Tenants))
+	for tenant := range c.Retention.Tenants {
+		tenants = append(tenants, tenant)
+	}
+
+	// Sorted, so the error is stable.
+	sort.Strings(tenants)
+
+	for _, tenant := range tenants {
+		v.check(tenant != "", "retention.tenants must not have an empty tenant")
+		v.check(c.Retention.Tenants[tenant] >= 0, fmt.Sprintf("retention.tenants.%s must not be negative", tenant))
+	}
+
+	// The rollover indices are deleted whole, the views of every tenant are gone after the rollover retention.
+	if rollover := c.Elastic.Rollover; rollover.Enabled && rollover.Retention > 0 {
+		for _, tenant := range tenants {
+			retention := c.Retention.Tenants[tenant]
+			v.check(retention > 0 && retention <= rollover.Retention, fmt.Sprintf("retention.tenants.%s must be set and not longer than elastic.rollover.retention", tenant))
+		}
+	}
+
+	v.check(oneOf(c.RateLimit.Backend, "memory", "redis"), "rate_limit.backend must be one of memory or redis")
+	v.check(c.RateLimit.Backend != "redis" || c.RateLimit.RedisKeyPrefix != "", "rate_limit.redis_key_prefix must be set when rate_limit.backend is redis")
+
+	for _, limit := range []struct {
+		name string
+		Limit
+	}{
+		{"per_ip", c.RateLimit.PerIP},
+		{"per_api_key", c.RateLimit.PerAPIKey},
+		{"per_id", c.RateLimit.PerID},
+	} {
+		v.check(limit.Requests >= 0, fmt.Sprintf("rate_limit.%s.requests must not be negative", limit.name))
+		v.check(limit.Requests == 0 || limit.Period >= time.Millisecond, fmt.Sprintf("rate_limit.%s.period must be at least 1ms", limit.name))
+	}
+
+	v.check(c.Filter.DedupWindow >= 0, "filter.dedup_window must not be negative")
+	v.check(oneOf(c.Filter.Backend, "memory", "redis"), "filter.backend must be one of memory or redis")
+	v.check(c.Filter.Backend != "redis" || c.Filter.RedisKeyPrefix != "", "filter.redis_key_prefix must be set when filter.backend is redis")
+
+	for i, ip := range c.Filter.DenyIPs {
+		_, _, err := net.ParseCIDR(ip)
+		v.check(err == nil || net.ParseIP(ip) != nil, fmt.Sprintf("filter.deny_ips[%d] must be an IP or a CIDR range", i))
+	}
+
+	v.check(c.Timestamps.MaxPast > 0, "timestamps.max_past must be positive")
+	v.check(c.Timestamps.MaxFuture >= 0, "timestamps.max_future must not be negative")
+	v.check(oneOf(c.Timestamps.Policy, "reject", "clamp", "late"), "timestamps.policy must be one of reject, clamp or late")
+
+	if c.Live.Enabled {
+		v.check(c.Live.Channel != "", "live.channel must be set")
+		v.check(c.Live.Interval > 0, "live.interval must be positive")
+		v.check(c.Live.Heartbeat > 0, "live.heartbeat must be positive")
+	}
+
+	if c.Alerts.Enabled {
+		v.check(c.Alerts.Interval > 0, "alerts.interval must be positive")
+		v.check(oneOf(c.Alerts.Backend, "memory", "redis"), "alerts.backend must be one of memory or redis")
+		v.check(c.Alerts.Backend != "redis" || c.Alerts.RedisKeyPrefix != "", "alerts.redis_key_prefix must be set when alerts.backend is redis")
+		v.check(c.Alerts.WebhookRetries >= 0, "alerts.webhook_retries must not be negative")
+		v.check(c.Alerts.WebhookTimeout > 0, "alerts.webhook_timeout must be positive")
+	}
+
+	if c.Anomaly.Enabled {
+		// The hourly histogram of every season must fit in the 10000 buckets of a search.
+		v.check(c.Anomaly.Seasons >= 1 && c.Anomaly.Seasons <= 52, "anomaly.seasons must be between 1 and 52")
+		v.check(c.Anomaly.Alpha > 0 && c.Anomaly.Alpha <= 1, "anomaly.alpha must be in (0, 1]")
+		v.check(c.Anomaly.Threshold > 0, "anomaly.threshold must be positive")
+	}
+
+	if c.Export.Enabled {
+		// A page is a search, limited to the max result window of ElasticSearch.
+		v.check(c.Export.PageSize >= 1 && c.Export.PageSize <= 10000, "export.page_size must be between 1 and 10000")
+	}
+
+	if c.Archive.Enabled {
+		v.check(c.Archive.Dir != "", "archive.dir must be set")
+		v.check(c.Archive.FlushInterval > 0 && c.Archive.FlushInterval <= time.Hour, "archive.flush_interval must be between 0 and 1h")
+		v.check(c.Archive.MaxSegmentMB > 0, "archive.max_segment_mb must be positive")
+		v.check(c.Archive.RedisKeyPrefix != "", "archive.redis_key_prefix must be set")
+	}
+
+	if c.Erasure.Enabled {
+		v.check(c.Erasure.RedisKeyPrefix != "", "erasure.redis_key_prefix must be set")
+		v.check(c.Erasure.TaskTTL > 0, "erasure.task_ttl must be positive")
+	}
+
+	return v.err()
+}
+
+// Print writes the configuration as YAML. The secrets are masked.
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+
+	if len(c.Auth.Keys) > 0 {
+		masked.Auth.Keys = make([]APIKey, len(c.Auth.Keys))
+
+		for i, key := range c.Auth.Keys {
+			key.Secret = maskedSecret
+			masked.Auth.Keys[i] = key
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+const maskedSecret = "********"
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, problem string) {
+	if !ok {
+		v.add(problem)
+	}
+}
+
+func (v *validator) add(problem string) {
+	v.problems = append(v.problems, problem)
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return errors.New("invalid config: " + strings.Join(v.problems, "; "))
+}
+
+func oneOf(value string, values ...string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
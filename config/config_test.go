@@ -0,0 +1,394 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "config.yaml")
+	tomlPath := filepath.Join(dir, "config.toml")
+
+	write(t, yamlPath, `
+queue:
+  batch_size: 100
+  batch_interval: 1s
+elastic:
+  index: hits
+`)
+
+	write(t, tomlPath, `
+[queue]
+batch_size = 100
+batch_interval = "1s"
+
+[elastic]
+index = "hits"
+`)
+
+	noEnv := func(string) (string, bool) { return "", false }
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := load(path, noEnv)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, 100, cfg.Queue.BatchSize)
+			assert.Equal(t, time.Second, cfg.Queue.BatchInterval)
+			assert.Equal(t, "hits", cfg.Elastic.Index)
+
+			// Untouched values keep the default.
+			assert.Equal(t, Default().Redis, cfg.Redis)
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"PORT":                 "9000",
+		"ELASTIC_URL":          "http://elastic:9200/",
+		"QUEUE_BATCH_INTERVAL": "500ms",
+	}
+
+	cfg, err := load("", func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 9000, cfg.Server.Port)
+	assert.Equal(t, "http://elastic:9200/", cfg.Elastic.URL)
+	assert.Equal(t, 500*time.Millisecond, cfg.Queue.BatchInterval)
+
+	// Invalid value
+	env["PORT"] = "port"
+
+	_, err = load("", func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	assert.EqualError(t, err, `env PORT: strconv.ParseInt: parsing "port": invalid syntax`)
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	noEnv := func(string) (string, bool) { return "", false }
+
+	unknownPath := filepath.Join(dir, "config.yaml")
+	write(t, unknownPath, "queue:\n  batch_sise: 100\n")
+
+	_, err = load(unknownPath, noEnv)
+	assert.Error(t, err, "unknown field")
+
+	jsonPath := filepath.Join(dir, "config.json")
+	write(t, jsonPath, "{}")
+
+	_, err = load(jsonPath, noEnv)
+	assert.Error(t, err, "unsupported format")
+
+	_, err = load(filepath.Join(dir, "missing.yaml"), noEnv)
+	assert.Error(t, err, "missing file")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.GRPCPort = cfg.Server.Port
+	cfg.Server.DrainDelay = -time.Second
+	cfg.Queue.BatchSize = 0
+	cfg.Elastic.URL = "127.0.0.1:9200"
+	cfg.Redis.BatchQueue = cfg.Redis.SingleQueue
+	cfg.Log.Level = "verbose"
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"server.port and server.grpc_port must be different; "+
+		"server.drain_delay must not be negative; "+
+		"queue.batch_size must be positive; "+
+		"elastic.url must be an absolute URL, including the protocol; "+
+		"redis.single_queue and redis.batch_queue must be different; "+
+		"log.level must be one of debug, info, warn or error")
+}
+
+func TestValidateAuth(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"auth.keys must be set, or auth.redis_keys enabled, when auth is enabled")
+
+	cfg.Auth.Keys = []APIKey{
+		{ID: "web", Secret: "secret", Tenant: "acme", Scopes: []string{"write"}},
+		{ID: "web", Secret: "", Tenant: "acme", Scopes: []string{"admin"}},
+	}
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"auth.keys[1].id is duplicated; "+
+		"auth.keys[1].secret must be set; "+
+		"auth.keys[1].scopes must be read, write or delete")
+}
+
+func TestLoadRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "config.yaml")
+	tomlPath := filepath.Join(dir, "config.toml")
+
+	write(t, yamlPath, `
+retention:
+  default: 720h
+  tenants:
+    acme: 168h
+    globex: 0s
+`)
+
+	write(t, tomlPath, `
+[retention]
+default = "720h"
+
+[retention.tenants]
+acme = "168h"
+globex = "0s"
+`)
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := load(path, func(string) (string, bool) { return "", false })
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, Retention{
+				Interval: time.Hour,
+				Default:  720 * time.Hour,
+				Tenants:  map[string]time.Duration{"acme": 168 * time.Hour, "globex": 0},
+			}, cfg.Retention)
+		})
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	cfg := Default()
+	cfg.Retention.Default = -time.Hour
+	cfg.Retention.Tenants = map[string]time.Duration{"globex": -time.Hour, "acme": -time.Hour}
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"retention.default must not be negative; "+
+		"retention.tenants.acme must not be negative; "+
+		"retention.tenants.globex must not be negative")
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	cfg := Default()
+	cfg.RateLimit.Backend = "memcached"
+	cfg.RateLimit.PerIP = Limit{Requests: -1, Period: time.Second}
+	cfg.RateLimit.PerID = Limit{Requests: 10}
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"rate_limit.backend must be one of memory or redis; "+
+		"rate_limit.per_ip.requests must not be negative; "+
+		"rate_limit.per_id.period must be at least 1ms")
+
+	// A zero limit is disabled.
+	cfg = Default()
+	cfg.RateLimit.PerAPIKey = Limit{}
+
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateFilter(t *testing.T) {
+	cfg := Default()
+	cfg.Filter.DenyIPs = []string{"10.0.0.1", "10.0.0.0/8", "2001:db8::/32", "10.0.0.300"}
+	cfg.Filter.Backend = "redis"
+	cfg.Filter.RedisKeyPrefix = ""
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"filter.redis_key_prefix must be set when filter.backend is redis; "+
+		"filter.deny_ips[3] must be an IP or a CIDR range")
+}
+
+func TestValidateTimestamps(t *testing.T) {
+	cfg := Default()
+	cfg.Elastic.LateIndex = cfg.Elastic.Index
+	cfg.Timestamps.MaxPast = 0
+	cfg.Timestamps.Policy = "drop"
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"elastic.index and elastic.late_index must be different; "+
+		"timestamps.max_past must be positive; "+
+		"timestamps.policy must be one of reject, clamp or late")
+}
+
+func TestValidateRollover(t *testing.T) {
+	cfg := Default()
+	cfg.Elastic.LateIndex = "views-late"
+	cfg.Elastic.Rollover.Retention = 7 * 24 * time.Hour
+	cfg.Retention.Tenants = map[string]time.Duration{"acme": 24 * time.Hour, "globex": 30 * 24 * time.Hour}
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Elastic.Rollover.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"elastic.late_index must not start with elastic.index and a dash, the name of the rollover indices; "+
+		"retention.tenants.globex must be set and not longer than elastic.rollover.retention")
+}
+
+func TestValidateLive(t *testing.T) {
+	cfg := Default()
+	cfg.Live.Channel = ""
+	cfg.Live.Interval = 0
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Live.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"live.channel must be set; "+
+		"live.interval must be positive")
+}
+
+func TestValidateAlerts(t *testing.T) {
+	cfg := Default()
+	cfg.Alerts.Backend = "etcd"
+	cfg.Alerts.WebhookTimeout = 0
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Alerts.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"alerts.backend must be one of memory or redis; "+
+		"alerts.webhook_timeout must be positive")
+
+	cfg.Alerts.Backend = "redis"
+	cfg.Alerts.RedisKeyPrefix = ""
+	cfg.Alerts.WebhookTimeout = time.Second
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"alerts.redis_key_prefix must be set when alerts.backend is redis")
+}
+
+func TestValidateAnomaly(t *testing.T) {
+	cfg := Default()
+	cfg.Anomaly.Seasons = 60
+	cfg.Anomaly.Alpha = 0
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Anomaly.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"anomaly.seasons must be between 1 and 52; "+
+		"anomaly.alpha must be in (0, 1]")
+}
+
+func TestValidateExport(t *testing.T) {
+	cfg := Default()
+	cfg.Export.PageSize = 0
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Export.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: export.page_size must be between 1 and 10000")
+}
+
+func TestValidateArchive(t *testing.T) {
+	cfg := Default()
+	cfg.Archive.Dir = ""
+	cfg.Archive.FlushInterval = 2 * time.Hour
+	cfg.Archive.RedisKeyPrefix = ""
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Archive.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"archive.dir must be set; "+
+		"archive.flush_interval must be between 0 and 1h; "+
+		"archive.redis_key_prefix must be set")
+}
+
+func TestValidateErasure(t *testing.T) {
+	cfg := Default()
+	cfg.Erasure.RedisKeyPrefix = ""
+	cfg.Erasure.TaskTTL = 0
+
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Erasure.Enabled = true
+
+	assert.EqualError(t, cfg.Validate(), "invalid config: "+
+		"erasure.redis_key_prefix must be set; "+
+		"erasure.task_ttl must be positive")
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.Keys = []APIKey{
+		{ID: "web", Secret: "s3cret", Tenant: "acme", Scopes: []string{"write"}},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, cfg.Print(buf))
+
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), maskedSecret)
+
+	// The config itself is not modified.
+	assert.Equal(t, "s3cret", cfg.Auth.Keys[0].Secret)
+}
+
+func TestPrint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Default().Print(buf))
+
+	// The printed config can be loaded back.
+	path := filepath.Join(dir, "config.yaml")
+	write(t, path, buf.String())
+
+	cfg, err := load(path, func(string) (string, bool) { return "", false })
+	if assert.NoError(t, err) {
+		assert.Equal(t, Default(), cfg)
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
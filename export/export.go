@@ -0,0 +1,182 @@
+// Package export streams the views of an ID, or their counts per interval, as CSV, NDJSON or Parquet.
+// The views are read a page at a time and written as they are read, so an export never holds them all in memory.
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// Kind is what is exported.
+type Kind string
+
+const (
+	// Hits exports every view, with its timestamp.
+	Hits Kind = "hits"
+	// Buckets exports the count of the views per interval.
+	Buckets Kind = "buckets"
+)
+
+// ParseKind returns the kind of the name, hits or buckets.
+func ParseKind(name string) (Kind, error) {
+	switch k := Kind(name); k {
+	case Hits, Buckets:
+		return k, nil
+	default:
+		return "", errors.Errorf("unknown kind %q, must be hits or buckets", name)
+	}
+}
+
+type Exporter struct {
+	retriever store.ViewRetriever
+
+	pageSize        int
+	bucketsPerQuery int
+}
+
+type Option func(*Exporter)
+
+// WithPageSize sets the number of views read at a time. Default is 1000.
+func WithPageSize(size int) func(*Exporter) {
+	return func(e *Exporter) {
+		e.pageSize = size
+	}
+}
+
+func NewExporter(retriever store.ViewRetriever, opts ...Option) *Exporter {
+	e := &Exporter{
+		retriever:       retriever,
+		pageSize:        1000,
+		bucketsPerQuery: 1000,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Hits writes the views of the query to w in the format, in order of time, and returns their number.
+// The Size and After of the query are ignored.
+func (e *Exporter) Hits(ctx context.Context, w io.Writer, f Format, q store.HitQuery) (int64, error) {
+	if !q.To.After(q.From) {
+		return 0, errors.New("to must be after from")
+	}
+
+	out, err := newWriter(w, f, hitHeader, hitRow.record)
+	if err != nil {
+		return 0, err
+	}
+
+	q.Size = e.pageSize
+	q.After = ""
+
+	var n int64
+
+	for {
+		page, err := e.retriever.Hits(ctx, q)
+		if err != nil {
+			return n, err
+		}
+
+		rows := make([]hitRow, len(page.Hits))
+		for i, hit := range page.Hits {
+			rows[i] = hitRow{Tenant: hit.Tenant, ID: hit.ID, Timestamp: hit.Timestamp.UTC()}
+		}
+
+		if err := out.write(rows); err != nil {
+			return n, err
+		}
+
+		n += int64(len(rows))
+
+		if err := flush(w, out); err != nil {
+			return n, err
+		}
+
+		if page.Next == "" {
+			break
+		}
+
+		q.After = page.Next
+	}
+
+	return n, out.close()
+}
+
+// Buckets writes the counts of the query to w in the format, including the empty buckets, and returns their number.
+// The histogram is read a range of buckets at a time, so the range can be longer than a histogram allows.
+func (e *Exporter) Buckets(ctx context.Context, w io.Writer, f Format, q store.HistogramQuery) (int64, error) {
+	if q.Interval <= 0 {
+		return 0, errors.New("interval must be positive")
+	}
+
+	if !q.To.After(q.From) {
+		return 0, errors.New("to must be after from")
+	}
+
+	out, err := newWriter(w, f, bucketHeader, bucketRow.record)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	// Align the ranges on the interval, as the buckets are.
+	for from := q.From.Truncate(q.Interval); from.Before(q.To); {
+		to := from.Add(time.Duration(e.bucketsPerQuery) * q.Interval)
+		if to.After(q.To) {
+			to = q.To
+		}
+
+		buckets, err := e.retriever.Histogram(ctx, store.HistogramQuery{
+			Tenant:   q.Tenant,
+			ID:       q.ID,
+			Interval: q.Interval,
+			From:     from,
+			To:       to,
+		})
+		if err != nil {
+			return n, err
+		}
+
+		rows := make([]bucketRow, len(buckets))
+		for i, bucket := range buckets {
+			rows[i] = bucketRow{Timestamp: bucket.Timestamp.UTC(), Count: bucket.Count}
+		}
+
+		if err := out.write(rows); err != nil {
+			return n, err
+		}
+
+		n += int64(len(rows))
+
+		if err := flush(w, out); err != nil {
+			return n, err
+		}
+
+		from = to
+	}
+
+	return n, out.close()
+}
+
+// flush writes the buffered rows, and sends them to the client if w is an HTTP response.
+func flush[T any](w io.Writer, out writer[T]) error {
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
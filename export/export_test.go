@@ -0,0 +1,154 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var from = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pagedRetriever returns the views in pages of 2.
+func pagedRetriever(t *testing.T, views []store.ViewTrack) *mock.ViewRetriever {
+	return &mock.ViewRetriever{
+		OnHits: func(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+			assert.Equal(t, "acme", q.Tenant)
+			assert.Equal(t, "1", q.ID)
+			assert.Equal(t, 2, q.Size)
+
+			start := 0
+			if q.After != "" {
+				start = int(q.After[0] - '0')
+			}
+
+			end := start + q.Size
+			if end >= len(views) {
+				return store.HitPage{Hits: views[start:]}, nil
+			}
+
+			return store.HitPage{Hits: views[start:end], Next: string(rune('0' + end))}, nil
+		},
+	}
+}
+
+func TestHitsCSV(t *testing.T) {
+	views := []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: from},
+		{Tenant: "acme", ID: "1", Timestamp: from.Add(time.Second)},
+		{Tenant: "acme", ID: "1", Timestamp: from.Add(1500 * time.Millisecond)},
+	}
+
+	e := NewExporter(pagedRetriever(t, views), WithPageSize(2))
+
+	var buf bytes.Buffer
+
+	n, err := e.Hits(context.Background(), &buf, CSV, store.HitQuery{Tenant: "acme", ID: "1", From: from, To: from.Add(time.Hour)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, "tenant,id,timestamp\n"+
+		"acme,1,2020-01-01T00:00:00Z\n"+
+		"acme,1,2020-01-01T00:00:01Z\n"+
+		"acme,1,2020-01-01T00:00:01.5Z\n", buf.String())
+
+	_, err = e.Hits(context.Background(), &buf, CSV, store.HitQuery{Tenant: "acme", ID: "1", From: from, To: from})
+	assert.EqualError(t, err, "to must be after from")
+}
+
+func TestHitsParquet(t *testing.T) {
+	views := []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: from},
+		{Tenant: "acme", ID: "1", Timestamp: from.Add(time.Second)},
+		{Tenant: "acme", ID: "1", Timestamp: from.Add(2 * time.Second)},
+	}
+
+	e := NewExporter(pagedRetriever(t, views), WithPageSize(2))
+
+	var buf bytes.Buffer
+
+	_, err := e.Hits(context.Background(), &buf, Parquet, store.HitQuery{Tenant: "acme", ID: "1", From: from, To: from.Add(time.Hour)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rows, err := parquet.Read[hitRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, rows, 3) {
+		for i, row := range rows {
+			assert.Equal(t, "acme", row.Tenant)
+			assert.Equal(t, "1", row.ID)
+			assert.True(t, views[i].Timestamp.Equal(row.Timestamp), "row %d", i)
+		}
+	}
+}
+
+func TestBucketsNDJSON(t *testing.T) {
+	var queries []store.HistogramQuery
+
+	retriever := &mock.ViewRetriever{
+		OnHistogram: func(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+			queries = append(queries, q)
+
+			var buckets []store.Bucket
+			for ts := q.From; ts.Before(q.To); ts = ts.Add(q.Interval) {
+				buckets = append(buckets, store.Bucket{Timestamp: ts, Count: int64(ts.Hour())})
+			}
+
+			return buckets, nil
+		},
+	}
+
+	e := NewExporter(retriever)
+	e.bucketsPerQuery = 2
+
+	var buf bytes.Buffer
+
+	// From is aligned on the interval, and the range is read 2 buckets at a time.
+	n, err := e.Buckets(context.Background(), &buf, NDJSON, store.HistogramQuery{
+		Tenant:   "acme",
+		ID:       "1",
+		Interval: time.Hour,
+		From:     from.Add(30 * time.Minute),
+		To:       from.Add(3 * time.Hour),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, `{"timestamp":"2020-01-01T00:00:00Z","count":0}
+{"timestamp":"2020-01-01T01:00:00Z","count":1}
+{"timestamp":"2020-01-01T02:00:00Z","count":2}
+`, buf.String())
+
+	if assert.Len(t, queries, 2) {
+		assert.Equal(t, from, queries[0].From)
+		assert.Equal(t, from.Add(2*time.Hour), queries[0].To)
+		assert.Equal(t, from.Add(2*time.Hour), queries[1].From)
+		assert.Equal(t, from.Add(3*time.Hour), queries[1].To)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, Parquet, f)
+
+	_, err = ParseFormat("xlsx")
+	assert.Error(t, err)
+
+	_, err = ParseKind("views")
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+)
+
+// Format is the file format of an export.
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+	// Parquet files are written in row groups of parquetRowGroupSize rows, the footer is written last.
+	Parquet Format = "parquet"
+)
+
+// parquetRowGroupSize is the number of rows buffered by the Parquet writer before they are written.
+const parquetRowGroupSize = 100000
+
+// ParseFormat returns the format of the name, csv, ndjson or parquet.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case CSV, NDJSON, Parquet:
+		return f, nil
+	default:
+		return "", errors.Errorf("unknown format %q, must be csv, ndjson or parquet", name)
+	}
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+var hitHeader = []string{"tenant", "id", "timestamp"}
+
+type hitRow struct {
+	Tenant    string    `json:"tenant" parquet:"tenant"`
+	ID        string    `json:"id" parquet:"id"`
+	Timestamp time.Time `json:"timestamp" parquet:"timestamp,timestamp(millisecond)"`
+}
+
+func (r hitRow) record() []string {
+	return []string{r.Tenant, r.ID, r.Timestamp.Format(time.RFC3339Nano)}
+}
+
+var bucketHeader = []string{"timestamp", "count"}
+
+type bucketRow struct {
+	Timestamp time.Time `json:"timestamp" parquet:"timestamp,timestamp(millisecond)"`
+	Count     int64     `json:"count" parquet:"count"`
+}
+
+func (r bucketRow) record() []string {
+	return []string{r.Timestamp.Format(time.RFC3339Nano), strconv.FormatInt(r.Count, 10)}
+}
+
+// writer writes the rows of an export in a format.
+type writer[T any] interface {
+	write(rows []T) error
+	// flush writes the buffered rows, except the Parquet row group which is only written once full.
+	flush() error
+	// close writes the remaining rows, and the Parquet footer. It does not close the io.Writer.
+	close() error
+}
+
+// newWriter returns the writer of the format. The CSV records are the header, then the record of each row.
+func newWriter[T any](w io.Writer, f Format, header []string, record func(T) []string) (writer[T], error) {
+	switch f {
+	case CSV:
+		out := &csvWriter[T]{w: csv.NewWriter(w), record: record}
+
+		return out, out.w.Write(header)
+	case NDJSON:
+		bw := bufio.NewWriter(w)
+
+		return &ndjsonWriter[T]{w: bw, enc: json.NewEncoder(bw)}, nil
+	case Parquet:
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))}, nil
+	default:
+		return nil, errors.Errorf("unknown format %q", f)
+	}
+}
+
+type csvWriter[T any] struct {
+	w      *csv.Writer
+	record func(T) []string
+}
+
+func (c *csvWriter[T]) write(rows []T) error {
+	for _, row := range rows {
+		if err := c.w.Write(c.record(row)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *csvWriter[T]) flush() error {
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvWriter[T]) close() error {
+	return c.flush()
+}
+
+type ndjsonWriter[T any] struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) write(rows []T) error {
+	for _, row := range rows {
+		if err := n.enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *ndjsonWriter[T]) flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter[T]) close() error {
+	return n.flush()
+}
+
+type parquetWriter[T any] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (p *parquetWriter[T]) write(rows []T) error {
+	_, err := p.w.Write(rows)
+
+	return err
+}
+
+func (p *parquetWriter[T]) flush() error {
+	return nil
+}
+
+func (p *parquetWriter[T]) close() error {
+	return p.w.Close()
+}
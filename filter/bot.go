@@ -0,0 +1,47 @@
+package filter
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultBotUserAgents are the user agent substrings of the common crawlers, HTTP libraries and link previews.
+// The Go-http-client user agent is not one of them: the Go backends tracking the hits of their visitors use it,
+// the client package sends its own.
+var DefaultBotUserAgents = []string{
+	"bot",
+	"crawler",
+	"spider",
+	"slurp",
+	"headless",
+	"lighthouse",
+	"facebookexternalhit",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"java/",
+}
+
+// Bot discards the hits with a user agent containing any of the substrings, case insensitive.
+// The hits without a user agent are discarded too, browsers always send one.
+func Bot(userAgents []string) Filter {
+	patterns := make([]string, 0, len(userAgents))
+	for _, ua := range userAgents {
+		patterns = append(patterns, strings.ToLower(ua))
+	}
+
+	return FilterFunc(func(ctx context.Context, hit Hit) (Reason, error) {
+		ua := strings.ToLower(hit.UserAgent)
+		if ua == "" {
+			return ReasonBot, nil
+		}
+
+		for _, pattern := range patterns {
+			if strings.Contains(ua, pattern) {
+				return ReasonBot, nil
+			}
+		}
+
+		return "", nil
+	})
+}
@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+// Counter counts the discarded hits by tenant and reason.
+type Counter interface {
+	Incr(ctx context.Context, tenant string, reason Reason) error
+
+	Counts(ctx context.Context, tenant string) (map[Reason]int64, error)
+}
+
+var _ Counter = (*MemoryCounter)(nil)
+
+// MemoryCounter counts in memory, so the counts are per server replica and lost on restart.
+type MemoryCounter struct {
+	mu     sync.Mutex
+	counts map[string]map[Reason]int64
+}
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		counts: make(map[string]map[Reason]int64),
+	}
+}
+
+func (c *MemoryCounter) Incr(ctx context.Context, tenant string, reason Reason) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[tenant] == nil {
+		c.counts[tenant] = make(map[Reason]int64)
+	}
+
+	c.counts[tenant][reason]++
+
+	return nil
+}
+
+func (c *MemoryCounter) Counts(ctx context.Context, tenant string) (map[Reason]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[Reason]int64, len(c.counts[tenant]))
+	for reason, count := range c.counts[tenant] {
+		counts[reason] = count
+	}
+
+	return counts, nil
+}
+
+var _ Counter = (*RedisCounter)(nil)
+
+// RedisCounter counts in the Redis hashes <prefix><tenant>, one field per reason.
+type RedisCounter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisCounter(client *redis.Client, prefix string) *RedisCounter {
+	return &RedisCounter{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (c *RedisCounter) Incr(ctx context.Context, tenant string, reason Reason) error {
+	return errors.Wrap(c.client.HIncrBy(c.prefix+tenant, string(reason), 1).Err(), "redis")
+}
+
+func (c *RedisCounter) Counts(ctx context.Context, tenant string) (map[Reason]int64, error) {
+	values, err := c.client.HGetAllMap(c.prefix + tenant).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "redis")
+	}
+
+	counts := make(map[Reason]int64, len(values))
+
+	for reason, value := range values {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "count of %s", reason)
+		}
+
+		counts[Reason(reason)] = count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,158 @@
+package filter
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+// Marker remembers the keys for a while.
+type Marker interface {
+	// Mark returns true if the key is not marked yet, and marks it for the TTL.
+	Mark(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Unmark forgets the key.
+	Unmark(ctx context.Context, key string) error
+}
+
+var _ Forgetter = (*dedup)(nil)
+
+type dedup struct {
+	marker Marker
+	window time.Duration
+}
+
+// Dedup discards the hits of the same ID, from the same client, within the window.
+// The client is identified by the tenant, IP and user agent. The hits sent with their own time, e.g. a batch
+// buffered offline, are only duplicates of the hits with the same time.
+//
+// A kept hit is marked before it is tracked, so the concurrent duplicates are discarded.
+// If the tracking fails, Chain.Forget unmarks it, so the retry of the client is counted.
+func Dedup(marker Marker, window time.Duration) Filter {
+	return &dedup{
+		marker: marker,
+		window: window,
+	}
+}
+
+func (d *dedup) Filter(ctx context.Context, hit Hit) (Reason, error) {
+	first, err := d.marker.Mark(ctx, dedupKey(hit), d.window)
+	if err != nil {
+		return "", err
+	}
+
+	if !first {
+		return ReasonDuplicate, nil
+	}
+
+	return "", nil
+}
+
+func (d *dedup) Forget(ctx context.Context, hit Hit) error {
+	return d.marker.Unmark(ctx, dedupKey(hit))
+}
+
+// dedupKey hashes the hit client and ID, so the keys have a bounded size.
+func dedupKey(hit Hit) string {
+	h := sha1.New()
+
+	for _, s := range []string{hit.View.Tenant, hit.View.ID, hit.ClientIP, hit.UserAgent} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	if hit.Timestamped {
+		h.Write([]byte(strconv.FormatInt(hit.View.Timestamp.UnixNano(), 10)))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var _ Marker = (*MemoryMarker)(nil)
+
+// MemoryMarker keeps the keys in memory, so the duplicates are only detected per server replica.
+type MemoryMarker struct {
+	mu        sync.Mutex
+	expiry    map[string]time.Time
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// The expired keys are deleted at this interval.
+const sweepInterval = time.Minute
+
+func NewMemoryMarker() *MemoryMarker {
+	return &MemoryMarker{
+		expiry: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (m *MemoryMarker) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, expiry := range m.expiry {
+			if !now.Before(expiry) {
+				delete(m.expiry, k)
+			}
+		}
+
+		m.lastSweep = now
+	}
+
+	if expiry, ok := m.expiry[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+
+	m.expiry[key] = now.Add(ttl)
+
+	return true, nil
+}
+
+func (m *MemoryMarker) Unmark(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.expiry, key)
+
+	return nil
+}
+
+var _ Marker = (*RedisMarker)(nil)
+
+// RedisMarker keeps the keys in Redis using SETNX, so the duplicates are detected across the server replicas.
+type RedisMarker struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisMarker creates the marker. The keys are stored as <prefix><key>.
+func NewRedisMarker(client *redis.Client, prefix string) *RedisMarker {
+	return &RedisMarker{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (m *RedisMarker) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	first, err := m.client.SetNX(m.prefix+key, "1", ttl).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "redis")
+	}
+
+	return first, nil
+}
+
+func (m *RedisMarker) Unmark(ctx context.Context, key string) error {
+	return errors.Wrap(m.client.Del(m.prefix+key).Err(), "redis")
+}
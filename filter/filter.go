@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+// Reason is why a hit is discarded. Empty keeps the hit.
+type Reason string
+
+const (
+	ReasonBot       Reason = "bot"
+	ReasonDeniedIP  Reason = "denied_ip"
+	ReasonDuplicate Reason = "duplicate"
+)
+
+// Hit is a view with the request details used by the filters.
+type Hit struct {
+	View      store.ViewTrack
+	UserAgent string
+	ClientIP  string
+	// Timestamped is set when the client sent the time of the view, e.g. a hit buffered offline.
+	Timestamped bool
+}
+
+// NewHit returns the hit of the view tracked by the request.
+// The client IP is taken from the remote address, use chi's middleware.RealIP before if the server is behind a trusted proxy.
+func NewHit(r *http.Request, view store.ViewTrack) Hit {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return Hit{
+		View:      view,
+		UserAgent: r.UserAgent(),
+		ClientIP:  ip,
+	}
+}
+
+// Filter decides if a hit is counted.
+type Filter interface {
+	// Filter returns the reason to discard the hit, or empty to keep it.
+	Filter(ctx context.Context, hit Hit) (Reason, error)
+}
+
+// Forgetter is implemented by the filters remembering the kept hits, e.g. Dedup.
+type Forgetter interface {
+	// Forget forgets a kept hit, e.g. that failed to be tracked, so it is not discarded when retried.
+	Forget(ctx context.Context, hit Hit) error
+}
+
+// FilterFunc is a helper type to implement Filter interface.
+type FilterFunc func(ctx context.Context, hit Hit) (Reason, error)
+
+func (f FilterFunc) Filter(ctx context.Context, hit Hit) (Reason, error) {
+	return f(ctx, hit)
+}
+
+// Chain runs the filters in order, until one discards the hit. The discarded hits are counted by tenant and reason.
+//
+// A failing filter keeps the hit, since a hit counted twice is better than a hit lost.
+type Chain struct {
+	filters []Filter
+	counter Counter
+	logger  *slog.Logger
+}
+
+// NewChain creates the chain. The logger can be nil.
+func NewChain(counter Counter, logger *slog.Logger, filters ...Filter) *Chain {
+	return &Chain{
+		filters: filters,
+		counter: counter,
+		logger:  logging.OrDiscard(logger),
+	}
+}
+
+// Keep returns true if the hit should be counted.
+func (c *Chain) Keep(ctx context.Context, hit Hit) bool {
+	for _, f := range c.filters {
+		reason, err := f.Filter(ctx, hit)
+		if err != nil {
+			logging.FromContext(ctx, c.logger).Error("filter hit", slog.String("id", hit.View.ID), logging.Error(err))
+			continue
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		if err := c.counter.Incr(ctx, hit.View.Tenant, reason); err != nil {
+			logging.FromContext(ctx, c.logger).Error("count discarded hit", slog.String("reason", string(reason)), logging.Error(err))
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Forget forgets the kept hits in the filters remembering them, once they failed to be tracked,
+// so their retries are not discarded as duplicates.
+func (c *Chain) Forget(ctx context.Context, hits ...Hit) {
+	for _, f := range c.filters {
+		forgetter, ok := f.(Forgetter)
+		if !ok {
+			continue
+		}
+
+		for _, hit := range hits {
+			if err := forgetter.Forget(ctx, hit); err != nil {
+				logging.FromContext(ctx, c.logger).Error("forget hit", slog.String("id", hit.View.ID), logging.Error(err))
+			}
+		}
+	}
+}
+
+// Discarded returns the number of discarded hits of the tenant, by reason.
+func (c *Chain) Discarded(ctx context.Context, tenant string) (map[Reason]int64, error) {
+	return c.counter.Counts(ctx, tenant)
+}
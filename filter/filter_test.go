@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const browserUA = "Mozilla/5.0 (X11; Linux x86_64; rv:68.0) Gecko/20100101 Firefox/68.0"
+
+func TestNewHit(t *testing.T) {
+	r := httptest.NewRequest("POST", "/analytics", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", browserUA)
+
+	view := store.ViewTrack{Tenant: "acme", ID: "1"}
+
+	assert.Equal(t, Hit{View: view, UserAgent: browserUA, ClientIP: "10.0.0.1"}, NewHit(r, view))
+}
+
+func TestBot(t *testing.T) {
+	f := Bot(DefaultBotUserAgents)
+
+	tests := map[string]Reason{
+		browserUA: "",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": ReasonBot,
+		"curl/7.68.0":          ReasonBot,
+		"Python-Requests/2.22": ReasonBot,
+		"":                     ReasonBot,
+	}
+
+	for ua, want := range tests {
+		reason, err := f.Filter(context.Background(), Hit{UserAgent: ua})
+		assert.NoError(t, err)
+		assert.Equal(t, want, reason, ua)
+	}
+}
+
+func TestDenyIP(t *testing.T) {
+	_, err := DenyIP([]string{"10.0.0.300"})
+	assert.Error(t, err)
+
+	f, err := DenyIP([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := map[string]Reason{
+		"10.1.2.3":    ReasonDeniedIP,
+		"192.168.1.1": ReasonDeniedIP,
+		"192.168.1.2": "",
+		"2001:db8::1": ReasonDeniedIP,
+		"2001:db8::2": "",
+		"unknown":     "",
+	}
+
+	for ip, want := range tests {
+		reason, err := f.Filter(context.Background(), Hit{ClientIP: ip})
+		assert.NoError(t, err)
+		assert.Equal(t, want, reason, ip)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	filter := func(name string, reason Reason, err error) Filter {
+		return FilterFunc(func(ctx context.Context, hit Hit) (Reason, error) {
+			calls = append(calls, name)
+			return reason, err
+		})
+	}
+
+	counter := NewMemoryCounter()
+	hit := Hit{View: store.ViewTrack{Tenant: "acme", ID: "1"}}
+
+	chain := NewChain(counter, nil,
+		filter("failing", ReasonBot, errors.New("unavailable")),
+		filter("keep", "", nil),
+		filter("duplicate", ReasonDuplicate, nil),
+		filter("never", ReasonBot, nil),
+	)
+
+	assert.False(t, chain.Keep(context.Background(), hit))
+
+	// The failing filter keeps the hit, and the chain stops at the first discard.
+	assert.Equal(t, []string{"failing", "keep", "duplicate"}, calls)
+
+	discarded, err := chain.Discarded(context.Background(), "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, map[Reason]int64{ReasonDuplicate: 1}, discarded)
+
+	assert.True(t, NewChain(counter, nil, filter("keep", "", nil)).Keep(context.Background(), hit))
+	assert.True(t, NewChain(counter, nil).Keep(context.Background(), hit), "no filter")
+}
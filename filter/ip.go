@@ -0,0 +1,46 @@
+package filter
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DenyIP discards the hits from the IPs or CIDR ranges, e.g. 10.0.0.1 or 10.0.0.0/8.
+func DenyIP(denylist []string) (Filter, error) {
+	nets := make([]*net.IPNet, 0, len(denylist))
+
+	for _, item := range denylist {
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "deny ip %s", item)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return FilterFunc(func(ctx context.Context, hit Hit) (Reason, error) {
+		ip := net.ParseIP(hit.ClientIP)
+		if ip == nil {
+			return "", nil
+		}
+
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return ReasonDeniedIP, nil
+			}
+		}
+
+		return "", nil
+	}), nil
+}
@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+// testDedup runs the same scenario on every marker, with a window of one minute.
+func testDedup(t *testing.T, marker Marker, advance func(time.Duration)) {
+	f := Dedup(marker, time.Minute)
+
+	hit := Hit{View: store.ViewTrack{Tenant: "acme", ID: "1"}, ClientIP: "10.0.0.1", UserAgent: browserUA}
+
+	filter := func(hit Hit) Reason {
+		reason, err := f.Filter(context.Background(), hit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return reason
+	}
+
+	assert.Equal(t, Reason(""), filter(hit))
+	assert.Equal(t, ReasonDuplicate, filter(hit))
+
+	// A forgotten hit, e.g. failed to be tracked, is kept again.
+	assert.NoError(t, f.(Forgetter).Forget(context.Background(), hit))
+	assert.Equal(t, Reason(""), filter(hit))
+	assert.Equal(t, ReasonDuplicate, filter(hit))
+
+	// Another client, or another ID, or another tenant.
+	other := hit
+	other.ClientIP = "10.0.0.2"
+	assert.Equal(t, Reason(""), filter(other))
+
+	other = hit
+	other.View.ID = "2"
+	assert.Equal(t, Reason(""), filter(other))
+
+	other = hit
+	other.View.Tenant = "globex"
+	assert.Equal(t, Reason(""), filter(other))
+
+	// The hits sent with their own time, e.g. buffered offline, are only duplicates with the same time.
+	timestamped := hit
+	timestamped.Timestamped = true
+	timestamped.View.Timestamp = time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, Reason(""), filter(timestamped))
+	assert.Equal(t, ReasonDuplicate, filter(timestamped))
+
+	timestamped.View.Timestamp = timestamped.View.Timestamp.Add(time.Second)
+	assert.Equal(t, Reason(""), filter(timestamped))
+
+	advance(time.Minute)
+
+	assert.Equal(t, Reason(""), filter(hit), "window is over")
+}
+
+func TestMemoryMarker(t *testing.T) {
+	now := time.Now()
+
+	marker := NewMemoryMarker()
+	marker.now = func() time.Time { return now }
+
+	testDedup(t, marker, func(d time.Duration) {
+		now = now.Add(d)
+	})
+
+	// The expired keys are deleted.
+	now = now.Add(sweepInterval)
+	marker.Mark(context.Background(), "new", time.Minute)
+
+	assert.Len(t, marker.expiry, 1)
+}
+
+func TestRedisMarker(t *testing.T) {
+	s, client := runRedis(t)
+	defer s.Close()
+	defer client.Close()
+
+	testDedup(t, NewRedisMarker(client, "dedup:"), s.FastForward)
+}
+
+func TestCounters(t *testing.T) {
+	s, client := runRedis(t)
+	defer s.Close()
+	defer client.Close()
+
+	for name, counter := range map[string]Counter{
+		"memory": NewMemoryCounter(),
+		"redis":  NewRedisCounter(client, "discarded:"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			assert.NoError(t, counter.Incr(ctx, "acme", ReasonBot))
+			assert.NoError(t, counter.Incr(ctx, "acme", ReasonBot))
+			assert.NoError(t, counter.Incr(ctx, "acme", ReasonDuplicate))
+			assert.NoError(t, counter.Incr(ctx, "globex", ReasonDeniedIP))
+
+			counts, err := counter.Counts(ctx, "acme")
+			assert.NoError(t, err)
+			assert.Equal(t, map[Reason]int64{ReasonBot: 2, ReasonDuplicate: 1}, counts)
+
+			counts, err = counter.Counts(ctx, "initech")
+			assert.NoError(t, err)
+			assert.Empty(t, counts)
+		})
+	}
+}
+
+func runRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
@@ -1,20 +1,57 @@
 module github.com/ahmadmuzakkir/redis-elasticsearch-go-example
 
-go 1.13
+go 1.26.0
 
 require (
-	github.com/adjust/gocheck v0.0.0-20131111155431-fbc315b36e0e // indirect
+	github.com/BurntSushi/toml v1.5.0
 	github.com/adjust/rmq v1.0.0
-	github.com/adjust/uniuri v0.0.0-20130923163420-498743145e60 // indirect
-	github.com/garyburd/redigo v1.6.0 // indirect
+	github.com/alicebob/miniredis/v2 v2.33.0
 	github.com/go-chi/chi v4.0.3+incompatible
 	github.com/gogo/protobuf v1.3.1
 	github.com/namsral/flag v1.7.4-pre
-	github.com/olivere/elastic/v7 v7.0.11
+	github.com/olivere/elastic/v7 v7.0.32
+	github.com/parquet-go/parquet-go v0.32.0
+	github.com/pkg/errors v0.9.1
+	github.com/stretchr/testify v1.12.1
+	go.opentelemetry.io/otel v1.47.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.47.0
+	go.opentelemetry.io/otel/sdk v1.47.0
+	go.opentelemetry.io/otel/trace v1.47.0
+	google.golang.org/grpc v1.56.3
+	gopkg.in/redis.v3 v3.6.4
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/adjust/gocheck v0.0.0-20131111155431-fbc315b36e0e // indirect
+	github.com/adjust/uniuri v0.0.0-20130923163420-498743145e60 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/garyburd/redigo v1.6.0 // indirect
+	github.com/go-logr/logr v1.4.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/onsi/ginkgo v1.12.0 // indirect
 	github.com/onsi/gomega v1.9.0 // indirect
-	github.com/pkg/errors v0.9.1
-	github.com/stretchr/testify v1.4.0
+	github.com/parquet-go/bitpack v1.0.0 // indirect
+	github.com/parquet-go/jsonlite v1.0.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/twpayne/go-geom v1.6.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	go.opentelemetry.io/otel/log v1.47.0 // indirect
+	go.opentelemetry.io/otel/metric v1.47.0 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/bsm/ratelimit.v1 v1.0.0-20160220154919-db14e161995a // indirect
-	gopkg.in/redis.v3 v3.6.4 // indirect
 )
@@ -0,0 +1,133 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataAPIKey is the metadata of the API key, formatted as <key id>.<secret>, the same as the HTTP header.
+const MetadataAPIKey = "x-api-key"
+
+// Authenticate returns the key of a call. The error is returned as the status of the call.
+type Authenticate func(ctx context.Context) (*auth.Key, error)
+
+// APIKey authenticates the calls using the API key metadata.
+// The HMAC signatures are not supported, since they sign the HTTP request.
+func APIKey(authenticator *auth.Authenticator) Authenticate {
+	return func(ctx context.Context) (*auth.Key, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		apiKey := md.Get(MetadataAPIKey)
+		if len(apiKey) == 0 || apiKey[0] == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing API key")
+		}
+
+		key, err := authenticator.AuthenticateAPIKey(ctx, apiKey[0])
+		if err != nil {
+			if auth.IsUnauthorized(err) {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return key, nil
+	}
+}
+
+// Anonymous gives every call the anonymous key of the tenant, used when authentication is disabled.
+func Anonymous(tenant string) Authenticate {
+	key := auth.AnonymousKey(tenant)
+
+	return func(ctx context.Context) (*auth.Key, error) {
+		return key, nil
+	}
+}
+
+// scopes are the scopes required by the methods.
+var scopes = map[string]auth.Scope{
+	"/proto.ViewService/Track":       auth.ScopeWrite,
+	"/proto.ViewService/BatchTrack":  auth.ScopeWrite,
+	"/proto.ViewService/StreamTrack": auth.ScopeWrite,
+	"/proto.ViewService/Retrieve":    auth.ScopeRead,
+}
+
+// authorize returns the context of the call, with its trace context and its key.
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		traceContext := make(map[string]string, len(md))
+		for k, v := range md {
+			if len(v) > 0 {
+				traceContext[k] = v[0]
+			}
+		}
+
+		ctx = tracing.Extract(ctx, traceContext)
+	}
+
+	key, err := s.authenticate(ctx)
+	if err != nil {
+		if status.Code(err) == codes.Internal {
+			s.logger.Error("authenticate", logging.Error(err))
+		}
+
+		return nil, err
+	}
+
+	scope, ok := scopes[method]
+	if !ok || !key.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "key is not granted the "+string(scope)+" scope")
+	}
+
+	return auth.WithKey(ctx, key), nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.limitCall(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	var wrapped grpc.ServerStream = &serverStream{ServerStream: stream, ctx: ctx}
+
+	if s.limits != nil {
+		if err := s.limitCall(ctx, nil); err != nil {
+			return err
+		}
+
+		wrapped = &limitedStream{ServerStream: wrapped, limits: s.limits}
+	}
+
+	return handler(srv, wrapped)
+}
+
+// serverStream is a stream with the context of the call.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,112 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/ratelimit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithRateLimit limits the Track, BatchTrack and StreamTrack calls, sharing the buckets of the HTTP API when given the same limits.
+// A call over a limit fails with ResourceExhausted, and a call with more hits of an ID than the limit with InvalidArgument.
+// The client IP is the peer address.
+//
+// The IP and API key limits count the calls, a StreamTrack call once when opened.
+// The ID limit counts the hits of each ID, so BatchTrack takes a token per hit of each of its IDs,
+// and StreamTrack a token per hit received: the stream fails once an ID is over its limit.
+func WithRateLimit(limits *ratelimit.Limits) func(*Server) {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// rateLimited is the error of a call over a limit.
+func rateLimited(decision ratelimit.Decision) error {
+	if decision.OverLimit {
+		// Retrying would not help.
+		return status.Errorf(codes.InvalidArgument, "rate limit exceeded: %s, the limit is %d hits per ID", decision.Exceeded, decision.Result.Limit)
+	}
+
+	return status.Error(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded: %s, retry after %s", decision.Exceeded, decision.Result.RetryAfter))
+}
+
+// limitCall limits the unary Track calls, and the opening of the StreamTrack calls, which have no hits yet.
+func (s *Server) limitCall(ctx context.Context, req interface{}) error {
+	if s.limits == nil {
+		return nil
+	}
+
+	var hits map[string]int
+
+	switch req := req.(type) {
+	case *proto.TrackRequest:
+		hits = map[string]int{req.Id: 1}
+
+	case *proto.BatchTrackRequest:
+		hits = make(map[string]int, len(req.Hits))
+		for _, hit := range req.Hits {
+			hits[hit.Id]++
+		}
+
+	case nil:
+		// The stream is opened.
+
+	default:
+		return nil
+	}
+
+	// The empty IDs are rejected by the handler.
+	delete(hits, "")
+
+	limitReq := ratelimit.Request{
+		IP:     peerIP(ctx),
+		Tenant: auth.TenantFromContext(ctx),
+		Hits:   hits,
+	}
+
+	if key := auth.KeyFromContext(ctx); key != nil {
+		limitReq.APIKey = key.ID
+	}
+
+	if decision := s.limits.Allow(ctx, limitReq); decision.Exceeded != "" {
+		return rateLimited(decision)
+	}
+
+	return nil
+}
+
+// limitedStream limits the hits of each ID received by a StreamTrack call.
+type limitedStream struct {
+	grpc.ServerStream
+	limits *ratelimit.Limits
+}
+
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	req, ok := m.(*proto.TrackRequest)
+	if !ok || req.Id == "" {
+		return nil
+	}
+
+	ctx := s.Context()
+
+	// Only the ID limit, the IP and API key limits counted the stream when opened.
+	decision := s.limits.Allow(ctx, ratelimit.Request{
+		Tenant: auth.TenantFromContext(ctx),
+		Hits:   map[string]int{req.Id: 1},
+	})
+	if decision.Exceeded != "" {
+		return rateLimited(decision)
+	}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/ratelimit"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/skew"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/grpcapi")
+
+const (
+	// Same limit as the HTTP Bulk Track endpoint.
+	maxBatchHits = 10000
+
+	// Number of hits of a stream tracked together.
+	streamBatchSize = 500
+)
+
+var _ proto.ViewServiceServer = (*Server)(nil)
+
+// Server is the gRPC ViewService, the equivalent of the HTTP API, backed by the same stores.
+type Server struct {
+	logger        *slog.Logger
+	viewTracker   store.ViewTracker
+	viewRetriever store.ViewRetriever
+	authenticate  Authenticate
+
+	filters *filter.Chain
+	window  *skew.Window
+	limits  *ratelimit.Limits
+}
+
+type Option func(*Server)
+
+// WithFilters discards the hits filtered by the chain, e.g. the bots and the duplicates, before they are tracked.
+// The client IP is the peer address, and the user agent is the user-agent metadata.
+func WithFilters(chain *filter.Chain) func(*Server) {
+	return func(s *Server) {
+		s.filters = chain
+	}
+}
+
+// WithTimestampWindow validates the timestamps sent by the clients. Default is to accept every timestamp.
+func WithTimestampWindow(window *skew.Window) func(*Server) {
+	return func(s *Server) {
+		s.window = window
+	}
+}
+
+// NewServer creates the ViewService. Every call is authenticated using the authenticate function,
+// Track, BatchTrack and StreamTrack require the write scope, and Retrieve requires the read scope.
+func NewServer(viewTracker store.ViewTracker, viewRetriever store.ViewRetriever, authenticate Authenticate, logger *slog.Logger, opts ...Option) *Server {
+	s := &Server{
+		viewTracker:   viewTracker,
+		viewRetriever: viewRetriever,
+		authenticate:  authenticate,
+		logger:        logging.OrDiscard(logger),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// GRPCServer returns a gRPC server serving the ViewService, using the message codec and the authentication interceptors.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ForceServerCodec(proto.Codec{}),
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	}, opts...)
+
+	srv := grpc.NewServer(opts...)
+	proto.RegisterViewServiceServer(srv, s)
+
+	return srv
+}
+
+func (s *Server) Track(ctx context.Context, req *proto.TrackRequest) (*proto.TrackResponse, error) {
+	ctx, span := tracer.Start(ctx, "grpcapi.Track")
+	defer span.End()
+
+	span.SetAttributes(tracing.IDAttribute(req.Id))
+
+	view, err := s.viewTrack(ctx, req, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	hit := newHit(ctx, view, req.Timestamp != 0)
+
+	if !s.keep(ctx, hit) {
+		span.SetAttributes(attribute.Bool("hit.discarded", true))
+
+		return &proto.TrackResponse{}, nil
+	}
+
+	if err := s.viewTracker.Track(ctx, view); err != nil {
+		tracing.RecordError(span, err)
+
+		// The client retries the failed hit, it is not a duplicate.
+		s.forget(ctx, hit)
+
+		s.logger.Error("track view", slog.String("id", req.Id), logging.Error(err))
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.TrackResponse{}, nil
+}
+
+func (s *Server) BatchTrack(ctx context.Context, req *proto.BatchTrackRequest) (*proto.BatchTrackResponse, error) {
+	ctx, span := tracer.Start(ctx, "grpcapi.BatchTrack")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch.size", len(req.Hits)))
+
+	if len(req.Hits) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "hits is empty")
+	}
+
+	if len(req.Hits) > maxBatchHits {
+		return nil, status.Errorf(codes.InvalidArgument, "too many hits, the maximum is %d", maxBatchHits)
+	}
+
+	res := &proto.BatchTrackResponse{}
+
+	if err := s.batchTrack(ctx, req.Hits, 0, res); err != nil {
+		tracing.RecordError(span, err)
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *Server) StreamTrack(stream proto.ViewService_StreamTrackServer) error {
+	ctx, span := tracer.Start(stream.Context(), "grpcapi.StreamTrack")
+	defer span.End()
+
+	res := &proto.BatchTrackResponse{}
+
+	var (
+		hits  []*proto.TrackRequest
+		index int
+	)
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		hits = append(hits, req)
+
+		if len(hits) == streamBatchSize {
+			if err := s.batchTrack(ctx, hits, index, res); err != nil {
+				tracing.RecordError(span, err)
+
+				return err
+			}
+
+			index += len(hits)
+			hits = hits[:0]
+		}
+	}
+
+	if len(hits) > 0 {
+		if err := s.batchTrack(ctx, hits, index, res); err != nil {
+			tracing.RecordError(span, err)
+
+			return err
+		}
+	}
+
+	span.SetAttributes(attribute.Int("batch.size", index+len(hits)))
+
+	return stream.SendAndClose(res)
+}
+
+// batchTrack tracks the valid hits, and adds their result to the response.
+// The index of the first hit is offset, so the errors have the index of the hit in the whole stream.
+func (s *Server) batchTrack(ctx context.Context, hits []*proto.TrackRequest, offset int, res *proto.BatchTrackResponse) error {
+	now := time.Now()
+
+	views := make([]store.ViewTrack, 0, len(hits))
+	kept := make([]filter.Hit, 0, len(hits))
+
+	for i, req := range hits {
+		view, err := s.viewTrack(ctx, req, now)
+		if err != nil {
+			res.Rejected++
+			res.Errors = append(res.Errors, &proto.HitError{Index: int32(offset + i), Message: err.Error()})
+
+			continue
+		}
+
+		hit := newHit(ctx, view, req.Timestamp != 0)
+
+		if !s.keep(ctx, hit) {
+			res.Discarded++
+
+			continue
+		}
+
+		views = append(views, view)
+		kept = append(kept, hit)
+	}
+
+	if len(views) == 0 {
+		return nil
+	}
+
+	if err := s.viewTracker.BatchTrack(ctx, views); err != nil {
+		s.forget(ctx, kept...)
+
+		s.logger.Error("batch track views", slog.Int("batch_size", len(views)), logging.Error(err))
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	res.Accepted += int32(len(views))
+
+	return nil
+}
+
+func (s *Server) Retrieve(ctx context.Context, req *proto.RetrieveRequest) (*proto.RetrieveResponse, error) {
+	ctx, span := tracer.Start(ctx, "grpcapi.Retrieve")
+	defer span.End()
+
+	span.SetAttributes(tracing.IDAttribute(req.Id))
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is empty")
+	}
+
+	counts, err := s.viewRetriever.Retrieve(ctx, store.ViewQuery{
+		Tenant: auth.TenantFromContext(ctx),
+		ID:     req.Id,
+		Ranges: []store.Range{store.FiveMinute, store.OneHour, store.OneDay, store.OneWeek, store.OneMonth},
+	})
+	if err != nil {
+		tracing.RecordError(span, err)
+
+		s.logger.Error("retrieve view", slog.String("id", req.Id), logging.Error(err))
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	res := &proto.RetrieveResponse{
+		Id:     req.Id,
+		Counts: make([]*proto.ViewCount, 0, len(counts)),
+	}
+
+	for _, count := range counts {
+		res.Counts = append(res.Counts, &proto.ViewCount{Reference: count.Description, Count: count.Count})
+	}
+
+	return res, nil
+}
+
+// viewTrack returns the view of the hit, for the tenant of the call. The hits without timestamp get the server time.
+func (s *Server) viewTrack(ctx context.Context, req *proto.TrackRequest, now time.Time) (store.ViewTrack, error) {
+	if req == nil || req.Id == "" {
+		return store.ViewTrack{}, errors.New("id is empty")
+	}
+
+	timestamp, late := now, false
+
+	if req.Timestamp != 0 {
+		var err error
+
+		timestamp, late, err = s.window.Check(time.Unix(0, req.Timestamp))
+		if err != nil {
+			return store.ViewTrack{}, err
+		}
+	}
+
+	return store.ViewTrack{
+		Tenant:    auth.TenantFromContext(ctx),
+		ID:        req.Id,
+		Timestamp: timestamp,
+		Late:      late,
+	}, nil
+}
+
+// keep returns false if the hit is discarded by the filters.
+func (s *Server) keep(ctx context.Context, hit filter.Hit) bool {
+	if s.filters == nil {
+		return true
+	}
+
+	return s.filters.Keep(ctx, hit)
+}
+
+// forget forgets the kept hits in the filters, once they failed to be tracked.
+func (s *Server) forget(ctx context.Context, hits ...filter.Hit) {
+	if s.filters == nil {
+		return
+	}
+
+	s.filters.Forget(ctx, hits...)
+}
+
+// newHit returns the hit of the view tracked by the call, timestamped if the client sent the time of the view.
+func newHit(ctx context.Context, view store.ViewTrack, timestamped bool) filter.Hit {
+	hit := filter.Hit{View: view, ClientIP: peerIP(ctx), Timestamped: timestamped}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			hit.UserAgent = ua[0]
+		}
+	}
+
+	return hit
+}
+
+// peerIP returns the IP of the peer of the call, empty if unknown.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return ip
+}
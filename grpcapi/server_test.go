@@ -0,0 +1,340 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/filter"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/ratelimit"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/skew"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// connect serves the server on an in memory listener, and returns a client.
+func connect(t *testing.T, s *Server) proto.ViewServiceClient {
+	lis := bufconn.Listen(1 << 20)
+
+	srv := s.GRPCServer()
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(proto.Codec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+
+	return proto.NewViewServiceClient(conn)
+}
+
+func TestTrack(t *testing.T) {
+	var tracked []store.ViewTrack
+
+	tracker := &mock.ViewTracker{
+		OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+			tracked = append(tracked, v)
+
+			return nil
+		},
+	}
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil))
+
+	_, err := client.Track(context.Background(), &proto.TrackRequest{Id: "1"})
+	assert.NoError(t, err)
+
+	timestamp := time.Now().Add(-time.Hour).Round(0)
+
+	_, err = client.Track(context.Background(), &proto.TrackRequest{Id: "2", Timestamp: timestamp.UnixNano()})
+	assert.NoError(t, err)
+
+	_, err = client.Track(context.Background(), &proto.TrackRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	if assert.Len(t, tracked, 2) {
+		assert.Equal(t, "1", tracked[0].ID)
+		assert.Equal(t, "acme", tracked[0].Tenant)
+		assert.WithinDuration(t, time.Now(), tracked[0].Timestamp, time.Minute)
+
+		assert.Equal(t, "2", tracked[1].ID)
+		assert.True(t, timestamp.Equal(tracked[1].Timestamp))
+	}
+}
+
+func TestTrackTimestamp(t *testing.T) {
+	tracker := &mock.ViewTracker{
+		OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+			return nil
+		},
+	}
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil,
+		WithTimestampWindow(skew.NewWindow(time.Hour, time.Minute, skew.PolicyReject))))
+
+	_, err := client.Track(context.Background(), &proto.TrackRequest{Id: "1", Timestamp: time.Now().Add(-2 * time.Hour).UnixNano()})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Track(context.Background(), &proto.TrackRequest{Id: "1", Timestamp: time.Now().Add(-time.Minute).UnixNano()})
+	assert.NoError(t, err)
+}
+
+func TestBatchTrack(t *testing.T) {
+	var tracked []store.ViewTrack
+
+	tracker := &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			tracked = append(tracked, vs...)
+
+			return nil
+		},
+	}
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil))
+
+	res, err := client.BatchTrack(context.Background(), &proto.BatchTrackRequest{
+		Hits: []*proto.TrackRequest{{Id: "1"}, {Id: ""}, {Id: "2"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int32(2), res.Accepted)
+	assert.Equal(t, int32(1), res.Rejected)
+	assert.Equal(t, []*proto.HitError{{Index: 1, Message: "id is empty"}}, res.Errors)
+	assert.Len(t, tracked, 2)
+
+	_, err = client.BatchTrack(context.Background(), &proto.BatchTrackRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestBatchTrackDedup(t *testing.T) {
+	tracker := &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			return nil
+		},
+	}
+
+	chain := filter.NewChain(filter.NewMemoryCounter(), nil, filter.Dedup(filter.NewMemoryMarker(), time.Minute))
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil, WithFilters(chain)))
+
+	// The hits of an ID with their own time are not duplicates, the hits without time are.
+	timestamp := time.Now().Add(-time.Hour)
+
+	res, err := client.BatchTrack(context.Background(), &proto.BatchTrackRequest{
+		Hits: []*proto.TrackRequest{
+			{Id: "1", Timestamp: timestamp.UnixNano()},
+			{Id: "1", Timestamp: timestamp.Add(time.Second).UnixNano()},
+			{Id: "1", Timestamp: timestamp.UnixNano()},
+			{Id: "2"},
+			{Id: "2"},
+		},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(3), res.Accepted)
+		assert.Equal(t, int32(2), res.Discarded)
+	}
+}
+
+func TestStreamTrack(t *testing.T) {
+	var batches [][]store.ViewTrack
+
+	tracker := &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			batches = append(batches, append([]store.ViewTrack{}, vs...))
+
+			return nil
+		},
+	}
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil,
+		WithFilters(filter.NewChain(filter.NewMemoryCounter(), nil, filter.Bot([]string{"grpc-go"})))))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "user-agent", "sdk")
+
+	stream, err := client.StreamTrack(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hits := streamBatchSize + 10
+
+	for i := 0; i < hits; i++ {
+		id := "1"
+		if i == streamBatchSize+1 {
+			id = ""
+		}
+
+		if !assert.NoError(t, stream.Send(&proto.TrackRequest{Id: id})) {
+			return
+		}
+	}
+
+	res, err := stream.CloseAndRecv()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The user agent of grpc-go is appended to the metadata, so every hit is discarded as a bot.
+	assert.Equal(t, int32(0), res.Accepted)
+	assert.Equal(t, int32(hits-1), res.Discarded)
+	assert.Equal(t, []*proto.HitError{{Index: int32(streamBatchSize + 1), Message: "id is empty"}}, res.Errors)
+	assert.Empty(t, batches)
+
+	client = connect(t, NewServer(tracker, nil, Anonymous("acme"), nil))
+
+	stream, err = client.StreamTrack(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < hits; i++ {
+		if !assert.NoError(t, stream.Send(&proto.TrackRequest{Id: "1"})) {
+			return
+		}
+	}
+
+	res, err = stream.CloseAndRecv()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int32(hits), res.Accepted)
+	if assert.Len(t, batches, 2) {
+		assert.Len(t, batches[0], streamBatchSize)
+		assert.Len(t, batches[1], 10)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tracker := &mock.ViewTracker{
+		OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+			return nil
+		},
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			return nil
+		},
+	}
+
+	limits := ratelimit.New(ratelimit.NewMemoryLimiter(), nil,
+		ratelimit.Rule{Name: "ip", By: ratelimit.ByIP, Rate: ratelimit.Rate{Requests: 5, Period: time.Minute}},
+		ratelimit.Rule{Name: "id", By: ratelimit.ByID, Rate: ratelimit.Rate{Requests: 3, Period: time.Minute}},
+	)
+
+	client := connect(t, NewServer(tracker, nil, Anonymous("acme"), nil, WithRateLimit(limits)))
+	ctx := context.Background()
+
+	_, err := client.Track(ctx, &proto.TrackRequest{Id: "1"})
+	assert.NoError(t, err)
+
+	// A token per hit of each ID.
+	_, err = client.BatchTrack(ctx, &proto.BatchTrackRequest{Hits: []*proto.TrackRequest{{Id: "1"}, {Id: "1"}, {Id: "2"}}})
+	assert.NoError(t, err)
+
+	_, err = client.Track(ctx, &proto.TrackRequest{Id: "1"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "rate limit exceeded: id")
+
+	_, err = client.BatchTrack(ctx, &proto.BatchTrackRequest{Hits: []*proto.TrackRequest{{Id: "3"}, {Id: "3"}, {Id: "3"}, {Id: "3"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "rate limit exceeded: id, the limit is 3 hits per ID", status.Convert(err).Message())
+
+	// The stream fails once an ID is over its limit.
+	stream, err := client.StreamTrack(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		if !assert.NoError(t, stream.Send(&proto.TrackRequest{Id: "2"})) {
+			return
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// 5 calls by the same IP.
+	_, err = client.Track(ctx, &proto.TrackRequest{Id: "4"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "rate limit exceeded: ip")
+}
+
+func TestRetrieve(t *testing.T) {
+	retriever := &mock.ViewRetriever{
+		OnRetrieve: func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+			assert.Equal(t, "acme", q.Tenant)
+
+			return []store.ViewCount{{Description: "5 minutes ago", Count: 3}}, nil
+		},
+	}
+
+	client := connect(t, NewServer(nil, retriever, Anonymous("acme"), nil))
+
+	res, err := client.Retrieve(context.Background(), &proto.RetrieveRequest{Id: "1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "1", res.Id)
+	assert.Equal(t, []*proto.ViewCount{{Reference: "5 minutes ago", Count: 3}}, res.Counts)
+}
+
+func TestAuth(t *testing.T) {
+	tracker := &mock.ViewTracker{
+		OnTrack: func(ctx context.Context, v store.ViewTrack) error {
+			assert.Equal(t, "acme", v.Tenant)
+
+			return nil
+		},
+	}
+
+	authenticator := auth.NewAuthenticator(auth.NewMemoryKeyStore([]auth.Key{
+		{ID: "sdk", Secret: "s3cret", Tenant: "acme", Scopes: []auth.Scope{auth.ScopeWrite}},
+	}))
+
+	client := connect(t, NewServer(tracker, nil, APIKey(authenticator), nil))
+
+	withKey := func(apiKey string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), MetadataAPIKey, apiKey)
+	}
+
+	_, err := client.Track(context.Background(), &proto.TrackRequest{Id: "1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Track(withKey("sdk.wrong"), &proto.TrackRequest{Id: "1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Track(withKey("sdk.s3cret"), &proto.TrackRequest{Id: "1"})
+	assert.NoError(t, err)
+
+	_, err = client.Retrieve(withKey("sdk.s3cret"), &proto.RetrieveRequest{Id: "1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.StreamTrack(context.Background())
+	if assert.NoError(t, err) {
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
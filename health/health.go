@@ -0,0 +1,210 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Status values of the responses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check returns an error if the dependency is not usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Handler serves the liveness endpoint /healthz and the readiness endpoint /readyz.
+//
+// The liveness endpoint only reports that the process is running.
+// The readiness endpoint runs every check concurrently, and fails if any of them fails, or if the Handler is draining.
+type Handler struct {
+	router  chi.Router
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+
+	draining int32
+}
+
+type Option func(*Handler)
+
+// Default timeout is 2 seconds.
+func WithTimeout(timeout time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.timeout = timeout
+	}
+}
+
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{
+		timeout: 2 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	r := chi.NewRouter()
+
+	r.Get("/healthz", h.handleLiveness())
+	r.Get("/readyz", h.handleReadiness())
+
+	h.router = r
+
+	return h
+}
+
+// AddCheck registers a readiness check for the named dependency.
+func (h *Handler) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the readiness endpoint fail, so no new traffic is routed to the process while it shuts down.
+func (h *Handler) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *Handler) isDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// CheckResult is the result of a single dependency check.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Response is the body of both endpoints.
+type Response struct {
+	Status       string        `json:"status"`
+	Dependencies []CheckResult `json:"dependencies,omitempty"`
+}
+
+func (h *Handler) handleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render(w, http.StatusOK, Response{Status: StatusOK})
+	}
+}
+
+func (h *Handler) handleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		res := Response{
+			Status:       StatusOK,
+			Dependencies: h.runChecks(ctx),
+		}
+
+		for _, dep := range res.Dependencies {
+			if dep.Status != StatusOK {
+				res.Status = StatusUnavailable
+			}
+		}
+
+		// Draining takes precedence, the dependencies are still reported.
+		if h.isDraining() {
+			res.Status = StatusDraining
+		}
+
+		status := http.StatusOK
+		if res.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		render(w, status, res)
+	}
+}
+
+func (h *Handler) runChecks(ctx context.Context) []CheckResult {
+	h.mu.RLock()
+	checks := make([]namedCheck, len(h.checks))
+	copy(checks, h.checks)
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+
+	for i := range checks {
+		go func(i int) {
+			defer wg.Done()
+
+			results[i] = runCheck(ctx, checks[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func runCheck(ctx context.Context, c namedCheck) CheckResult {
+	start := time.Now()
+
+	errCh := make(chan error, 1)
+
+	// Run the check in its own Goroutine, so a check that ignores ctx can't block the response.
+	go func() {
+		errCh <- c.check(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Name:      c.name,
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		res.Status = StatusUnavailable
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.ServeHTTP(w, r)
+}
+
+func render(w http.ResponseWriter, status int, v interface{}) {
+	buf := &bytes.Buffer{}
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveness(t *testing.T) {
+	handler := NewHandler()
+	handler.AddCheck("failing", func(ctx context.Context) error {
+		return errors.New("down")
+	})
+
+	// Liveness doesn't depend on the checks.
+	res := serve(t, handler, "/healthz", http.StatusOK)
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Empty(t, res.Dependencies)
+}
+
+func TestReadiness(t *testing.T) {
+	var elasticErr error
+
+	handler := NewHandler(WithTimeout(50 * time.Millisecond))
+	handler.AddCheck("elastic", func(ctx context.Context) error {
+		return elasticErr
+	})
+	handler.AddCheck("redis", func(ctx context.Context) error {
+		return nil
+	})
+
+	res := serve(t, handler, "/readyz", http.StatusOK)
+	assert.Equal(t, StatusOK, res.Status)
+	if assert.Len(t, res.Dependencies, 2) {
+		assert.Equal(t, "elastic", res.Dependencies[0].Name)
+		assert.Equal(t, StatusOK, res.Dependencies[0].Status)
+		assert.Equal(t, "redis", res.Dependencies[1].Name)
+	}
+
+	// A failing dependency
+	elasticErr = errors.New("connection refused")
+
+	res = serve(t, handler, "/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, StatusUnavailable, res.Status)
+	if assert.Len(t, res.Dependencies, 2) {
+		assert.Equal(t, StatusUnavailable, res.Dependencies[0].Status)
+		assert.Equal(t, "connection refused", res.Dependencies[0].Error)
+		assert.Equal(t, StatusOK, res.Dependencies[1].Status)
+	}
+
+	// A check that never returns is timed out
+	elasticErr = nil
+	handler.AddCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	res = serve(t, handler, "/readyz", http.StatusServiceUnavailable)
+	if assert.Len(t, res.Dependencies, 3) {
+		assert.Equal(t, StatusUnavailable, res.Dependencies[2].Status)
+		assert.Equal(t, context.DeadlineExceeded.Error(), res.Dependencies[2].Error)
+	}
+}
+
+func TestReadinessDraining(t *testing.T) {
+	handler := NewHandler()
+	handler.AddCheck("elastic", func(ctx context.Context) error {
+		return nil
+	})
+
+	serve(t, handler, "/readyz", http.StatusOK)
+
+	handler.Drain()
+
+	res := serve(t, handler, "/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, StatusDraining, res.Status)
+	assert.Len(t, res.Dependencies, 1)
+
+	// Liveness is not affected
+	serve(t, handler, "/healthz", http.StatusOK)
+}
+
+func serve(t *testing.T, handler http.Handler, path string, wantCode int) Response {
+	request := httptest.NewRequest("GET", path, nil)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, request)
+
+	assert.Equal(t, wantCode, w.Code, "status code")
+
+	var res Response
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+
+	return res
+}
@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// span is a range of lines of a file, imported in one batch.
+type span struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Line is the number of the last line of the span.
+	Line int `json:"line"`
+}
+
+// progress is the progress of the import of a file.
+type progress struct {
+	// Every line before Offset is imported, Line is the number of the last one.
+	Offset int64 `json:"offset"`
+	Line   int   `json:"line"`
+	// Done are the spans after Offset already imported, the batches being imported concurrently.
+	Done []span `json:"done,omitempty"`
+}
+
+// add records the span as imported, and moves Offset after the spans imported without gap.
+func (p *progress) add(s span) {
+	p.Done = append(p.Done, s)
+
+	sort.Slice(p.Done, func(i, j int) bool {
+		return p.Done[i].Start < p.Done[j].Start
+	})
+
+	for len(p.Done) > 0 && p.Done[0].Start == p.Offset {
+		p.Offset, p.Line = p.Done[0].End, p.Done[0].Line
+		p.Done = p.Done[1:]
+	}
+}
+
+// doneAt returns the imported span starting at offset, if any.
+func (p *progress) doneAt(offset int64) (span, bool) {
+	for _, s := range p.Done {
+		if s.Start == offset {
+			return s, true
+		}
+	}
+
+	return span{}, false
+}
+
+// Checkpoint records the progress of the imports in a JSON file, saved after each batch, so a failed import
+// is resumed without importing a view twice.
+type Checkpoint struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]*progress
+}
+
+// LoadCheckpoint loads the checkpoint file at path. It is created by the first import if it does not exist.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: path, files: make(map[string]*progress)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read checkpoint")
+	}
+
+	if err := json.Unmarshal(data, &c.files); err != nil {
+		return nil, errors.Wrapf(err, "checkpoint %s", path)
+	}
+
+	return c, nil
+}
+
+// progress returns a copy of the progress of the file.
+func (c *Checkpoint) progress(file string) progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.files[file]
+	if !ok {
+		return progress{}
+	}
+
+	return progress{Offset: p.Offset, Line: p.Line, Done: append([]span(nil), p.Done...)}
+}
+
+// done records the span of the file as imported, and saves the checkpoint.
+func (c *Checkpoint) done(file string, s span) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.files[file]
+	if !ok {
+		p = &progress{}
+		c.files[file] = p
+	}
+
+	p.add(s)
+
+	data, err := json.MarshalIndent(c.files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file at once, so a crash never leaves a partial checkpoint.
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "save checkpoint")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), c.path), "save checkpoint")
+}
@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the file format of an import. Each line is a view, with its id and its RFC 3339 timestamp.
+type Format string
+
+const (
+	// NDJSON lines are objects, e.g. {"id":"1","timestamp":"2020-09-14T11:00:00Z"}. The other fields are ignored.
+	NDJSON Format = "ndjson"
+	// CSV files start with a header, with the id and the timestamp columns. The other columns are ignored.
+	CSV Format = "csv"
+)
+
+// ParseFormat returns the format of the name, ndjson or csv.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case NDJSON, CSV:
+		return f, nil
+	default:
+		return "", errors.Errorf("unknown format %q, must be ndjson or csv", name)
+	}
+}
+
+// FormatOf returns the format of the file extension, .ndjson, .jsonl or .csv.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return NDJSON, nil
+	case ".csv":
+		return CSV, nil
+	default:
+		return "", errors.Errorf("unknown format of %s, the extension must be .ndjson, .jsonl or .csv", path)
+	}
+}
+
+// parser returns the id and the timestamp of a line.
+type parser func(line []byte) (id, timestamp string, err error)
+
+func parseNDJSON(line []byte) (string, string, error) {
+	var v struct {
+		ID        string `json:"id"`
+		Timestamp string `json:"timestamp"`
+	}
+
+	if err := json.Unmarshal(line, &v); err != nil {
+		return "", "", errors.New("invalid JSON")
+	}
+
+	return v.ID, v.Timestamp, nil
+}
+
+// csvParser returns the parser of the lines after the header.
+func csvParser(header []byte) (parser, error) {
+	columns, err := csvRecord(header)
+	if err != nil {
+		return nil, errors.Wrap(err, "header")
+	}
+
+	idColumn, timestampColumn := -1, -1
+
+	for i, column := range columns {
+		switch strings.TrimSpace(column) {
+		case "id":
+			idColumn = i
+		case "timestamp":
+			timestampColumn = i
+		}
+	}
+
+	if idColumn < 0 || timestampColumn < 0 {
+		return nil, errors.New("header must have the id and the timestamp columns")
+	}
+
+	return func(line []byte) (string, string, error) {
+		record, err := csvRecord(line)
+		if err != nil {
+			return "", "", err
+		}
+
+		if len(record) != len(columns) {
+			return "", "", errors.Errorf("%d columns, the header has %d", len(record), len(columns))
+		}
+
+		return record[idColumn], record[timestampColumn], nil
+	}, nil
+}
+
+// csvRecord parses a line. The fields can't span several lines.
+func csvRecord(line []byte) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(line))
+	r.FieldsPerRecord = -1
+
+	record, err := r.Read()
+	if err != nil {
+		return nil, errors.New("invalid CSV")
+	}
+
+	return record, nil
+}
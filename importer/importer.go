@@ -0,0 +1,447 @@
+// Package importer loads the views of NDJSON or CSV files through a store.ViewTracker, in concurrent batches,
+// and resumes a failed import from its checkpoint.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// maxReportedErrors limits the invalid lines kept in a Result.
+const maxReportedErrors = 100
+
+// LineError is an invalid line of a file.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Result is the outcome of the import of a file.
+type Result struct {
+	// Imported is the number of views tracked, or valid in a dry run.
+	Imported int64
+	Invalid  int64
+	// Errors are the first invalid lines, the invalid lines are skipped.
+	Errors []LineError
+	// ResumedAt is the number of the last line imported before, according to the checkpoint.
+	ResumedAt int
+}
+
+type Importer struct {
+	tracker store.ViewTracker
+	tenant  string
+	logger  *slog.Logger
+
+	batchSize    int
+	concurrency  int
+	rate         int
+	retries      int
+	retryBackoff time.Duration
+	maxFuture    time.Duration
+	dryRun       bool
+	checkpoint   *Checkpoint
+
+	now func() time.Time
+}
+
+type Option func(*Importer)
+
+// WithLogger sets the logger of the retries. Default is to discard the logs.
+func WithLogger(logger *slog.Logger) func(*Importer) {
+	return func(i *Importer) {
+		i.logger = logger
+	}
+}
+
+// WithBatchSize sets the number of views per BatchTrack. Default is 1000.
+func WithBatchSize(size int) func(*Importer) {
+	return func(i *Importer) {
+		i.batchSize = size
+	}
+}
+
+// WithConcurrency sets the number of batches tracked at once. Default is 2.
+func WithConcurrency(concurrency int) func(*Importer) {
+	return func(i *Importer) {
+		i.concurrency = concurrency
+	}
+}
+
+// WithRate limits the views tracked per second, so the import does not slow down the live indexing. Default is no limit.
+func WithRate(viewsPerSecond int) func(*Importer) {
+	return func(i *Importer) {
+		i.rate = viewsPerSecond
+	}
+}
+
+// WithRetries sets the retries of a failed batch, with exponential backoff from 1 second. Default is 3.
+func WithRetries(retries int) func(*Importer) {
+	return func(i *Importer) {
+		i.retries = retries
+	}
+}
+
+// WithMaxFuture sets how far in the future a timestamp is valid. Default is 0, the timestamps after now are invalid.
+func WithMaxFuture(maxFuture time.Duration) func(*Importer) {
+	return func(i *Importer) {
+		i.maxFuture = maxFuture
+	}
+}
+
+// WithDryRun only parses and validates the files, nothing is tracked nor checkpointed.
+func WithDryRun() func(*Importer) {
+	return func(i *Importer) {
+		i.dryRun = true
+	}
+}
+
+// WithCheckpoint records the progress in the checkpoint, and resumes the imports from it.
+func WithCheckpoint(checkpoint *Checkpoint) func(*Importer) {
+	return func(i *Importer) {
+		i.checkpoint = checkpoint
+	}
+}
+
+// NewImporter creates an importer of the views of the tenant.
+func NewImporter(tracker store.ViewTracker, tenant string, opts ...Option) *Importer {
+	i := &Importer{
+		tracker:      tracker,
+		tenant:       tenant,
+		batchSize:    1000,
+		concurrency:  2,
+		retries:      3,
+		retryBackoff: time.Second,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	i.logger = logging.OrDiscard(i.logger).With(slog.String("component", "importer"))
+
+	return i
+}
+
+// batch is the views of a span of lines. A batch without views still moves the checkpoint past its invalid lines.
+type batch struct {
+	span  span
+	views []store.ViewTrack
+}
+
+// Import imports the views of the file. The lines already imported according to the checkpoint are skipped.
+// On error, the batches being tracked are completed, so the checkpoint has every batch tracked.
+func (i *Importer) Import(ctx context.Context, path string, format Format) (Result, error) {
+	var res Result
+
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return res, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	offset, number := int64(0), 0
+
+	parse := parser(parseNDJSON)
+
+	if format == CSV {
+		header, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return res, err
+		}
+
+		if parse, err = csvParser(bytes.TrimSpace(header)); err != nil {
+			return res, LineError{Line: 1, Err: err}
+		}
+
+		offset, number = int64(len(header)), 1
+	}
+
+	// seek continues reading after the lines already imported.
+	seek := func(to int64, line int) error {
+		if _, err := f.Seek(to, io.SeekStart); err != nil {
+			return err
+		}
+
+		r.Reset(f)
+		offset, number = to, line
+
+		return nil
+	}
+
+	var p progress
+	if i.checkpoint != nil && !i.dryRun {
+		// The progress of a CSV file starts after the header, so the first batch moves it.
+		if p = i.checkpoint.progress(file); p.Offset < offset {
+			if err := i.checkpoint.done(file, span{Start: p.Offset, End: offset, Line: number}); err != nil {
+				return res, err
+			}
+
+			p = i.checkpoint.progress(file)
+		}
+	}
+
+	if p.Offset > offset {
+		res.ResumedAt = p.Line
+
+		if err := seek(p.Offset, p.Line); err != nil {
+			return res, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan batch)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		trackErr error
+	)
+
+	if !i.dryRun {
+		for w := 0; w < i.concurrency; w++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for b := range batches {
+					if err := i.track(ctx, file, b); err != nil {
+						errOnce.Do(func() {
+							trackErr = err
+							cancel()
+						})
+
+						continue
+					}
+
+					atomic.AddInt64(&res.Imported, int64(len(b.views)))
+				}
+			}()
+		}
+	}
+
+	pacer := newPacer(i.rate, i.now)
+
+	// send passes the batch to the workers, and starts the next batch at the current line.
+	var current batch
+
+	send := func() error {
+		defer func() {
+			current = batch{span: span{Start: offset, End: offset, Line: number}}
+		}()
+
+		if current.span.End == current.span.Start {
+			return nil
+		}
+
+		if i.dryRun {
+			res.Imported += int64(len(current.views))
+			return nil
+		}
+
+		if err := pacer.wait(ctx, len(current.views)); err != nil {
+			return err
+		}
+
+		select {
+		case batches <- current:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	readErr := func() error {
+		current = batch{span: span{Start: offset, End: offset, Line: number}}
+
+		for {
+			if s, ok := p.doneAt(offset); ok {
+				if err := send(); err != nil {
+					return err
+				}
+
+				if err := seek(s.End, s.Line); err != nil {
+					return err
+				}
+
+				current = batch{span: span{Start: offset, End: offset, Line: number}}
+
+				continue
+			}
+
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				offset += int64(len(line))
+				number++
+
+				current.span.End, current.span.Line = offset, number
+
+				view, lineErr := i.view(parse, bytes.TrimSpace(line))
+				if lineErr != nil {
+					res.Invalid++
+
+					if len(res.Errors) < maxReportedErrors {
+						res.Errors = append(res.Errors, LineError{Line: number, Err: lineErr})
+					}
+				} else if view != nil {
+					current.views = append(current.views, *view)
+				}
+
+				if len(current.views) >= i.batchSize {
+					if err := send(); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err == io.EOF {
+				return send()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}()
+
+	close(batches)
+	wg.Wait()
+
+	if trackErr != nil {
+		return res, trackErr
+	}
+
+	return res, readErr
+}
+
+// view returns the view of the line, or nil for an empty line.
+func (i *Importer) view(parse parser, line []byte) (*store.ViewTrack, error) {
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	id, timestamp, err := parse(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "" {
+		return nil, errors.New("id is empty")
+	}
+
+	if timestamp == "" {
+		return nil, errors.New("timestamp is empty")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return nil, errors.Errorf("timestamp %q is not a RFC 3339 time", timestamp)
+	}
+
+	if t.After(i.now().Add(i.maxFuture)) {
+		return nil, errors.Errorf("timestamp %s is in the future", timestamp)
+	}
+
+	return &store.ViewTrack{Tenant: i.tenant, ID: id, Timestamp: t}, nil
+}
+
+// track tracks the views of the batch, retrying on error, then records the batch in the checkpoint.
+func (i *Importer) track(ctx context.Context, file string, b batch) error {
+	if len(b.views) > 0 {
+		backoff := i.retryBackoff
+
+		for attempt := 0; ; attempt++ {
+			err := i.tracker.BatchTrack(ctx, b.views)
+			if err == nil {
+				break
+			}
+
+			if attempt >= i.retries || ctx.Err() != nil {
+				return errors.Wrapf(err, "batch ending at line %d", b.span.Line)
+			}
+
+			i.logger.Warn("batch track failed, retrying",
+				slog.Int("attempt", attempt+1),
+				slog.Duration("backoff", backoff),
+				logging.Error(err))
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			backoff *= 2
+		}
+	}
+
+	if i.checkpoint == nil {
+		return nil
+	}
+
+	return i.checkpoint.done(file, b.span)
+}
+
+// pacer spaces the batches so the views are sent at the rate, zero is no limit.
+type pacer struct {
+	rate int
+	next time.Time
+	now  func() time.Time
+}
+
+func newPacer(rate int, now func() time.Time) *pacer {
+	return &pacer{rate: rate, now: now}
+}
+
+// wait waits until n views can be sent.
+func (p *pacer) wait(ctx context.Context, n int) error {
+	if p.rate <= 0 {
+		return nil
+	}
+
+	now := p.now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(time.Duration(n) * time.Second / time.Duration(p.rate))
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
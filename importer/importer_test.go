@@ -0,0 +1,270 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// recorder records the IDs of the views tracked, and fails the batches with an ID in fail.
+type recorder struct {
+	mu   sync.Mutex
+	ids  []string
+	fail map[string]bool
+}
+
+func (r *recorder) tracker() *mock.ViewTracker {
+	return &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			for _, v := range vs {
+				if r.fail[v.ID] {
+					return errors.New("bulk failed")
+				}
+			}
+
+			for _, v := range vs {
+				r.ids = append(r.ids, v.ID)
+			}
+
+			return nil
+		},
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newImporter(tracker store.ViewTracker, opts ...Option) *Importer {
+	i := NewImporter(tracker, "acme", opts...)
+	i.now = func() time.Time { return now }
+	i.retryBackoff = time.Millisecond
+
+	return i
+}
+
+func TestImportNDJSON(t *testing.T) {
+	path := writeFile(t, "views.ndjson", `{"id":"1","timestamp":"2019-01-01T00:00:00Z"}
+{"id":"2","timestamp":"2019-01-01T00:00:01.5Z","referrer":"ignored"}
+
+not json
+{"id":"","timestamp":"2019-01-01T00:00:00Z"}
+{"id":"3","timestamp":"yesterday"}
+{"id":"4","timestamp":"2021-01-01T00:00:00Z"}
+{"id":"5","timestamp":"2019-01-01T00:00:02+08:00"}`)
+
+	var tracked []store.ViewTrack
+
+	tracker := &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			assert.LessOrEqual(t, len(vs), 2)
+
+			tracked = append(tracked, vs...)
+			return nil
+		},
+	}
+
+	res, err := newImporter(tracker, WithBatchSize(2), WithConcurrency(1)).Import(context.Background(), path, NDJSON)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(3), res.Imported)
+	assert.Equal(t, int64(4), res.Invalid)
+	assert.Equal(t, []string{
+		"line 4: invalid JSON",
+		"line 5: id is empty",
+		`line 6: timestamp "yesterday" is not a RFC 3339 time`,
+		"line 7: timestamp 2021-01-01T00:00:00Z is in the future",
+	}, errorStrings(res.Errors))
+
+	if assert.Len(t, tracked, 3) {
+		assert.Equal(t, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}, tracked[0])
+		assert.Equal(t, "5", tracked[2].ID)
+		assert.True(t, time.Date(2018, 12, 31, 16, 0, 2, 0, time.UTC).Equal(tracked[2].Timestamp))
+	}
+}
+
+// errorStrings returns the messages of the errors, to compare them.
+func errorStrings(errs []LineError) []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return messages
+}
+
+func TestImportCSV(t *testing.T) {
+	path := writeFile(t, "views.csv", "timestamp,referrer,id\n"+
+		"2019-01-01T00:00:00Z,\"a,b\",1\n"+
+		"2019-01-01T00:00:00Z,2\n"+
+		"2019-01-01T00:00:00Z,,3\n")
+
+	r := &recorder{}
+
+	res, err := newImporter(r.tracker()).Import(context.Background(), path, CSV)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(2), res.Imported)
+	assert.Equal(t, []string{"1", "3"}, r.ids)
+	assert.Equal(t, []string{"line 3: 2 columns, the header has 3"}, errorStrings(res.Errors))
+
+	path = writeFile(t, "views.csv", "id,time\n1,2019-01-01T00:00:00Z\n")
+
+	_, err = newImporter(r.tracker()).Import(context.Background(), path, CSV)
+	assert.EqualError(t, err, "line 1: header must have the id and the timestamp columns")
+}
+
+func TestImportResume(t *testing.T) {
+	tests := []struct {
+		format Format
+		header string
+		line   func(n int) string
+		// failedAt is the last line of the batch of the view 42, which fails to be tracked.
+		failedAt int
+	}{
+		{
+			format:   NDJSON,
+			line:     func(n int) string { return fmt.Sprintf(`{"id":"%d","timestamp":"2019-01-01T00:00:00Z"}`, n) },
+			failedAt: 46,
+		},
+		{
+			format:   CSV,
+			header:   "id,timestamp",
+			line:     func(n int) string { return fmt.Sprintf("%d,2019-01-01T00:00:00Z", n) },
+			failedAt: 47,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var lines []string
+			if tc.header != "" {
+				lines = append(lines, tc.header)
+			}
+
+			for n := 0; n < 100; n++ {
+				lines = append(lines, tc.line(n))
+			}
+
+			// An invalid line, in a batch imported by the first run.
+			lines[len(lines)-100+10] = "{"
+
+			path := writeFile(t, "views."+string(tc.format), strings.Join(lines, "\n")+"\n")
+
+			checkpoint, err := LoadCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			r := &recorder{fail: map[string]bool{"42": true}}
+
+			res, err := newImporter(r.tracker(), WithBatchSize(5), WithConcurrency(4), WithRetries(1), WithCheckpoint(checkpoint)).
+				Import(context.Background(), path, tc.format)
+			assert.EqualError(t, err, fmt.Sprintf("batch ending at line %d: bulk failed", tc.failedAt))
+			assert.Equal(t, int64(len(r.ids)), res.Imported)
+
+			// The checkpoint is reloaded from the file, as by the next run.
+			checkpoint, err = LoadCheckpoint(checkpoint.path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			r.fail = nil
+
+			res, err = newImporter(r.tracker(), WithBatchSize(5), WithConcurrency(4), WithCheckpoint(checkpoint)).
+				Import(context.Background(), path, tc.format)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.GreaterOrEqual(t, res.ResumedAt, 40)
+			assert.Equal(t, int64(0), res.Invalid)
+
+			// Every valid view is tracked once.
+			sort.Slice(r.ids, func(i, j int) bool {
+				return len(r.ids[i]) < len(r.ids[j]) || len(r.ids[i]) == len(r.ids[j]) && r.ids[i] < r.ids[j]
+			})
+
+			var expected []string
+			for n := 0; n < 100; n++ {
+				if n != 10 {
+					expected = append(expected, fmt.Sprint(n))
+				}
+			}
+
+			assert.Equal(t, expected, r.ids)
+
+			// Every line is imported, none is left in the spans done.
+			p := checkpoint.progress(path)
+			assert.Equal(t, len(lines), p.Line)
+			assert.Empty(t, p.Done)
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	path := writeFile(t, "views.ndjson", `{"id":"1","timestamp":"2019-01-01T00:00:00Z"}
+{"id":"2"}`)
+
+	r := &recorder{}
+
+	res, err := newImporter(r.tracker(), WithDryRun()).Import(context.Background(), path, NDJSON)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Empty(t, r.ids)
+	assert.Equal(t, int64(1), res.Imported)
+	assert.Equal(t, []string{"line 2: timestamp is empty"}, errorStrings(res.Errors))
+}
+
+func TestProgress(t *testing.T) {
+	var p progress
+
+	// The spans are done out of order.
+	p.add(span{Start: 10, End: 20, Line: 2})
+	assert.Equal(t, int64(0), p.Offset)
+
+	s, ok := p.doneAt(10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), s.End)
+
+	p.add(span{Start: 0, End: 10, Line: 1})
+	assert.Equal(t, progress{Offset: 20, Line: 2, Done: []span{}}, p)
+}
+
+func TestFormatOf(t *testing.T) {
+	f, err := FormatOf("views.JSONL")
+	assert.NoError(t, err)
+	assert.Equal(t, NDJSON, f)
+
+	_, err = FormatOf("views.txt")
+	assert.Error(t, err)
+}
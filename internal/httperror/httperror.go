@@ -0,0 +1,17 @@
+// Package httperror renders the errors of the HTTP middlewares, with the same body as the api package.
+package httperror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Render writes the status, and the message as the JSON body {"message": "..."}.
+func Render(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{Message: message})
+}
@@ -0,0 +1,19 @@
+package httperror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	Render(rr, http.StatusForbidden, `key is not granted the "write" scope`)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"message":"key is not granted the \"write\" scope"}`, rr.Body.String())
+}
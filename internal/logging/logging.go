@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+)
+
+type contextKey struct{}
+
+// New creates a logger writing JSON lines to w. level is one of debug, info, warn or error.
+func New(w io.Writer, level string, attrs ...slog.Attr) (*slog.Logger, error) {
+	var l slog.Level
+
+	if err := l.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return nil, errors.Errorf("unknown log level %q", level)
+	}
+
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: l}).WithAttrs(attrs)
+
+	return slog.New(handler), nil
+}
+
+// Discard returns a logger that drops everything.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// OrDiscard returns logger, or a discarding logger if it's nil.
+func OrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard()
+	}
+
+	return logger
+}
+
+// WithContext returns a copy of ctx carrying the logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if there's none.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return OrDiscard(fallback)
+}
+
+// Error returns the attribute for an error.
+func Error(err error) slog.Attr {
+	return slog.String("error", err.Error())
+}
+
+// Middleware writes an access log line for every request.
+// The request ID is taken from chi's middleware.RequestID, which must run before.
+// The request logger, with the request ID attached, is available to the handlers using FromContext.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	logger = OrDiscard(logger)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLogger := logger
+
+			if reqID := middleware.GetReqID(r.Context()); reqID != "" {
+				reqLogger = logger.With(slog.String("request_id", reqID))
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			defer func() {
+				status := ww.Status()
+				// The handler didn't write anything.
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+
+				reqLogger.LogAttrs(r.Context(), level, "http request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.String("user_agent", r.UserAgent()),
+				)
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(WithContext(r.Context(), reqLogger)))
+		})
+	}
+}
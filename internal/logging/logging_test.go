@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	logger, err := New(buf, "warn")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	logger.Info("dropped")
+	logger.Warn("written")
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "written", line["msg"])
+	assert.Equal(t, "WARN", line["level"])
+
+	_, err = New(buf, "verbose")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	logger, err := New(buf, "info")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handler := middleware.RequestID(Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), nil).Info("inside")
+
+		w.WriteHeader(http.StatusTeapot)
+	})))
+
+	request := httptest.NewRequest("GET", "/analytics/1", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, request)
+
+	dec := json.NewDecoder(buf)
+
+	var inside, access map[string]interface{}
+	assert.NoError(t, dec.Decode(&inside))
+	assert.NoError(t, dec.Decode(&access))
+
+	assert.Equal(t, "inside", inside["msg"])
+	assert.NotEmpty(t, inside["request_id"])
+
+	assert.Equal(t, "http request", access["msg"])
+	assert.Equal(t, inside["request_id"], access["request_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/analytics/1", access["path"])
+	assert.Equal(t, float64(http.StatusTeapot), access["status"])
+}
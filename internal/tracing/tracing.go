@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported exporter names.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+var propagator = propagation.TraceContext{}
+
+// Setup installs the global TracerProvider, sending the spans to the named exporter.
+// The returned function flushes the pending spans and must be called before the program exits.
+func Setup(serviceName string, exporter string, w io.Writer) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, errors.Wrap(err, "stdout exporter")
+		}
+
+		spanExporter = exp
+
+	default:
+		return nil, errors.Errorf("unknown trace exporter %q", exporter)
+	}
+
+	provider := NewTracerProvider(serviceName, sdktrace.NewBatchSpanProcessor(spanExporter))
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider creates a TracerProvider that sends every span to the processor.
+// Tests can use it with sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()).
+func NewTracerProvider(serviceName string, processor sdktrace.SpanProcessor) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// Inject returns the trace context of ctx, to be carried inside a message.
+// It returns nil if ctx has no span.
+func Inject(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Extract returns a copy of ctx with the remote span from the message trace context.
+func Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	if len(traceContext) == 0 {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+}
+
+// RecordError records the err in the span, and marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// IDAttribute is the attribute for the hit ID.
+func IDAttribute(id string) attribute.KeyValue {
+	return attribute.String("hit.id", id)
+}
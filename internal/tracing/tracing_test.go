@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewTracerProvider("test", sdktrace.NewSimpleSpanProcessor(exporter))
+
+	// No span, nothing to carry.
+	assert.Nil(t, Inject(context.Background()))
+	assert.Equal(t, context.Background(), Extract(context.Background(), nil))
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "producer")
+	carrier := Inject(ctx)
+	span.End()
+
+	assert.NotEmpty(t, carrier["traceparent"])
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	assert.True(t, remote.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), remote.SpanID())
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup("test", ExporterNone, ioutil.Discard)
+	if assert.NoError(t, err) {
+		assert.NoError(t, shutdown(context.Background()))
+	}
+
+	shutdown, err = Setup("test", ExporterStdout, ioutil.Discard)
+	if assert.NoError(t, err) {
+		assert.NoError(t, shutdown(context.Background()))
+	}
+
+	_, err = Setup("test", "unknown", ioutil.Discard)
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+// Package live pushes the counts of the IDs to their subscribers, when new views are indexed.
+//
+// The indexer publishes the indexed views on a Redis channel, and every server replica listens to it,
+// and notifies its own subscribers through a Hub.
+package live
+
+import (
+	"sync"
+)
+
+type key struct {
+	tenant string
+	id     string
+}
+
+// Subscription receives a notification on C when new views of the ID are indexed. C is closed when the hub is closed.
+//
+// The notifications are coalesced: C has a buffer of one, and a notification is dropped when the previous one
+// is not received yet. So a slow subscriber never blocks the hub, it only gets less notifications.
+type Subscription struct {
+	C <-chan struct{}
+
+	c   chan struct{}
+	key key
+}
+
+// Hub fans out the notifications to the subscribers of the IDs.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[key]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[key]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe subscribes to the notifications of the ID of the tenant. Unsubscribe must be called once done.
+func (h *Hub) Subscribe(tenant, id string) *Subscription {
+	c := make(chan struct{}, 1)
+
+	sub := &Subscription{
+		C:   c,
+		c:   c,
+		key: key{tenant: tenant, id: id},
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(c)
+		return sub
+	}
+
+	if h.subs[sub.key] == nil {
+		h.subs[sub.key] = make(map[*Subscription]struct{})
+	}
+
+	h.subs[sub.key][sub] = struct{}{}
+
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[sub.key], sub)
+
+	if len(h.subs[sub.key]) == 0 {
+		delete(h.subs, sub.key)
+	}
+}
+
+// Notify notifies the subscribers of the ID of the tenant, without blocking.
+func (h *Hub) Notify(tenant, id string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[key{tenant: tenant, id: id}] {
+		select {
+		case sub.c <- struct{}{}:
+		default:
+			// The previous notification is still pending.
+		}
+	}
+}
+
+// Close closes the subscriptions, e.g. so the streams end when the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.subs {
+		for sub := range subs {
+			close(sub.c)
+		}
+	}
+
+	h.subs = make(map[key]map[*Subscription]struct{})
+	h.closed = true
+}
+
+// Subscribers returns the number of subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var n int
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+
+	return n
+}
@@ -0,0 +1,127 @@
+package live
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+func notified(sub *Subscription) bool {
+	select {
+	case <-sub.C:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+
+	sub1 := hub.Subscribe("acme", "1")
+	sub2 := hub.Subscribe("acme", "1")
+	other := hub.Subscribe("globex", "1")
+
+	assert.Equal(t, 3, hub.Subscribers())
+
+	// The notifications are coalesced, and never block.
+	hub.Notify("acme", "1")
+	hub.Notify("acme", "1")
+
+	assert.True(t, notified(sub1))
+	assert.False(t, notified(sub1))
+	assert.True(t, notified(sub2))
+	assert.False(t, notified(other))
+
+	hub.Unsubscribe(sub1)
+	hub.Notify("acme", "1")
+
+	assert.False(t, notified(sub1))
+	assert.True(t, notified(sub2))
+
+	hub.Unsubscribe(sub2)
+	hub.Unsubscribe(other)
+
+	assert.Equal(t, 0, hub.Subscribers())
+	assert.Empty(t, hub.subs)
+
+	sub := hub.Subscribe("acme", "1")
+	hub.Close()
+
+	_, ok := <-sub.C
+	assert.False(t, ok)
+
+	_, ok = <-hub.Subscribe("acme", "1").C
+	assert.False(t, ok)
+
+	hub.Notify("acme", "1")
+	hub.Unsubscribe(sub)
+}
+
+func TestListen(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	hub := NewHub()
+	sub := hub.Subscribe("acme", "1")
+	late := hub.Subscribe("acme", "2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- Listen(ctx, redis.NewClient(&redis.Options{Addr: s.Addr()}), DefaultChannel, hub, nil)
+	}()
+
+	// Wait for the subscription.
+	for i := 0; i < 100 && len(s.PubSubChannels("")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var tracked []store.ViewTrack
+
+	tracker := NewViewTracker(&mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			tracked = append(tracked, vs...)
+			return nil
+		},
+	}, client, DefaultChannel, nil)
+
+	err = tracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1"},
+		{Tenant: "acme", ID: "1"},
+		{Tenant: "acme", ID: "2", Late: true},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, tracked, 3)
+
+	select {
+	case <-sub.C:
+	case <-time.After(3 * time.Second):
+		t.Error("not notified")
+	}
+
+	assert.False(t, notified(late))
+
+	cancel()
+
+	select {
+	case err := <-listenErr:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Error("listen did not stop")
+	}
+}
@@ -0,0 +1,173 @@
+package live
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/redis.v3"
+)
+
+// DefaultChannel is the default Redis channel of the indexed views.
+const DefaultChannel = "views:indexed"
+
+var tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/live")
+
+var _ store.ViewTracker = (*ViewTracker)(nil)
+
+// ViewTracker wraps the ViewTracker of the indexer, and publishes the views on the Redis channel once they are tracked.
+// The late views are not published, since they are not counted.
+// A failed publish is logged, and not returned, since the views are tracked.
+type ViewTracker struct {
+	viewTracker store.ViewTracker
+	client      *redis.Client
+	channel     string
+	logger      *slog.Logger
+}
+
+// The logger can be nil.
+func NewViewTracker(viewTracker store.ViewTracker, client *redis.Client, channel string, logger *slog.Logger) *ViewTracker {
+	return &ViewTracker{
+		viewTracker: viewTracker,
+		client:      client,
+		channel:     channel,
+		logger:      logging.OrDiscard(logger),
+	}
+}
+
+func (t *ViewTracker) Track(ctx context.Context, v store.ViewTrack) error {
+	if err := t.viewTracker.Track(ctx, v); err != nil {
+		return err
+	}
+
+	t.publish(ctx, []store.ViewTrack{v})
+
+	return nil
+}
+
+func (t *ViewTracker) BatchTrack(ctx context.Context, vs []store.ViewTrack) error {
+	if err := t.viewTracker.BatchTrack(ctx, vs); err != nil {
+		return err
+	}
+
+	t.publish(ctx, vs)
+
+	return nil
+}
+
+// publish publishes the number of views of each ID, in a single message.
+func (t *ViewTracker) publish(ctx context.Context, vs []store.ViewTrack) {
+	msg := &proto.IndexedViews{}
+	index := make(map[key]*proto.IndexedView)
+
+	for _, v := range vs {
+		if v.Late {
+			continue
+		}
+
+		k := key{tenant: v.Tenant, id: v.ID}
+
+		view, ok := index[k]
+		if !ok {
+			view = &proto.IndexedView{Tenant: v.Tenant, Id: v.ID}
+			index[k] = view
+			msg.Views = append(msg.Views, view)
+		}
+
+		view.Count++
+	}
+
+	if len(msg.Views) == 0 {
+		return
+	}
+
+	_, span := tracer.Start(ctx, "redis.Publish "+t.channel,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int("batch.size", len(msg.Views))))
+	defer span.End()
+
+	data, err := msg.Marshal()
+	if err == nil {
+		err = t.client.Publish(t.channel, string(data)).Err()
+	}
+
+	if err != nil {
+		tracing.RecordError(span, err)
+
+		t.logger.Error("publish indexed views", slog.String("channel", t.channel), logging.Error(err))
+	}
+}
+
+// Refresh notifies the subscribers of the ID on every server, so they get its counts again, e.g. once its views are deleted.
+func Refresh(ctx context.Context, client *redis.Client, channel, tenant, id string) error {
+	_, span := tracer.Start(ctx, "redis.Publish "+channel, trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	// No view is indexed, the message only notifies the subscribers.
+	msg := &proto.IndexedViews{Views: []*proto.IndexedView{{Tenant: tenant, Id: id}}}
+
+	data, err := msg.Marshal()
+	if err == nil {
+		err = client.Publish(channel, string(data)).Err()
+	}
+
+	if err != nil {
+		tracing.RecordError(span, err)
+		return errors.Wrapf(err, "publish %s", channel)
+	}
+
+	return nil
+}
+
+// Listen notifies the hub of the views published on the Redis channel, until the context is done.
+// The subscription is restored by the client after a connection error.
+func Listen(ctx context.Context, client *redis.Client, channel string, hub *Hub, logger *slog.Logger) error {
+	logger = logging.OrDiscard(logger)
+
+	pubsub, err := client.Subscribe(channel)
+	if err != nil {
+		return errors.Wrapf(err, "subscribe %s", channel)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		pubsub.Close()
+	}()
+
+	for {
+		msg, err := pubsub.ReceiveMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.Wrapf(err, "receive %s", channel)
+		}
+
+		var views proto.IndexedViews
+
+		if err := views.Unmarshal([]byte(msg.Payload)); err != nil {
+			logger.Error("unmarshal indexed views", logging.Error(err))
+			continue
+		}
+
+		for _, view := range views.Views {
+			hub.Notify(view.Tenant, view.Id)
+		}
+	}
+}
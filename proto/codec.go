@@ -0,0 +1,42 @@
+package proto
+
+import (
+	"fmt"
+)
+
+// Codec is the gRPC codec of the messages, using their generated Marshal and Unmarshal.
+// The default gRPC codec goes through the reflection of golang/protobuf, which the gogo messages don't need.
+//
+// Use grpc.ForceServerCodec(proto.Codec{}) on the server, and grpc.ForceCodec(proto.Codec{}) on the client.
+type Codec struct{}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type unmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(marshaler)
+	if !ok {
+		return nil, fmt.Errorf("proto codec: %T is not a message", v)
+	}
+
+	return m.Marshal()
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(unmarshaler)
+	if !ok {
+		return fmt.Errorf("proto codec: %T is not a message", v)
+	}
+
+	return m.Unmarshal(data)
+}
+
+// Name is proto, so the content type is the same as the default codec.
+func (Codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,24 @@
+package proto
+
+import (
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+// ViewTrack returns the view of the request, as consumed by the indexer.
+func (m *ViewTrackRequest) ViewTrack() store.ViewTrack {
+	tenant := m.Tenant
+
+	// Messages produced before the tenants were introduced.
+	if tenant == "" {
+		tenant = store.DefaultTenant
+	}
+
+	return store.ViewTrack{
+		Tenant:    tenant,
+		ID:        string(m.Id),
+		Timestamp: time.Unix(0, m.Timestamp),
+		Late:      m.Late,
+	}
+}
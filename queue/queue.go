@@ -2,15 +2,22 @@ package queue
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/queue")
+
 // ViewTrackerQueue wraps ViewTracker, to enable batching.
 // The ViewTrack's will be sent using BatchTrack().
 //
@@ -21,18 +28,26 @@ import (
 // The maximum delay before a ViewTrack is indexed is equal to batchInterval.
 //
 // BatchTrack will be called in a separate Goroutine, so the queue channel is never blocked.
+//
+// Each flush has its own span, linked to the spans of the Track callers in the batch.
 type ViewTrackerQueue struct {
 	batchSize     int
 	batchInterval time.Duration
 
-	logger *log.Logger
+	logger *slog.Logger
 
-	queue       chan store.ViewTrack
+	queue       chan item
 	stopWg      sync.WaitGroup
 	stopped     bool
 	viewTracker store.ViewTracker
 }
 
+// item is a queued ViewTrack, with the span context of the Track caller.
+type item struct {
+	view        store.ViewTrack
+	spanContext trace.SpanContext
+}
+
 type Option func(*ViewTrackerQueue)
 
 // Default batch size is 256
@@ -49,13 +64,14 @@ func WithBatchInterval(batchInterval time.Duration) func(*ViewTrackerQueue) {
 	}
 }
 
-func NewViewTrackerQueue(viewTracker store.ViewTracker, logger *log.Logger, opts ...Option) *ViewTrackerQueue {
+// The logger can be nil.
+func NewViewTrackerQueue(viewTracker store.ViewTracker, logger *slog.Logger, opts ...Option) *ViewTrackerQueue {
 	q := &ViewTrackerQueue{
 		batchSize:     256,
 		batchInterval: 3 * time.Second,
-		queue:         make(chan store.ViewTrack, 128),
+		queue:         make(chan item, 128),
 		viewTracker:   viewTracker,
-		logger:        logger,
+		logger:        logging.OrDiscard(logger),
 	}
 
 	for _, opt := range opts {
@@ -72,6 +88,7 @@ func (q *ViewTrackerQueue) run() {
 	defer q.stopWg.Done()
 
 	buf := make([]store.ViewTrack, 0, q.batchSize)
+	links := make([]trace.Link, 0, q.batchSize)
 
 Outer:
 	for {
@@ -82,56 +99,97 @@ Outer:
 				break Outer
 			}
 
-			buf = append(buf, item)
+			buf = append(buf, item.view)
+
+			if item.spanContext.IsValid() {
+				links = append(links, trace.Link{SpanContext: item.spanContext})
+			}
 
 			// If buf is full, send the buf.
 			if len(buf) == cap(buf) {
-				q.send(buf)
+				q.send(buf, links)
 
 				buf = make([]store.ViewTrack, 0, q.batchSize)
+				links = make([]trace.Link, 0, q.batchSize)
 			}
 
 		case <-time.After(q.batchInterval):
 			if len(buf) > 0 {
-				q.send(buf)
+				q.send(buf, links)
 
 				buf = make([]store.ViewTrack, 0, q.batchSize)
+				links = make([]trace.Link, 0, q.batchSize)
 			}
 		}
 	}
 
 	if len(buf) > 0 {
-		q.send(buf)
+		q.send(buf, links)
 	}
 }
 
-func (q *ViewTrackerQueue) send(buf []store.ViewTrack) {
+func (q *ViewTrackerQueue) send(buf []store.ViewTrack, links []trace.Link) {
 	q.stopWg.Add(1)
 
 	go func() {
 		defer q.stopWg.Done()
 
+		ctx, span := tracer.Start(context.Background(), "queue.Flush",
+			trace.WithLinks(links...),
+			trace.WithAttributes(attribute.Int("batch.size", len(buf))))
+		defer span.End()
+
 		// Maximum retry 3 times
 		for retry := 1; retry <= 4; retry++ {
-			err := q.viewTracker.BatchTrack(context.Background(), buf)
+			err := q.viewTracker.BatchTrack(ctx, buf)
 			if err == nil {
 				return
 			}
 
-			q.logger.Printf("ERROR queue batch track (retry: %d): %v", retry, err)
+			span.RecordError(err, trace.WithAttributes(attribute.Int("retry", retry)))
+
+			q.logger.Error("queue batch track",
+				slog.Int("retry", retry),
+				slog.Int("batch_size", len(buf)),
+				logging.Error(err))
 
 			time.Sleep(time.Duration(retry) * time.Second)
 		}
+
+		span.SetStatus(codes.Error, "batch track failed")
+
+		q.logger.Error("queue batch dropped", slog.Int("batch_size", len(buf)))
 	}()
 }
 
+// Backlog returns the number of views waiting in the queue.
+func (q *ViewTrackerQueue) Backlog() int {
+	return len(q.queue)
+}
+
+// Check returns an error if the queue has stopped, or if the backlog is full, i.e. Track is blocking.
+func (q *ViewTrackerQueue) Check(ctx context.Context) error {
+	if q.stopped {
+		return errors.New("queue has stopped")
+	}
+
+	if backlog := q.Backlog(); backlog >= cap(q.queue) {
+		return errors.Errorf("queue backlog is full (%d)", backlog)
+	}
+
+	return nil
+}
+
 // Track send the view into the queue.
 func (q *ViewTrackerQueue) Track(ctx context.Context, view store.ViewTrack) error {
 	if q.stopped {
 		return errors.New("queue has stopped")
 	}
 
-	q.queue <- view
+	q.queue <- item{
+		view:        view,
+		spanContext: trace.SpanContextFromContext(ctx),
+	}
 
 	return nil
 }
@@ -5,10 +5,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestQueue(t *testing.T) {
@@ -23,6 +27,9 @@ func TestQueue(t *testing.T) {
 
 	queue := NewViewTrackerQueue(viewTracker, nil, WithBatchInterval(500*time.Millisecond), WithBatchSize(3))
 
+	assert.NoError(t, queue.Check(context.Background()))
+	assert.Equal(t, 0, queue.Backlog())
+
 	// Test batch interval
 
 	for i := 0; i < 2; i++ {
@@ -82,10 +89,56 @@ func TestQueue(t *testing.T) {
 	assert.Len(t, tracks, 1)
 
 	// Test after the queue has stopped
+	assert.Error(t, queue.Check(context.Background()))
 	assert.Error(t, queue.Track(context.Background(), store.ViewTrack{}))
 	assert.Error(t, queue.BatchTrack(context.Background(), nil))
 }
 
+func TestQueueTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewTracerProvider("test", sdktrace.NewSimpleSpanProcessor(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	tracksCh := make(chan []store.ViewTrack, 1)
+
+	viewTracker := &mock.ViewTracker{
+		OnBatchTrack: func(ctx context.Context, vs []store.ViewTrack) error {
+			tracksCh <- vs
+			return nil
+		},
+	}
+
+	queue := NewViewTrackerQueue(viewTracker, nil, WithBatchSize(2))
+	defer queue.Stop(context.Background())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+
+	for i := 0; i < 2; i++ {
+		_ = queue.Track(ctx, store.ViewTrack{
+			ID:        "1",
+			Timestamp: time.Now(),
+		})
+	}
+
+	span.End()
+
+	wait(t, tracksCh, 100*time.Millisecond)
+
+	// The flush span ends right after BatchTrack returns.
+	assert.Eventually(t, func() bool {
+		return len(exporter.GetSpans()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	flush := exporter.GetSpans()[1]
+	assert.Equal(t, "queue.Flush", flush.Name)
+	if assert.Len(t, flush.Links, 2) {
+		assert.Equal(t, span.SpanContext().SpanID(), flush.Links[0].SpanContext.SpanID())
+	}
+}
+
 func wait(t *testing.T, ch <-chan []store.ViewTrack, timeout time.Duration) []store.ViewTrack {
 	select {
 	case tracks := <-ch:
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ Limiter = (*MemoryLimiter)(nil)
+
+// MemoryLimiter keeps the buckets in memory, so each server replica has its own limits.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// Time after which the bucket is full again, and can be forgotten.
+	full time.Time
+}
+
+// The idle buckets are deleted at this interval, since a full bucket is the same as no bucket.
+const sweepInterval = time.Minute
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	return l.AllowN(ctx, key, rate, 1)
+}
+
+func (l *MemoryLimiter) AllowN(ctx context.Context, key string, rate Rate, n int) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Requests), last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := float64(now.Sub(b.last)) / float64(time.Millisecond); elapsed > 0 {
+		b.tokens = math.Min(float64(rate.Requests), b.tokens+elapsed*rate.perMillisecond())
+		b.last = now
+	}
+
+	allowed := b.tokens >= float64(n)
+	if allowed {
+		b.tokens -= float64(n)
+	}
+
+	res := result(rate, n, allowed, b.tokens)
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/httperror"
+)
+
+const (
+	HeaderLimit      = "X-RateLimit-Limit"
+	HeaderRemaining  = "X-RateLimit-Remaining"
+	HeaderReset      = "X-RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// maxPeekBody is the maximum size of the body read for the hit IDs, the maximum body of a Bulk Track request.
+const maxPeekBody = 4 << 20
+
+// Middleware limits the Track and Bulk Track requests using every rule. A request over any limit gets 429 Too Many Requests,
+// and a request with more hits of an ID than the limit gets 413 Request Entity Too Large.
+// The rate limit headers are from the rule with the least remaining requests.
+//
+// The client IP is taken from the remote address, use chi's middleware.RealIP before if the server is behind a trusted proxy.
+// If the limiter fails, e.g. Redis is down, the request is allowed. The logger can be nil.
+func Middleware(limiter Limiter, logger *slog.Logger, rules ...Rule) func(http.Handler) http.Handler {
+	return New(limiter, logger, rules...).Middleware
+}
+
+// Middleware limits the Track and Bulk Track requests, as the Middleware func.
+func (l *Limits) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := Request{
+			IP:     clientIP(r),
+			Tenant: auth.TenantFromContext(r.Context()),
+		}
+
+		if key := auth.KeyFromContext(r.Context()); key != nil {
+			req.APIKey = key.ID
+		}
+
+		if l.byID() {
+			req.Hits = peekHits(r)
+		}
+
+		decision := l.Allow(r.Context(), req)
+
+		switch {
+		case decision.OverLimit:
+			httperror.Render(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("rate limit exceeded: %s, the limit is %d hits per ID", decision.Exceeded, decision.Result.Limit))
+			return
+
+		case decision.Exceeded != "":
+			writeHeaders(w, *decision.Result)
+			w.Header().Set(HeaderRetryAfter, strconv.Itoa(seconds(decision.Result.RetryAfter)))
+
+			httperror.Render(w, http.StatusTooManyRequests, "rate limit exceeded: "+decision.Exceeded)
+			return
+
+		case decision.Result != nil:
+			writeHeaders(w, *decision.Result)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// byID returns true if a rule limits the hits by ID.
+func (l *Limits) byID() bool {
+	for _, rule := range l.rules {
+		if rule.By == ByID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// peekHits returns the number of hits of each ID of the body, a Track hit, a JSON array or NDJSON Bulk Track hits.
+// The body is left intact for the handler. The invalid hits are skipped, the handler rejects them anyway.
+func peekHits(r *http.Request) map[string]int {
+	if r.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	if err != nil {
+		return nil
+	}
+
+	type hit struct {
+		ID string `json:"id"`
+	}
+
+	hits := make(map[string]int)
+
+	add := func(h hit) {
+		if h.ID != "" {
+			hits[h.ID]++
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var array []json.RawMessage
+		if err := json.Unmarshal(trimmed, &array); err != nil {
+			return nil
+		}
+
+		for _, line := range array {
+			var h hit
+			if json.Unmarshal(line, &h) == nil {
+				add(h)
+			}
+		}
+
+		return hits
+	}
+
+	var single hit
+	if json.Unmarshal(body, &single) == nil {
+		add(single)
+
+		return hits
+	}
+
+	// One hit per line.
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		var h hit
+		if json.Unmarshal(line, &h) == nil {
+			add(h)
+		}
+	}
+
+	return hits
+}
+
+func writeHeaders(w http.ResponseWriter, res Result) {
+	w.Header().Set(HeaderLimit, strconv.Itoa(res.Limit))
+	w.Header().Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+	w.Header().Set(HeaderReset, strconv.Itoa(seconds(res.Reset)))
+}
+
+// seconds rounds up, so a client waiting that long is never too early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	var bodies []string
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := auth.Anonymous("acme")(Middleware(NewMemoryLimiter(), nil,
+		Rule{Name: "ip", By: ByIP, Rate: Rate{Requests: 3, Period: time.Minute}},
+		Rule{Name: "id", By: ByID, Rate: Rate{Requests: 2, Period: time.Minute}},
+	)(next))
+
+	track := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/analytics", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := track("10.0.0.1:1234", `{"id":"1"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2", w.Header().Get(HeaderLimit), "tightest rule")
+	assert.Equal(t, "1", w.Header().Get(HeaderRemaining))
+	assert.Equal(t, "30", w.Header().Get(HeaderReset))
+
+	// The handler still gets the body.
+	assert.Equal(t, []string{`{"id":"1"}`}, bodies)
+
+	assert.Equal(t, http.StatusNoContent, track("10.0.0.2:1234", `{"id":"1"}`).Code)
+
+	w = track("10.0.0.3:1234", `{"id":"1"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "id limit")
+	assert.Equal(t, "30", w.Header().Get(HeaderRetryAfter))
+	assert.Equal(t, "0", w.Header().Get(HeaderRemaining))
+	assert.JSONEq(t, `{"message":"rate limit exceeded: id"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, track("10.0.0.1:1234", `{"id":"2"}`).Code)
+
+	// The invalid bodies are only limited by IP.
+	assert.Equal(t, http.StatusNoContent, track("10.0.0.1:1234", `{`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, track("10.0.0.1:1234", `{"id":"3"}`).Code, "ip limit")
+
+	assert.Len(t, bodies, 4)
+}
+
+func TestMiddlewareBulk(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := auth.Anonymous("acme")(Middleware(NewMemoryLimiter(), nil,
+		Rule{Name: "ip", By: ByIP, Rate: Rate{Requests: 10, Period: time.Minute}},
+		Rule{Name: "id", By: ByID, Rate: Rate{Requests: 3, Period: time.Minute}},
+	)(next))
+
+	bulk := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics/_bulk", strings.NewReader(body)))
+
+		return w
+	}
+
+	// A token per hit of each ID, and per request for the IP.
+	w := bulk(`[{"id":"1"},{"id":"1"},{"id":"2"}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HeaderRemaining), "id 1")
+
+	w = bulk("{\"id\":\"1\"}\n{\"id\":\"1\"}\n")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"message":"rate limit exceeded: id"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, bulk("{\"id\":\"1\"}\n{\"id\":\"2\"}\n").Code)
+
+	// More hits of an ID than the limit are never allowed.
+	w = bulk(`[{"id":"3"},{"id":"3"},{"id":"3"},{"id":"3"}]`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"message":"rate limit exceeded: id, the limit is 3 hits per ID"}`, w.Body.String())
+}
+
+func TestPeekHits(t *testing.T) {
+	for body, hits := range map[string]map[string]int{
+		`{"id":"1"}`:                         {"1": 1},
+		"{\n  \"id\": \"1\"\n}":              {"1": 1},
+		`[{"id":"1"},{"id":"2"},{"id":"1"}]`: {"1": 2, "2": 1},
+		"{\"id\":\"1\"}\n{\"id\":\"1\"}\n{":  {"1": 2},
+		`[{"id":"1"},"2",{}]`:                {"1": 1},
+		`{`:                                  {},
+	} {
+		r := httptest.NewRequest("POST", "/analytics", strings.NewReader(body))
+
+		assert.Equal(t, hits, peekHits(r), body)
+
+		// The handler still gets the body.
+		read, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, body, string(read))
+	}
+}
+
+func TestMiddlewareByAPIKey(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := Middleware(NewMemoryLimiter(), nil,
+		Rule{Name: "key", By: ByAPIKey, Rate: Rate{Requests: 1, Period: time.Minute}},
+	)(next)
+
+	request := func(key *auth.Key) int {
+		r := httptest.NewRequest("POST", "/analytics", nil)
+		if key != nil {
+			r = r.WithContext(auth.WithKey(r.Context(), key))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	mobile := &auth.Key{ID: "mobile", Tenant: "acme"}
+
+	assert.Equal(t, http.StatusNoContent, request(mobile))
+	assert.Equal(t, http.StatusTooManyRequests, request(mobile))
+	assert.Equal(t, http.StatusNoContent, request(&auth.Key{ID: "web", Tenant: "acme"}))
+
+	// The anonymous requests are not limited by key.
+	assert.Equal(t, http.StatusNoContent, request(nil))
+	assert.Equal(t, http.StatusNoContent, request(nil))
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	return Result{}, errors.New("redis is down")
+}
+
+func (failingLimiter) AllowN(ctx context.Context, key string, rate Rate, n int) (Result, error) {
+	return Result{}, errors.New("redis is down")
+}
+
+func TestMiddlewareLimiterError(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := Middleware(failingLimiter{}, nil, Rule{Name: "ip", By: ByIP, Rate: Rate{Requests: 1, Period: time.Minute}})(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/analytics", nil))
+
+	// Fail open.
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderLimit))
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Rate allows Requests per Period, with bursts up to Requests.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result is the state of the bucket after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed. Zero if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter is a token bucket rate limiter. Each key has its own bucket.
+type Limiter interface {
+	// Allow takes one token from the bucket of the key, if any.
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+	// AllowN takes n tokens from the bucket of the key, if there are enough, e.g. for a batch of hits.
+	AllowN(ctx context.Context, key string, rate Rate, n int) (Result, error)
+}
+
+// perMillisecond returns the tokens added to a bucket every millisecond.
+func (r Rate) perMillisecond() float64 {
+	return float64(r.Requests) / float64(r.Period.Milliseconds())
+}
+
+// result returns the result of a request taking n tokens, given the tokens left in the bucket.
+func result(rate Rate, n int, allowed bool, tokens float64) Result {
+	refill := rate.perMillisecond()
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     rate.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(rate.Requests)-tokens)/refill)) * time.Millisecond,
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration(math.Ceil((float64(n)-tokens)/refill)) * time.Millisecond
+	}
+
+	return res
+}
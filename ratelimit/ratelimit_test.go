@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+// testLimiter runs the same scenario on every limiter: a burst of 3, refilled at one token per 100ms.
+func testLimiter(t *testing.T, limiter Limiter, advance func(time.Duration)) {
+	rate := Rate{Requests: 3, Period: 300 * time.Millisecond}
+
+	allow := func(key string) Result {
+		res, err := limiter.Allow(context.Background(), key, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res
+	}
+
+	for i := 2; i >= 0; i-- {
+		res := allow("a")
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res := allow("a")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 100*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 300*time.Millisecond, res.Reset)
+
+	// The other keys have their own bucket.
+	assert.True(t, allow("b").Allowed)
+
+	advance(150 * time.Millisecond)
+
+	res = allow("a")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 250*time.Millisecond, res.Reset)
+
+	// Never more than the burst, after a long time.
+	advance(time.Hour)
+
+	assert.Equal(t, 2, allow("a").Remaining)
+
+	// The tokens of a batch are taken together, or not at all.
+	res, err := limiter.AllowN(context.Background(), "a", rate, 3)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+	assert.Equal(t, 100*time.Millisecond, res.RetryAfter)
+
+	res, err = limiter.AllowN(context.Background(), "a", rate, 2)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+
+	testLimiter(t, limiter, func(d time.Duration) {
+		now = now.Add(d)
+	})
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	now := time.Now()
+
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+
+	rate := Rate{Requests: 1, Period: time.Second}
+
+	limiter.Allow(context.Background(), "idle", rate)
+
+	now = now.Add(sweepInterval)
+
+	limiter.Allow(context.Background(), "busy", rate)
+
+	// The idle bucket was full again, so it is forgotten.
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "busy")
+}
+
+func TestRedisLimiter(t *testing.T) {
+	s, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	now := time.Now()
+
+	limiter := NewRedisLimiter(client, "ratelimit:")
+	limiter.now = func() time.Time { return now }
+
+	testLimiter(t, limiter, func(d time.Duration) {
+		now = now.Add(d)
+		s.FastForward(d)
+	})
+
+	assert.True(t, s.Exists("ratelimit:a"))
+
+	// The buckets expire once they would be full again.
+	s.FastForward(time.Second)
+
+	assert.False(t, s.Exists("ratelimit:a"))
+}
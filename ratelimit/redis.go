@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+var _ Limiter = (*RedisLimiter)(nil)
+
+// tokenBucketScript refills the bucket and takes the tokens, atomically.
+// The tokens are returned as a string, since Redis truncates the Lua numbers to integers.
+//
+// KEYS[1] bucket key
+// ARGV[1] capacity, ARGV[2] tokens per millisecond, ARGV[3] now in milliseconds, ARGV[4] TTL in milliseconds,
+// ARGV[5] tokens taken
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refill = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[5])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+
+if tokens == nil or last == nil then
+	tokens = capacity
+	last = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - last) * refill)
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(math.max(now, last)))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiter keeps the buckets in Redis, so the limits are shared by every server replica.
+// The time is taken from the replicas, their clocks are expected to be roughly in sync.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+
+	now func() time.Time
+}
+
+// NewRedisLimiter creates the limiter. The buckets are stored in the hashes <prefix><key>, expiring once full.
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	return l.AllowN(ctx, key, rate, 1)
+}
+
+func (l *RedisLimiter) AllowN(ctx context.Context, key string, rate Rate, n int) (Result, error) {
+	now := l.now().UnixNano() / int64(time.Millisecond)
+
+	// A bucket left alone for a period is full again, same as no bucket.
+	ttl := rate.Period.Milliseconds()
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	res, err := tokenBucketScript.Run(l.client, []string{l.prefix + key}, []string{
+		strconv.Itoa(rate.Requests),
+		strconv.FormatFloat(rate.perMillisecond(), 'g', -1, 64),
+		strconv.FormatInt(now, 10),
+		strconv.FormatInt(ttl, 10),
+		strconv.Itoa(n),
+	}).Result()
+	if err != nil {
+		return Result{}, errors.Wrap(err, "redis")
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, errors.Errorf("unexpected script result %v", res)
+	}
+
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "script tokens")
+	}
+
+	return result(rate, n, allowed == 1, tokens), nil
+}
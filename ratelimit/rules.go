@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+)
+
+// By is what a rule limits the requests by.
+type By string
+
+const (
+	// ByIP limits the requests of a client IP, a token per request.
+	ByIP By = "ip"
+	// ByAPIKey limits the requests of an API key, a token per request. The anonymous requests are skipped.
+	ByAPIKey By = "api_key"
+	// ByID limits the hits of an ID of the tenant, a token per hit, so a batch takes a token per hit of each of its IDs.
+	ByID By = "id"
+)
+
+// Rule limits the requests with the same key to the rate.
+type Rule struct {
+	// Name prefixes the keys, so the rules have separate buckets.
+	Name string
+	By   By
+	Rate Rate
+}
+
+// Request is a Track request, from the HTTP or the gRPC API, as seen by the rules.
+type Request struct {
+	IP string
+	// APIKey is the ID of the key, empty for the anonymous requests.
+	APIKey string
+	Tenant string
+	// Hits are the number of hits of each ID.
+	Hits map[string]int
+}
+
+// keys returns the buckets of the request for the rule, with the tokens taken from each.
+func (r Request) keys(by By) map[string]int {
+	switch by {
+	case ByIP:
+		if r.IP != "" {
+			return map[string]int{r.IP: 1}
+		}
+
+	case ByAPIKey:
+		if r.APIKey != "" {
+			return map[string]int{r.APIKey: 1}
+		}
+
+	case ByID:
+		keys := make(map[string]int, len(r.Hits))
+		for id, hits := range r.Hits {
+			keys[r.Tenant+":"+id] = hits
+		}
+
+		return keys
+	}
+
+	return nil
+}
+
+// Decision is the outcome of the rules for a request.
+type Decision struct {
+	// Result of the exceeded rule, or of the rule with the least remaining requests. Nil if no rule applies.
+	Result *Result
+	// Exceeded is the name of the exceeded rule, empty if the request is allowed.
+	Exceeded string
+	// OverLimit is set when the request takes more tokens than the limit of the exceeded rule,
+	// e.g. a batch with more hits of an ID than allowed per period: it would never be allowed, even retried.
+	OverLimit bool
+}
+
+// Limits checks the requests against the rules, using the limiter.
+// Both the HTTP middleware and the gRPC interceptors use it, so the APIs share the same buckets.
+type Limits struct {
+	limiter Limiter
+	rules   []Rule
+	logger  *slog.Logger
+}
+
+// New creates the limits. The logger can be nil.
+func New(limiter Limiter, logger *slog.Logger, rules ...Rule) *Limits {
+	return &Limits{
+		limiter: limiter,
+		rules:   rules,
+		logger:  logging.OrDiscard(logger),
+	}
+}
+
+// Allow takes the tokens of the request from the bucket of every rule, until one of them is exceeded.
+//
+// If the limiter fails, e.g. Redis is down, the rule is skipped, so the request is allowed.
+func (l *Limits) Allow(ctx context.Context, req Request) Decision {
+	var decision Decision
+
+	for _, rule := range l.rules {
+		for key, tokens := range req.keys(rule.By) {
+			if tokens > rule.Rate.Requests {
+				return Decision{
+					Result:    &Result{Limit: rule.Rate.Requests},
+					Exceeded:  rule.Name,
+					OverLimit: true,
+				}
+			}
+
+			res, err := l.limiter.AllowN(ctx, rule.Name+":"+key, rule.Rate, tokens)
+			if err != nil {
+				logging.FromContext(ctx, l.logger).Error("rate limit", slog.String("rule", rule.Name), logging.Error(err))
+				continue
+			}
+
+			if !res.Allowed {
+				return Decision{Result: &res, Exceeded: rule.Name}
+			}
+
+			if decision.Result == nil || res.Remaining < decision.Result.Remaining {
+				res := res
+				decision.Result = &res
+			}
+		}
+	}
+
+	return decision
+}
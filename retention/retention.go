@@ -0,0 +1,191 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// Janitor periodically deletes the views older than the retention of their tenant.
+//
+// Each tenant can have its own retention, the other tenants use the default retention.
+// A zero retention keeps the views forever.
+type Janitor struct {
+	purger store.ViewPurger
+	logger *slog.Logger
+
+	interval         time.Duration
+	pollInterval     time.Duration
+	defaultRetention time.Duration
+	tenants          map[string]time.Duration
+
+	now func() time.Time
+}
+
+type Option func(*Janitor)
+
+// Default interval is 1 hour.
+func WithInterval(interval time.Duration) func(*Janitor) {
+	return func(j *Janitor) {
+		j.interval = interval
+	}
+}
+
+// WithPollInterval sets the interval between the status checks of a purge task. Default is 5 seconds.
+func WithPollInterval(interval time.Duration) func(*Janitor) {
+	return func(j *Janitor) {
+		j.pollInterval = interval
+	}
+}
+
+// WithRetention sets the default retention, and the retention of each tenant. Default is to keep the views forever.
+func WithRetention(defaultRetention time.Duration, tenants map[string]time.Duration) func(*Janitor) {
+	return func(j *Janitor) {
+		j.defaultRetention = defaultRetention
+		j.tenants = tenants
+	}
+}
+
+// The logger can be nil.
+func NewJanitor(purger store.ViewPurger, logger *slog.Logger, opts ...Option) *Janitor {
+	j := &Janitor{
+		purger:       purger,
+		logger:       logging.OrDiscard(logger).With(slog.String("component", "retention")),
+		interval:     time.Hour,
+		pollInterval: 5 * time.Second,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	return j
+}
+
+// Enabled returns true if any tenant has a retention.
+func (j *Janitor) Enabled() bool {
+	if j.defaultRetention > 0 {
+		return true
+	}
+
+	for _, retention := range j.tenants {
+		if retention > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run purges the expired views immediately, then at every interval, until the context is done.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Purge(ctx); err != nil && ctx.Err() == nil {
+			j.logger.Error("purge expired views", logging.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the expired views of every tenant and waits for the deletes to complete.
+func (j *Janitor) Purge(ctx context.Context) error {
+	now := j.now()
+
+	var errs []error
+
+	for _, tenant := range j.sortedTenants() {
+		retention := j.tenants[tenant]
+		if retention <= 0 {
+			continue
+		}
+
+		errs = append(errs, j.purge(ctx, store.PurgeFilter{Tenant: tenant, Before: now.Add(-retention)}))
+	}
+
+	if j.defaultRetention > 0 {
+		errs = append(errs, j.purge(ctx, store.PurgeFilter{Before: now.Add(-j.defaultRetention), ExcludeTenants: j.sortedTenants()}))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *Janitor) purge(ctx context.Context, f store.PurgeFilter) error {
+	taskID, err := j.purger.Purge(ctx, f)
+	if err != nil {
+		return errors.Wrapf(err, "purge tenant %q", f.Tenant)
+	}
+
+	status, err := Wait(ctx, j.purger, taskID, j.pollInterval, nil)
+	if err != nil {
+		return errors.Wrapf(err, "purge tenant %q", f.Tenant)
+	}
+
+	j.logger.Info("purged expired views",
+		slog.String("tenant", f.Tenant),
+		slog.Time("before", f.Before),
+		slog.Int64("deleted", status.Deleted))
+
+	return nil
+}
+
+// sortedTenants returns the tenants with their own retention, sorted so the purges are in a stable order.
+func (j *Janitor) sortedTenants() []string {
+	tenants := make([]string, 0, len(j.tenants))
+	for tenant := range j.tenants {
+		tenants = append(tenants, tenant)
+	}
+
+	sort.Strings(tenants)
+
+	return tenants
+}
+
+// Wait polls the status of the purge task until it is completed.
+// The progress func, if not nil, is called with every status.
+func Wait(ctx context.Context, purger store.ViewPurger, taskID string, pollInterval time.Duration, progress func(store.PurgeStatus)) (store.PurgeStatus, error) {
+	for {
+		status, err := purger.PurgeStatus(ctx, taskID)
+		if err != nil {
+			return status, errors.Wrapf(err, "task %s", taskID)
+		}
+
+		if progress != nil {
+			progress(status)
+		}
+
+		if status.Error != "" {
+			return status, errors.Errorf("task %s: %s", taskID, status.Error)
+		}
+
+		if status.Completed {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/mock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var filters []store.PurgeFilter
+	var polls int
+
+	purger := &mock.ViewPurger{
+		OnPurge: func(ctx context.Context, f store.PurgeFilter) (string, error) {
+			filters = append(filters, f)
+			return "node:1", nil
+		},
+		OnPurgeStatus: func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+			polls++
+			// Complete on the second poll.
+			return store.PurgeStatus{Completed: polls%2 == 0, Deleted: 3}, nil
+		},
+	}
+
+	j := NewJanitor(purger, nil,
+		WithPollInterval(time.Millisecond),
+		WithRetention(30*24*time.Hour, map[string]time.Duration{
+			"globex": 7 * 24 * time.Hour,
+			"acme":   0,
+		}))
+	j.now = func() time.Time { return now }
+
+	assert.True(t, j.Enabled())
+	assert.NoError(t, j.Purge(context.Background()))
+
+	assert.Equal(t, []store.PurgeFilter{
+		{Tenant: "globex", Before: now.Add(-7 * 24 * time.Hour)},
+		{Before: now.Add(-30 * 24 * time.Hour), ExcludeTenants: []string{"acme", "globex"}},
+	}, filters)
+	assert.Equal(t, 4, polls)
+}
+
+func TestPurgeDisabled(t *testing.T) {
+	purger := &mock.ViewPurger{
+		OnPurge: func(ctx context.Context, f store.PurgeFilter) (string, error) {
+			t.Fatal("purge must not be called")
+			return "", nil
+		},
+	}
+
+	j := NewJanitor(purger, nil, WithRetention(0, map[string]time.Duration{"acme": 0}))
+
+	assert.False(t, j.Enabled())
+	assert.NoError(t, j.Purge(context.Background()))
+}
+
+func TestPurgeError(t *testing.T) {
+	var tenants []string
+
+	purger := &mock.ViewPurger{
+		OnPurge: func(ctx context.Context, f store.PurgeFilter) (string, error) {
+			tenants = append(tenants, f.Tenant)
+
+			if f.Tenant == "acme" {
+				return "", errors.New("unavailable")
+			}
+
+			return "node:1", nil
+		},
+		OnPurgeStatus: func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+			return store.PurgeStatus{Completed: true}, nil
+		},
+	}
+
+	j := NewJanitor(purger, nil, WithRetention(0, map[string]time.Duration{
+		"acme":   time.Hour,
+		"globex": time.Hour,
+	}))
+
+	assert.EqualError(t, j.Purge(context.Background()), `purge tenant "acme": unavailable`)
+
+	// A failed tenant doesn't stop the purge of the others.
+	assert.Equal(t, []string{"acme", "globex"}, tenants)
+}
+
+func TestWait(t *testing.T) {
+	purger := &mock.ViewPurger{
+		OnPurgeStatus: func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+			return store.PurgeStatus{Completed: true, Error: "version_conflict"}, nil
+		},
+	}
+
+	var progress []store.PurgeStatus
+
+	_, err := Wait(context.Background(), purger, "node:1", time.Millisecond, func(s store.PurgeStatus) {
+		progress = append(progress, s)
+	})
+	assert.EqualError(t, err, "task node:1: version_conflict")
+	assert.Len(t, progress, 1)
+
+	// Never completed, until the context is done.
+	purger.OnPurgeStatus = func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+		return store.PurgeStatus{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = Wait(ctx, purger, "node:1", time.Millisecond, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	var purges int
+
+	purger := &mock.ViewPurger{
+		OnPurge: func(ctx context.Context, f store.PurgeFilter) (string, error) {
+			mu.Lock()
+			purges++
+			mu.Unlock()
+
+			return "node:1", nil
+		},
+		OnPurgeStatus: func(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+			return store.PurgeStatus{Completed: true}, nil
+		},
+	}
+
+	j := NewJanitor(purger, nil, WithInterval(10*time.Millisecond), WithRetention(time.Hour, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(35 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Immediately, then at every interval.
+	assert.True(t, purges >= 3, "purges %d", purges)
+}
@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/redis.v3"
+)
+
+// TaskOwners records the tenant of the purge tasks, so a tenant only gets the status of its own tasks.
+type TaskOwners interface {
+	// Add records the task of the tenant.
+	Add(ctx context.Context, tenant, taskID string) error
+	// Owns returns true if the task was added by the tenant.
+	Owns(ctx context.Context, tenant, taskID string) (bool, error)
+}
+
+var _ TaskOwners = (*MemoryTaskOwners)(nil)
+
+// MemoryTaskOwners keeps the tasks in memory, so they are only known by the server replica which started them.
+// The tasks are few, they are never forgotten.
+type MemoryTaskOwners struct {
+	mu    sync.Mutex
+	tasks map[string]string
+}
+
+func NewMemoryTaskOwners() *MemoryTaskOwners {
+	return &MemoryTaskOwners{
+		tasks: make(map[string]string),
+	}
+}
+
+func (o *MemoryTaskOwners) Add(ctx context.Context, tenant, taskID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.tasks[taskID] = tenant
+
+	return nil
+}
+
+func (o *MemoryTaskOwners) Owns(ctx context.Context, tenant, taskID string) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	owner, ok := o.tasks[taskID]
+
+	return ok && owner == tenant, nil
+}
+
+var _ TaskOwners = (*RedisTaskOwners)(nil)
+
+// RedisTaskOwners keeps the tasks in Redis, so every server replica knows them.
+type RedisTaskOwners struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisTaskOwners creates the owners. The tasks are stored as <prefix><tenant>:<task ID>, forgotten after the TTL.
+func NewRedisTaskOwners(client *redis.Client, prefix string, ttl time.Duration) *RedisTaskOwners {
+	return &RedisTaskOwners{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (o *RedisTaskOwners) Add(ctx context.Context, tenant, taskID string) error {
+	return errors.Wrap(o.client.Set(o.key(tenant, taskID), "1", o.ttl).Err(), "redis")
+}
+
+func (o *RedisTaskOwners) Owns(ctx context.Context, tenant, taskID string) (bool, error) {
+	owns, err := o.client.Exists(o.key(tenant, taskID)).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "redis")
+	}
+
+	return owns, nil
+}
+
+func (o *RedisTaskOwners) key(tenant, taskID string) string {
+	return o.prefix + tenant + ":" + taskID
+}
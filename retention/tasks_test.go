@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+// testTaskOwners runs the same scenario on every implementation.
+func testTaskOwners(t *testing.T, owners TaskOwners) {
+	ctx := context.Background()
+
+	owns := func(tenant, taskID string) bool {
+		ok, err := owners.Owns(ctx, tenant, taskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ok
+	}
+
+	assert.False(t, owns("acme", "node:1"))
+
+	assert.NoError(t, owners.Add(ctx, "acme", "node:1"))
+
+	assert.True(t, owns("acme", "node:1"))
+	assert.False(t, owns("globex", "node:1"), "another tenant")
+	assert.False(t, owns("acme", "node:2"), "another task")
+}
+
+func TestMemoryTaskOwners(t *testing.T) {
+	testTaskOwners(t, NewMemoryTaskOwners())
+}
+
+func TestRedisTaskOwners(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	owners := NewRedisTaskOwners(client, "erasure:", time.Hour)
+
+	testTaskOwners(t, owners)
+
+	// The tasks are forgotten after the TTL.
+	s.FastForward(time.Hour)
+
+	ok, err := owners.Owns(context.Background(), "acme", "node:1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
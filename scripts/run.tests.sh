@@ -12,7 +12,7 @@ if [[ ${EXISTING} ]]; then
   docker rm -vf "${EXISTING}" >/dev/null >>/dev/null
 fi
 
-docker run --name ${ES_CONTAINER_NAME} -d -p 9200:9200 -p 9300:9300 -e "discovery.type=single-node" -e "network.host=_local_,_site_" -e "network.publish_host=_local_" docker.elastic.co/elasticsearch/elasticsearch:7.6.0 >/dev/null
+docker run --name ${ES_CONTAINER_NAME} -d -p 9200:9200 -p 9300:9300 -e "discovery.type=single-node" -e "network.host=_local_,_site_" -e "network.publish_host=_local_" docker.elastic.co/elasticsearch/elasticsearch:7.17.9 >/dev/null
 
 go test -v -covermode=atomic -tags=integration, -timeout=15m ./...
 
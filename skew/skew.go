@@ -0,0 +1,75 @@
+package skew
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy is what happens to a hit with a timestamp outside of the window.
+type Policy string
+
+const (
+	// PolicyReject rejects the hit.
+	PolicyReject Policy = "reject"
+	// PolicyClamp moves the timestamp to the closest edge of the window.
+	PolicyClamp Policy = "clamp"
+	// PolicyLate keeps the timestamp of a too old hit, and marks the hit as late, so it is stored apart from the others.
+	// A hit too far in the future is rejected, it can't be late.
+	PolicyLate Policy = "late"
+)
+
+var (
+	ErrTooOld   = errors.New("timestamp is older than the max past skew")
+	ErrInFuture = errors.New("timestamp is further in the future than the max future skew")
+)
+
+// Window validates the client timestamps against the server time.
+// A timestamp is valid from maxPast before now until maxFuture after now.
+type Window struct {
+	maxPast   time.Duration
+	maxFuture time.Duration
+	policy    Policy
+
+	now func() time.Time
+}
+
+func NewWindow(maxPast, maxFuture time.Duration, policy Policy) *Window {
+	return &Window{
+		maxPast:   maxPast,
+		maxFuture: maxFuture,
+		policy:    policy,
+		now:       time.Now,
+	}
+}
+
+// Check returns the timestamp to store, and if the hit is late, according to the policy.
+// The error is ErrTooOld or ErrInFuture if the hit is rejected. A nil window accepts every timestamp.
+func (w *Window) Check(timestamp time.Time) (time.Time, bool, error) {
+	if w == nil {
+		return timestamp, false, nil
+	}
+
+	now := w.now()
+
+	if oldest := now.Add(-w.maxPast); timestamp.Before(oldest) {
+		switch w.policy {
+		case PolicyClamp:
+			return oldest, false, nil
+		case PolicyLate:
+			return timestamp, true, nil
+		default:
+			return time.Time{}, false, ErrTooOld
+		}
+	}
+
+	if newest := now.Add(w.maxFuture); timestamp.After(newest) {
+		if w.policy == PolicyClamp {
+			return newest, false, nil
+		}
+
+		return time.Time{}, false, ErrInFuture
+	}
+
+	return timestamp, false, nil
+}
@@ -0,0 +1,55 @@
+package skew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	old := now.Add(-25 * time.Hour)
+	future := now.Add(10 * time.Minute)
+	recent := now.Add(-time.Hour)
+
+	tests := []struct {
+		policy    Policy
+		timestamp time.Time
+		want      time.Time
+		wantLate  bool
+		wantErr   error
+	}{
+		{policy: PolicyReject, timestamp: recent, want: recent},
+		{policy: PolicyReject, timestamp: now.Add(5 * time.Minute), want: now.Add(5 * time.Minute)},
+		{policy: PolicyReject, timestamp: old, wantErr: ErrTooOld},
+		{policy: PolicyReject, timestamp: future, wantErr: ErrInFuture},
+
+		{policy: PolicyClamp, timestamp: recent, want: recent},
+		{policy: PolicyClamp, timestamp: old, want: now.Add(-24 * time.Hour)},
+		{policy: PolicyClamp, timestamp: future, want: now.Add(5 * time.Minute)},
+
+		{policy: PolicyLate, timestamp: recent, want: recent},
+		{policy: PolicyLate, timestamp: old, want: old, wantLate: true},
+		{policy: PolicyLate, timestamp: future, wantErr: ErrInFuture},
+	}
+
+	for _, tc := range tests {
+		w := NewWindow(24*time.Hour, 5*time.Minute, tc.policy)
+		w.now = func() time.Time { return now }
+
+		timestamp, late, err := w.Check(tc.timestamp)
+
+		assert.Equal(t, tc.wantErr, err, "%s %s", tc.policy, tc.timestamp)
+		assert.Equal(t, tc.want, timestamp, "%s %s", tc.policy, tc.timestamp)
+		assert.Equal(t, tc.wantLate, late, "%s %s", tc.policy, tc.timestamp)
+	}
+
+	var nilWindow *Window
+
+	timestamp, late, err := nilWindow.Check(old)
+	assert.NoError(t, err)
+	assert.Equal(t, old, timestamp)
+	assert.False(t, late)
+}
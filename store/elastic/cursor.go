@@ -0,0 +1,52 @@
+package elastic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/pkg/errors"
+)
+
+// cursor is the position after a page of hits.
+type cursor struct {
+	// PIT is the ID of the point in time searched by the pages.
+	PIT string `json:"pit"`
+	// From and To are the range of the first page, searched by the next pages.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Sort are the sort values of the last hit of the page.
+	Sort []interface{} `json:"sort"`
+}
+
+// encodeCursor encodes the cursor as an opaque string.
+func encodeCursor(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "cursor")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes the cursor, to search after its sort values.
+func decodeCursor(s string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, store.ErrInvalidCursor
+	}
+
+	// Keep the numbers as they are, the timestamps in milliseconds and the shard docs.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var c cursor
+	if err := dec.Decode(&c); err != nil || c.PIT == "" || len(c.Sort) != 2 {
+		return cursor{}, store.ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,42 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The sort values of a hit, as decoded by the client.
+	s, err := encodeCursor(cursor{PIT: "pit", From: from, To: from.Add(time.Hour), Sort: []interface{}{float64(1577836800123), float64(42)}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	c, err := decodeCursor(s)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pit", c.PIT)
+		assert.True(t, from.Equal(c.From))
+		assert.True(t, from.Add(time.Hour).Equal(c.To))
+		assert.Equal(t, []interface{}{json.Number("1577836800123"), json.Number("42")}, c.Sort)
+	}
+
+	_, err = decodeCursor("not a cursor")
+	assert.Equal(t, store.ErrInvalidCursor, err)
+
+	s, _ = encodeCursor(cursor{PIT: "pit", Sort: []interface{}{float64(1577836800123)}})
+
+	_, err = decodeCursor(s)
+	assert.Equal(t, store.ErrInvalidCursor, err)
+
+	s, _ = encodeCursor(cursor{Sort: []interface{}{float64(1577836800123), float64(42)}})
+
+	_, err = decodeCursor(s)
+	assert.Equal(t, store.ErrInvalidCursor, err)
+}
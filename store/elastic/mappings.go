@@ -1,18 +1,102 @@
 package elastic
 
-const mapping = `{
-	"settings":{
-		"number_of_shards":2,
-		"number_of_replicas":0
-	},
-	"mappings":{
-		"properties":{
+import (
+	"fmt"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+// Migration is a version of the mapping of the views.
+type Migration struct {
+	Version     int
+	Description string
+	// Properties are the whole mapping properties of the version, not only the changes.
+	Properties string
+	// Reindex is set for the changes incompatible with the indexed views, e.g. a changed field type.
+	// The views are reindexed into an index with the new mapping. Otherwise the properties are put on the existing indices,
+	// which only allows adding fields.
+	Reindex bool
+	// Backfill is an optional painless script updating the indexed views, e.g. to set a new field.
+	// It is run on every view, by an update by query once the properties are put, or by the reindex.
+	// It must not set ctx.op, the reindex would skip the view.
+	Backfill string
+}
+
+// migrations are the versions of the mapping, in order. The indices are created with the latest.
+// To change the mapping, append a migration with the next version, and run the admin migrate command.
+//
+// The indices created before the versions are the version 0, they have no tenant mapping,
+// and their views no tenant: the version 1 sets the default tenant.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "tenant, id and timestamp, the views without a tenant belong to the default tenant",
+		Properties: `{
+			"tenant":{
+				"type":"keyword"
+			},
 			"id":{
 				"type":"keyword"
 			},
 			"timestamp":{
 				"type":"date"
 			}
-		}
+		}`,
+		Backfill: fmt.Sprintf(`if (ctx._source.tenant == null) { ctx._source.tenant = '%s' }`, store.DefaultTenant),
+	},
+}
+
+// mappings returns the mappings of the migration, with its version in _meta.
+func mappings(m Migration) string {
+	return fmt.Sprintf(`{
+		"_meta":{
+			"version":%d
+		},
+		"properties":%s
+	}`, m.Version, m.Properties)
+}
+
+// mapping returns the index settings and mappings.
+func mapping(shards, replicas int, m Migration) string {
+	return fmt.Sprintf(`{
+	"settings":{
+		"number_of_shards":%d,
+		"number_of_replicas":%d
+	},
+	"mappings":%s
+}`, shards, replicas, mappings(m))
+}
+
+// template returns the index template of the rollover indices. They are managed by the policy,
+// rolled over using the write alias, and added to the read alias.
+func template(pattern string, shards, replicas int, policy, writeAlias, readAlias string, m Migration) string {
+	return fmt.Sprintf(`{
+	"index_patterns":[%q],
+	"settings":{
+		"number_of_shards":%d,
+		"number_of_replicas":%d,
+		"index.lifecycle.name":%q,
+		"index.lifecycle.rollover_alias":%q
+	},
+	"mappings":%s,
+	"aliases":{
+		%q:{}
 	}
-}`
+}`, pattern, shards, replicas, policy, writeAlias, mappings(m), readAlias)
+}
+
+// lifecyclePolicy returns the policy rolling over the write index after maxAge or maxSize, if not empty,
+// and deleting the indices once they are rolled over for retention, if not zero.
+func lifecyclePolicy(r Rollover) string {
+	rollover := fmt.Sprintf(`"max_age":"%ds"`, int64(r.MaxAge.Seconds()))
+	if r.MaxSize != "" {
+		rollover += fmt.Sprintf(`,"max_size":%q`, r.MaxSize)
+	}
+
+	phases := fmt.Sprintf(`"hot":{"actions":{"rollover":{%s}}}`, rollover)
+	if r.Retention > 0 {
+		phases += fmt.Sprintf(`,"delete":{"min_age":"%ds","actions":{"delete":{}}}`, int64(r.Retention.Seconds()))
+	}
+
+	return fmt.Sprintf(`{"policy":{"phases":{%s}}}`, phases)
+}
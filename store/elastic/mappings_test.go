@@ -0,0 +1,41 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecyclePolicy(t *testing.T) {
+	assert.JSONEq(t,
+		`{"policy":{"phases":{"hot":{"actions":{"rollover":{"max_age":"86400s"}}}}}}`,
+		lifecyclePolicy(Rollover{MaxAge: 24 * time.Hour}))
+
+	assert.JSONEq(t,
+		`{"policy":{"phases":{
+			"hot":{"actions":{"rollover":{"max_age":"3600s","max_size":"50gb"}}},
+			"delete":{"min_age":"604800s","actions":{"delete":{}}}
+		}}}`,
+		lifecyclePolicy(Rollover{MaxAge: time.Hour, MaxSize: "50gb", Retention: 7 * 24 * time.Hour}))
+}
+
+func TestTemplate(t *testing.T) {
+	var body struct {
+		IndexPatterns []string               `json:"index_patterns"`
+		Settings      map[string]interface{} `json:"settings"`
+		Aliases       map[string]interface{} `json:"aliases"`
+	}
+
+	if err := json.Unmarshal([]byte(template("views-*", 2, 1, "views-policy", "views-write", "views-read", latest(migrations))), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"views-*"}, body.IndexPatterns)
+	assert.Equal(t, "views-policy", body.Settings["index.lifecycle.name"])
+	assert.Equal(t, "views-write", body.Settings["index.lifecycle.rollover_alias"])
+	assert.Contains(t, body.Aliases, "views-read")
+
+	assert.True(t, json.Valid([]byte(mapping(2, 1, latest(migrations)))))
+}
@@ -0,0 +1,301 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/pkg/errors"
+)
+
+// reindexPollInterval is the interval between the checks of a reindex task.
+var reindexPollInterval = 2 * time.Second
+
+// latest returns the latest migration.
+func latest(migrations []Migration) Migration {
+	return migrations[len(migrations)-1]
+}
+
+// MappingVersion returns the mapping version of the index the views are written to.
+// The indices created before the versions have none, they are the version 0.
+func (s *Store) MappingVersion(ctx context.Context) (int, error) {
+	return mappingVersion(ctx, s.client, s.writeIndex)
+}
+
+// LatestMappingVersion returns the version the indices are created with, and migrated to.
+func (s *Store) LatestMappingVersion() int {
+	return latest(s.migrations).Version
+}
+
+// mappingVersion returns the lowest mapping version of the indices of the name, an index or an alias.
+func mappingVersion(ctx context.Context, client *elastic.Client, name string) (int, error) {
+	res, err := client.GetMapping().Index(name).Do(ctx)
+	if err != nil {
+		return 0, errors.Wrapf(err, "get mapping %s", name)
+	}
+
+	// Decode the _meta of the mappings of each index.
+	var indices map[string]struct {
+		Mappings struct {
+			Meta struct {
+				Version int `json:"version"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := json.Unmarshal(body, &indices); err != nil {
+		return 0, errors.Wrap(err, "mapping response")
+	}
+
+	if len(indices) == 0 {
+		return 0, errors.Errorf("no index %s", name)
+	}
+
+	version := -1
+
+	for _, index := range indices {
+		if v := index.Mappings.Meta.Version; version == -1 || v < version {
+			version = v
+		}
+	}
+
+	return version, nil
+}
+
+// Migrate applies the migrations after the current mapping version in order, to the index and the late index,
+// and returns them. Each applied version is recorded in the _meta of the mappings, so Migrate carries on
+// from a failed migration.
+//
+// A migration without Reindex puts its properties on the existing indices, then runs its Backfill on them, if any,
+// with an update by query.
+//
+// A Reindex migration copies the views into the index <name>_v<version> with the new mapping, then atomically replaces
+// the previous index by it, under the name as an alias. The views written to the previous index while reindexing are lost,
+// the indexers must be stopped while migrating, the hits wait in the Redis queue.
+// With the rollover indices, the write index is rolled over instead, and the previous indices keep their mapping until deleted.
+//
+// The progress of the reindex and backfill tasks, the views processed of the total, is passed to progress, which can be nil.
+func (s *Store) Migrate(ctx context.Context, progress func(m Migration, processed, total int64)) ([]Migration, error) {
+	version, err := s.MappingVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	rolledOver := false
+
+	for _, m := range s.migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		s.logger.Info("migrating the mapping", slog.Int("version", m.Version), slog.String("description", m.Description))
+
+		indices := []string{s.lateIndex}
+		if s.rollover == nil {
+			indices = append(indices, s.index)
+		}
+
+		for _, index := range indices {
+			if m.Reindex {
+				err = s.reindex(ctx, index, fmt.Sprintf("%s_v%d", index, m.Version), m, func(created, total int64) {
+					if progress != nil {
+						progress(m, created, total)
+					}
+				})
+			} else {
+				err = s.putMapping(ctx, index, m, progress)
+			}
+
+			if err != nil {
+				return applied, errors.Wrapf(err, "version %d", m.Version)
+			}
+		}
+
+		// Once rolled over, the write index has the latest mapping, from the template.
+		if s.rollover != nil && !rolledOver {
+			if m.Reindex {
+				if _, err := s.client.RolloverIndex(s.writeIndex).Do(ctx); err != nil {
+					return applied, errors.Wrapf(err, "version %d: rollover %s", m.Version, s.writeIndex)
+				}
+
+				rolledOver = true
+			} else if err := s.putMapping(ctx, s.readIndex, m, progress); err != nil {
+				return applied, errors.Wrapf(err, "version %d", m.Version)
+			}
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// putMapping puts the properties of the migration on the indices of the name, then runs its backfill.
+func (s *Store) putMapping(ctx context.Context, name string, m Migration, progress func(m Migration, processed, total int64)) error {
+	if _, err := s.client.PutMapping().Index(name).BodyString(mappings(m)).Do(ctx); err != nil {
+		return errors.Wrapf(err, "put mapping %s", name)
+	}
+
+	if m.Backfill == "" {
+		return nil
+	}
+
+	task, err := s.client.UpdateByQuery(name).
+		Script(elastic.NewScript(m.Backfill)).
+		// Views indexed while updating are not conflicts worth aborting for.
+		ProceedOnVersionConflict().
+		Refresh("true").
+		DoAsync(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "backfill %s", name)
+	}
+
+	return s.waitTask(ctx, "backfill", task.TaskId, func(status taskResponse) {
+		if progress != nil {
+			progress(m, status.Task.Status.Updated+status.Task.Status.Noops, status.Task.Status.Total)
+		}
+	})
+}
+
+// waitTask polls the asynchronous task until it completes, passing its status to progress.
+func (s *Store) waitTask(ctx context.Context, kind, taskID string, progress func(status taskResponse)) error {
+	ticker := time.NewTicker(reindexPollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := getTask(ctx, s.client, taskID)
+		if err != nil {
+			return errors.Wrapf(err, "%s task %s", kind, taskID)
+		}
+
+		if msg := status.err(); msg != "" {
+			return errors.Errorf("%s task %s: %s", kind, taskID, msg)
+		}
+
+		progress(status)
+
+		if status.Completed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reindex copies the views into new indices, created with the current settings and the latest mapping,
+// then replaces the indices by them, e.g. to change the number of shards. As for Migrate, the indexers must be stopped.
+// With the rollover indices, the write index is rolled over instead, the next indices are created with the current settings.
+//
+// The progress of the reindex tasks is passed to progress, which can be nil.
+func (s *Store) Reindex(ctx context.Context, progress func(index string, created, total int64)) error {
+	m := latest(s.migrations)
+	suffix := fmt.Sprintf("_v%d_%s", m.Version, time.Now().UTC().Format("20060102150405"))
+
+	indices := []string{s.lateIndex}
+
+	if s.rollover != nil {
+		if err := s.createRollover(ctx); err != nil {
+			return err
+		}
+
+		if _, err := s.client.RolloverIndex(s.writeIndex).Do(ctx); err != nil {
+			return errors.Wrapf(err, "rollover %s", s.writeIndex)
+		}
+	} else {
+		indices = append(indices, s.index)
+	}
+
+	for _, index := range indices {
+		index := index
+
+		err := s.reindex(ctx, index, index+suffix, m, func(created, total int64) {
+			if progress != nil {
+				progress(index, created, total)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reindex copies the views of the name, an index or an alias, into the next index with the mapping of the migration,
+// then replaces the previous index by the next one under the name.
+func (s *Store) reindex(ctx context.Context, name, next string, m Migration, progress func(created, total int64)) error {
+	previous, err := concreteIndex(ctx, s.client, name)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.client.IndexExists(next).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "index exists %s", next)
+	}
+
+	if exists {
+		return errors.Errorf("index %s exists, delete it if it was left by a failed migration", next)
+	}
+
+	if err := createIndex(ctx, s.client, next, s.shards, s.replicas, m); err != nil {
+		return err
+	}
+
+	reindex := s.client.Reindex().SourceIndex(previous).DestinationIndex(next)
+	if m.Backfill != "" {
+		reindex = reindex.Script(elastic.NewScript(m.Backfill))
+	}
+
+	task, err := reindex.DoAsync(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "reindex %s to %s", previous, next)
+	}
+
+	err = s.waitTask(ctx, "reindex", task.TaskId, func(status taskResponse) {
+		progress(status.Task.Status.Created, status.Task.Status.Total)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Replace the previous index in a single request, so the name always points to an index.
+	_, err = s.client.Alias().Action(
+		elastic.NewAliasAddAction(name).Index(next),
+		elastic.NewAliasRemoveIndexAction(previous),
+	).Do(ctx)
+
+	return errors.Wrapf(err, "replace %s by %s", previous, next)
+}
+
+// concreteIndex returns the index of the name, an index or an alias of a single index.
+func concreteIndex(ctx context.Context, client *elastic.Client, name string) (string, error) {
+	res, err := client.Aliases().Index(name).Do(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "aliases %s", name)
+	}
+
+	if len(res.Indices) != 1 {
+		return "", errors.Errorf("%s must be an index, or an alias of a single index", name)
+	}
+
+	for index := range res.Indices {
+		return index, nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,156 @@
+//go:build integration
+// +build integration
+
+package elastic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := wait(testElasticServerURL); !assert.NoError(t, err) {
+		return
+	}
+
+	reindexPollInterval = 100 * time.Millisecond
+
+	versions := []Migration{
+		migrations[0],
+		{
+			Version:     2,
+			Description: "add referrer",
+			Properties:  `{"tenant":{"type":"keyword"},"id":{"type":"keyword"},"timestamp":{"type":"date"},"referrer":{"type":"keyword"}}`,
+		},
+		{
+			Version:     3,
+			Description: "referrer is text",
+			Properties:  `{"tenant":{"type":"keyword"},"id":{"type":"keyword"},"timestamp":{"type":"date"},"referrer":{"type":"text"}}`,
+			Reindex:     true,
+		},
+	}
+
+	db, err := Connect(testElasticServerURL, WithIndex("views_migrate"), withMigrations(versions[:1]))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_, err := db.client.DeleteIndex("views_migrate*").Do(ctx)
+		assert.NoError(t, err)
+	}()
+
+	version, err := db.MappingVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	assert.NoError(t, db.viewTracker.Track(ctx, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Now()}))
+
+	_, err = db.client.Refresh(db.index).Do(ctx)
+	assert.NoError(t, err)
+
+	db.migrations = versions
+
+	var reindexed []int
+
+	applied, err := db.Migrate(ctx, func(m Migration, created, total int64) {
+		reindexed = append(reindexed, m.Version)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, applied, 2)
+	assert.Contains(t, reindexed, 3)
+
+	version, err = db.MappingVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	// The index is replaced by the reindexed one, under the same name.
+	index, err := concreteIndex(ctx, db.client, "views_migrate")
+	assert.NoError(t, err)
+	assert.Equal(t, "views_migrate_v3", index)
+
+	// Nothing left to apply.
+	applied, err = db.Migrate(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// The views are still counted, and tracked.
+	assert.NoError(t, db.viewTracker.Track(ctx, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Now()}))
+
+	_, err = db.client.Refresh(db.index).Do(ctx)
+	assert.NoError(t, err)
+
+	res, err := db.viewRetriever.Retrieve(ctx, store.ViewQuery{Tenant: "acme", ID: "1", Ranges: []store.Range{store.OneMinute}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(2), res[0].Count)
+}
+
+func TestMigrateUnversioned(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := wait(testElasticServerURL); !assert.NoError(t, err) {
+		return
+	}
+
+	reindexPollInterval = 100 * time.Millisecond
+
+	db, err := Connect(testElasticServerURL, WithIndex("views_unversioned"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_, err := db.client.DeleteIndex("views_unversioned*").Do(ctx)
+		assert.NoError(t, err)
+	}()
+
+	// An index created before the versions, with a view tracked before the tenants.
+	_, err = db.client.DeleteIndex(db.index).Do(ctx)
+	assert.NoError(t, err)
+
+	_, err = db.client.CreateIndex(db.index).BodyString(`{"mappings":{"properties":{"id":{"type":"keyword"},"timestamp":{"type":"date"}}}}`).Do(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = db.client.Index().Index(db.index).BodyJson(map[string]interface{}{"id": "1", "timestamp": time.Now()}).Refresh("true").Do(ctx)
+	assert.NoError(t, err)
+
+	version, err := db.MappingVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	// The view belongs to the default tenant, before and after the migration.
+	count := func() int64 {
+		res, err := db.viewRetriever.Retrieve(ctx, store.ViewQuery{Tenant: store.DefaultTenant, ID: "1", Ranges: []store.Range{store.OneMinute}})
+		if !assert.NoError(t, err) {
+			return 0
+		}
+
+		return res[0].Count
+	}
+
+	assert.Equal(t, int64(1), count())
+
+	applied, err := db.Migrate(ctx, nil)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+
+	res, err := db.client.Count(db.index).Query(elastic.NewTermQuery("tenant", store.DefaultTenant)).Do(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res)
+
+	assert.Equal(t, int64(1), count())
+}
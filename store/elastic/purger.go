@@ -0,0 +1,168 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ store.ViewPurger = (*viewPurger)(nil)
+
+// viewPurger deletes the views using asynchronous Delete By Query tasks,
+// since a delete on a large index takes longer than the HTTP timeout.
+// Refer to https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-delete-by-query.html
+type viewPurger struct {
+	client *elastic.Client
+	// The index and the late index.
+	indices []string
+}
+
+func (p *viewPurger) Purge(ctx context.Context, f store.PurgeFilter) (string, error) {
+	query, err := purgeQuery(f)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, span := tracer.Start(ctx, "elastic.DeleteByQuery",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, attribute.String("tenant", f.Tenant)))
+	defer span.End()
+
+	res, err := p.client.DeleteByQuery(p.indices...).
+		Query(query).
+		// Views indexed while deleting are not conflicts worth aborting for.
+		ProceedOnVersionConflict().
+		// The deleted views are not counted anymore once the task completes.
+		Refresh("true").
+		DoAsync(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return "", err
+	}
+
+	return res.TaskId, nil
+}
+
+func purgeQuery(f store.PurgeFilter) (*elastic.BoolQuery, error) {
+	if f.Tenant == "" && f.Before.IsZero() {
+		return nil, errors.New("tenant or before must be set")
+	}
+
+	if f.ID != "" && f.Tenant == "" {
+		return nil, errors.New("tenant must be set with the id")
+	}
+
+	query := elastic.NewBoolQuery()
+
+	if f.Tenant != "" {
+		query.Filter(tenantFilter(f.Tenant))
+	}
+
+	if f.ID != "" {
+		query.Filter(elastic.NewTermQuery("id", f.ID))
+	}
+
+	if !f.Before.IsZero() {
+		query.Filter(elastic.NewRangeQuery("timestamp").Lt(f.Before))
+	}
+
+	if len(f.ExcludeTenants) > 0 {
+		tenants := make([]interface{}, len(f.ExcludeTenants))
+		for i, tenant := range f.ExcludeTenants {
+			tenants[i] = tenant
+
+			// The documents without a tenant belong to the default tenant.
+			if tenant == store.DefaultTenant {
+				query.MustNot(withoutTenant())
+			}
+		}
+
+		query.MustNot(elastic.NewTermsQuery("tenant", tenants...))
+	}
+
+	return query, nil
+}
+
+// taskResponse is the response of the Tasks API. The client's TasksGetTaskResponse doesn't decode the task error and failures.
+type taskResponse struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status struct {
+			Total   int64 `json:"total"`
+			Created int64 `json:"created"`
+			Updated int64 `json:"updated"`
+			Deleted int64 `json:"deleted"`
+			Noops   int64 `json:"noops"`
+		} `json:"status"`
+	} `json:"task"`
+	Response struct {
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+	Error *elastic.ErrorDetails `json:"error"`
+}
+
+// err returns the error of the task, or its failures, empty if it succeeded so far.
+func (t taskResponse) err() string {
+	switch {
+	case t.Error != nil:
+		return t.Error.Type + ": " + t.Error.Reason
+
+	case len(t.Response.Failures) > 0:
+		failures := make([]string, 0, len(t.Response.Failures))
+		for _, failure := range t.Response.Failures {
+			failures = append(failures, string(failure))
+		}
+
+		return strings.Join(failures, "; ")
+	}
+
+	return ""
+}
+
+// getTask returns the status of an asynchronous task, e.g. Delete By Query, Update By Query or Reindex.
+func getTask(ctx context.Context, client *elastic.Client, taskID string) (taskResponse, error) {
+	if taskID == "" {
+		return taskResponse{}, errors.New("task id is empty")
+	}
+
+	res, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/_tasks/" + url.PathEscape(taskID),
+	})
+	if err != nil {
+		return taskResponse{}, err
+	}
+
+	var task taskResponse
+	if err := json.Unmarshal(res.Body, &task); err != nil {
+		return taskResponse{}, errors.Wrap(err, "task response")
+	}
+
+	return task, nil
+}
+
+func (p *viewPurger) PurgeStatus(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+	task, err := getTask(ctx, p.client, taskID)
+	if elastic.IsNotFound(err) {
+		return store.PurgeStatus{}, store.ErrTaskNotFound
+	}
+	if err != nil {
+		return store.PurgeStatus{}, err
+	}
+
+	return store.PurgeStatus{
+		Completed: task.Completed,
+		Total:     task.Task.Status.Total,
+		Deleted:   task.Task.Status.Deleted,
+		Error:     task.err(),
+	}, nil
+}
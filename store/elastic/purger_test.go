@@ -0,0 +1,114 @@
+//go:build integration
+// +build integration
+
+package elastic
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: time.Now()},
+		{Tenant: "globex", ID: "1", Timestamp: time.Now()},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	taskID, err := db.viewPurger.Purge(context.Background(), store.PurgeFilter{Tenant: "acme"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var status store.PurgeStatus
+
+	for i := 0; i < 30 && !status.Completed; i++ {
+		status, err = db.viewPurger.PurgeStatus(context.Background(), taskID)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	assert.True(t, status.Completed)
+	assert.Empty(t, status.Error)
+	assert.Equal(t, int64(1), status.Deleted)
+
+	node, _, _ := strings.Cut(taskID, ":")
+
+	_, err = db.viewPurger.PurgeStatus(context.Background(), node+":999999999")
+	assert.Equal(t, store.ErrTaskNotFound, err)
+
+	time.Sleep(1 * time.Second)
+
+	for tenant, count := range map[string]int64{"acme": 0, "globex": 1} {
+		res, err := db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+			Tenant: tenant,
+			ID:     "1",
+			Ranges: []store.Range{store.OneMinute},
+		})
+		if assert.NoError(t, err) && assert.Len(t, res, 1) {
+			assert.Equal(t, count, res[0].Count, tenant)
+		}
+	}
+}
+
+func TestPurgeID(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	_, err = db.viewPurger.Purge(context.Background(), store.PurgeFilter{ID: "1", Before: time.Now()})
+	assert.EqualError(t, err, "tenant must be set with the id")
+
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: time.Now()},
+		{Tenant: "acme", ID: "2", Timestamp: time.Now()},
+		{Tenant: "globex", ID: "1", Timestamp: time.Now()},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	taskID, err := db.viewPurger.Purge(context.Background(), store.PurgeFilter{Tenant: "acme", ID: "1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var status store.PurgeStatus
+
+	for i := 0; i < 30 && !status.Completed; i++ {
+		status, err = db.viewPurger.PurgeStatus(context.Background(), taskID)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	assert.True(t, status.Completed)
+	assert.Equal(t, int64(1), status.Deleted)
+}
@@ -0,0 +1,44 @@
+package elastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test each range constant should have bounds.
+func TestRangeBounds(t *testing.T) {
+	now := time.Now()
+
+	for i := 0; i < int(store.NumRange); i++ {
+		if from, to := rangeBounds(store.Range(i), now, time.Monday); from == "" || to == "" {
+			t.Fatalf("unimplemented range bounds for range %d", i)
+		}
+
+		if from, to := previousBounds(store.Range(i), now, time.Monday); from == "" || to == "" {
+			t.Fatalf("unimplemented previous bounds for range %d", i)
+		}
+	}
+
+	// A Wednesday.
+	now = time.Date(2020, 9, 16, 10, 0, 0, 0, time.UTC)
+
+	for weekStart, want := range map[time.Weekday]string{
+		time.Monday:    "now-2d/d",
+		time.Sunday:    "now-3d/d",
+		time.Wednesday: "now-0d/d",
+		time.Thursday:  "now-6d/d",
+	} {
+		from, to := rangeBounds(store.ThisWeek, now, weekStart)
+		assert.Equal(t, want, from, weekStart.String())
+		assert.Equal(t, "now", to)
+	}
+
+	// The previous week until the same time.
+	from, to := previousBounds(store.ThisWeek, now, time.Monday)
+	assert.Equal(t, "now-9d/d", from)
+	assert.Equal(t, "now-7d", to)
+}
@@ -2,57 +2,113 @@ package elastic
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/olivere/elastic/v7"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ store.ViewRetriever = (*viewRetriever)(nil)
 
 type viewRetriever struct {
 	client *elastic.Client
+	index  string
 }
 
-func (v *viewRetriever) Retrieve(ctx context.Context, id string, ranges ...store.Range) ([]store.ViewCount, error) {
-	if len(ranges) == 0 {
+func (v *viewRetriever) Retrieve(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+	query, err := tenantQuery(q.Tenant, elastic.NewTermQuery("id", q.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.Ranges) == 0 {
 		return []store.ViewCount{}, nil
 	}
 
-	aggs := elastic.NewRangeAggregation().Field("timestamp")
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	now := time.Now().In(loc)
+
+	// The calendar ranges are rounded in the time zone of the location.
+	aggs := elastic.NewDateRangeAggregation().Field("timestamp").TimeZone(loc.String())
+
+	// Only the views of the ranges are aggregated, so the indices without any can be skipped.
+	inRanges := elastic.NewBoolQuery().MinimumNumberShouldMatch(1)
 
-	// Convert each range into Range Aggregation and add it into the Aggregation
-	for _, rang := range ranges {
-		unit := rangeUnit(rang)
-		if unit == "" {
-			return nil, errors.Errorf("unimplemented range unit %v", rang)
+	// Convert each range into Date Range Aggregation and add it into the Aggregation
+	for _, rang := range q.Ranges {
+		from, to := rangeBounds(rang, now, q.WeekStart)
+		if from == "" {
+			return nil, errors.Errorf("unimplemented range bounds %v", rang)
 		}
 
 		// Use range constant as the bucket key.
 		key := strconv.Itoa(int(rang))
 
-		aggs.AddRangeWithKey(key, "now-"+unit, "now")
+		aggs.AddRangeWithKey(key, from, to)
+		inRanges.Should(elastic.NewRangeQuery("timestamp").Gte(from).Lt(to).TimeZone(loc.String()))
+
+		// The previous period is counted by the same search, so both periods end at the same now.
+		if q.Compare {
+			from, to := previousBounds(rang, now, q.WeekStart)
+
+			aggs.AddRangeWithKey(key+previousKeySuffix, from, to)
+			inRanges.Should(elastic.NewRangeQuery("timestamp").Gte(from).Lt(to).TimeZone(loc.String()))
+		}
 	}
 
-	res, err := v.client.Search(indexName).
-		Query(elastic.NewTermQuery("id", id)).
+	ctx, span := tracer.Start(ctx, "elastic.Search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, tracing.IDAttribute(q.ID)))
+	defer span.End()
+
+	query.Filter(inRanges)
+
+	res, err := v.client.Search(v.index).
+		Query(query).
+		Size(0).
 		Aggregation("views", aggs).
+		// Skip the shards without views in the range, before searching them.
+		PreFilterShardSize(1).
 		Do(ctx)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
-	rangeRes, _ := res.Aggregations.Range("views")
+	rangeRes, _ := res.Aggregations.DateRange("views")
 	// This should never happens
 	if rangeRes == nil || len(rangeRes.Buckets) == 0 {
 		return nil, errors.New("elastic response empty")
 	}
 
-	viewCounts := make([]store.ViewCount, 0, len(ranges))
+	viewCounts := make([]store.ViewCount, 0, len(q.Ranges))
+
+	// The counts of the previous periods, by the key of their range.
+	previous := make(map[string]int64)
 
 	for _, bucket := range rangeRes.Buckets {
+		if key, ok := strings.CutSuffix(bucket.Key, previousKeySuffix); ok {
+			previous[key] = bucket.DocCount
+		}
+	}
+
+	for _, bucket := range rangeRes.Buckets {
+		if strings.HasSuffix(bucket.Key, previousKeySuffix) {
+			continue
+		}
+
 		// The bucket key is the ranges constant.
 		rang, err := strconv.Atoi(bucket.Key)
 		if err != nil {
@@ -64,32 +120,281 @@ func (v *viewRetriever) Retrieve(ctx context.Context, id string, ranges ...store
 			return nil, errors.Errorf("unimplemented range description %v", rang)
 		}
 
-		viewCounts = append(viewCounts, store.ViewCount{
+		count := store.ViewCount{
 			Description: desc,
 			Count:       bucket.DocCount,
-		})
+		}
+
+		// The bounds of a calendar range depend on the location and now, return them.
+		if store.Range(rang).Calendar() && bucket.From != nil && bucket.To != nil {
+			from, to := time.UnixMilli(int64(*bucket.From)).In(loc), time.UnixMilli(int64(*bucket.To)).In(loc)
+			count.From, count.To = &from, &to
+		}
+
+		if q.Compare {
+			count.Compare(previous[bucket.Key])
+		}
+
+		viewCounts = append(viewCounts, count)
 	}
 
 	return viewCounts, nil
 }
 
-// TODO add unit test.
-// Get ElasticSearch's time unit for the range constant
-func rangeUnit(rang store.Range) string {
+// maxHistogramBuckets limits the buckets of a histogram, below the max buckets of ElasticSearch.
+const maxHistogramBuckets = 10000
+
+func (v *viewRetriever) Histogram(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+	if q.Interval < time.Millisecond {
+		return nil, errors.New("interval must be at least 1ms")
+	}
+
+	from := q.From.Truncate(q.Interval)
+	n := int(q.To.Sub(from) / q.Interval)
+	if q.To.Sub(from)%q.Interval != 0 {
+		n++
+	}
+
+	if n <= 0 {
+		return []store.Bucket{}, nil
+	}
+	if n > maxHistogramBuckets {
+		return nil, errors.Errorf("histogram exceeds %d buckets", maxHistogramBuckets)
+	}
+
+	query, err := tenantQuery(q.Tenant,
+		elastic.NewTermQuery("id", q.ID),
+		elastic.NewRangeQuery("timestamp").Gte(from).Lt(q.To))
+	if err != nil {
+		return nil, err
+	}
+
+	aggs := elastic.NewDateHistogramAggregation().
+		Field("timestamp").
+		FixedInterval(strconv.FormatInt(q.Interval.Milliseconds(), 10) + "ms").
+		MinDocCount(0)
+
+	ctx, span := tracer.Start(ctx, "elastic.Search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, tracing.IDAttribute(q.ID)))
+	defer span.End()
+
+	res, err := v.client.Search(v.index).
+		Query(query).
+		Size(0).
+		Aggregation("views", aggs).
+		PreFilterShardSize(1).
+		Do(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	// ElasticSearch only returns the buckets between the first and the last view, fill the others.
+	buckets := make([]store.Bucket, n)
+	for i := range buckets {
+		buckets[i].Timestamp = from.Add(time.Duration(i) * q.Interval).UTC()
+	}
+
+	histogram, _ := res.Aggregations.DateHistogram("views")
+	if histogram == nil {
+		return buckets, nil
+	}
+
+	for _, bucket := range histogram.Buckets {
+		timestamp := time.Unix(0, int64(bucket.Key)*int64(time.Millisecond))
+
+		i := int(timestamp.Sub(from) / q.Interval)
+		if i < 0 || i >= n {
+			continue
+		}
+
+		buckets[i].Count += bucket.DocCount
+	}
+
+	return buckets, nil
+}
+
+const (
+	// defaultHitPageSize is the size of a page of hits, when the query has none.
+	defaultHitPageSize = 1000
+	// maxHitPageSize limits the size of a page of hits, to the max result window of ElasticSearch.
+	maxHitPageSize = 10000
+	// hitKeepAlive is how long the point in time of the pages of hits is kept after reading a page.
+	hitKeepAlive = "1m"
+)
+
+// Hits pages the views of a point in time with search_after, sorted by timestamp then _shard_doc so the views
+// with the same timestamp are never skipped. The first page opens the point in time, and the last one closes it.
+// The cursor is the point in time, the range of the first page and the sort values of the last view of the page.
+//
+// The pages are the views as of the first page: the views tracked or deleted while paging are not seen.
+// The point in time expires if the next page is not read within a minute, its cursor is then ErrCursorExpired.
+func (v *viewRetriever) Hits(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+	size := q.Size
+	if size == 0 {
+		size = defaultHitPageSize
+	}
+
+	if size < 0 || size > maxHitPageSize {
+		return store.HitPage{}, errors.Errorf("size must be between 1 and %d", maxHitPageSize)
+	}
+
+	var after cursor
+
+	if q.After != "" {
+		var err error
+		if after, err = decodeCursor(q.After); err != nil {
+			return store.HitPage{}, err
+		}
+
+		q.From, q.To = after.From, after.To
+	}
+
+	query, err := tenantQuery(q.Tenant,
+		elastic.NewTermQuery("id", q.ID),
+		elastic.NewRangeQuery("timestamp").Gte(q.From).Lt(q.To))
+	if err != nil {
+		return store.HitPage{}, err
+	}
+
+	ctx, span := tracer.Start(ctx, "elastic.Search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, tracing.IDAttribute(q.ID)))
+	defer span.End()
+
+	if after.PIT == "" {
+		pit, err := v.client.OpenPointInTime(v.index).KeepAlive(hitKeepAlive).Do(ctx)
+		if err != nil {
+			tracing.RecordError(span, err)
+			return store.HitPage{}, errors.Wrap(err, "open point in time")
+		}
+
+		after.PIT = pit.Id
+	}
+
+	search := v.client.Search().
+		PointInTime(elastic.NewPointInTimeWithKeepAlive(after.PIT, hitKeepAlive)).
+		Query(query).
+		Size(size).
+		Sort("timestamp", !q.Newest).
+		Sort("_shard_doc", !q.Newest).
+		TrackTotalHits(false)
+
+	if after.Sort != nil {
+		search = search.SearchAfter(after.Sort...)
+	}
+
+	res, err := search.Do(ctx)
+	if q.After != "" && elastic.IsNotFound(err) {
+		return store.HitPage{}, store.ErrCursorExpired
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		return store.HitPage{}, err
+	}
+
+	// The ID of the point in time may change between the searches.
+	if res.PitId != "" {
+		after.PIT = res.PitId
+	}
+
+	page := store.HitPage{Hits: make([]store.ViewTrack, 0, len(res.Hits.Hits))}
+
+	for _, hit := range res.Hits.Hits {
+		var view store.ViewTrack
+		if err := json.Unmarshal(hit.Source, &view); err != nil {
+			return store.HitPage{}, errors.Wrapf(err, "hit %s", hit.Id)
+		}
+
+		page.Hits = append(page.Hits, view)
+	}
+
+	// A full page may be followed by more views.
+	if n := len(res.Hits.Hits); n == size {
+		page.Next, err = encodeCursor(cursor{PIT: after.PIT, From: q.From, To: q.To, Sort: res.Hits.Hits[n-1].Sort})
+		if err != nil {
+			return store.HitPage{}, err
+		}
+
+		return page, nil
+	}
+
+	// The point in time expires anyway, if it fails to close.
+	if _, err := v.client.ClosePointInTime(after.PIT).Do(ctx); err != nil {
+		tracing.RecordError(span, err)
+	}
+
+	return page, nil
+}
+
+// rangeBounds returns the ElasticSearch date math of the bounds of the range, the upper bound excluded.
+// The calendar ranges round to the day or the month in the time zone of the search, now must be in its location.
+func rangeBounds(rang store.Range, now time.Time, weekStart time.Weekday) (from, to string) {
 	switch rang {
 	case store.OneMinute:
-		return "1m"
+		return "now-1m", "now"
 	case store.FiveMinute:
-		return "5m"
+		return "now-5m", "now"
 	case store.OneHour:
-		return "1h"
+		return "now-1h", "now"
 	case store.OneDay:
-		return "1d"
+		return "now-1d", "now"
 	case store.OneWeek:
-		return "7d"
+		return "now-7d", "now"
 	case store.OneMonth:
-		return "30d"
+		return "now-30d", "now"
+	case store.Today:
+		return "now/d", "now"
+	case store.Yesterday:
+		return "now-1d/d", "now/d"
+	case store.ThisWeek:
+		// The weeks of ElasticSearch start on Monday, round to the day the week started instead.
+		return fmt.Sprintf("now-%dd/d", weekDays(now, weekStart)), "now"
+	case store.MonthToDate:
+		return "now/M", "now"
+	case store.PreviousMonth:
+		return "now-1M/M", "now/M"
 	default:
-		return ""
+		return "", ""
 	}
 }
+
+// previousKeySuffix is appended to the bucket key of a range, for the bucket of its previous period.
+const previousKeySuffix = "-previous"
+
+// previousBounds returns the date math of the period before the range, of the same length. The rolling ranges are
+// shifted by their length, and the calendar periods in progress end at the same time of the previous period.
+func previousBounds(rang store.Range, now time.Time, weekStart time.Weekday) (from, to string) {
+	switch rang {
+	case store.OneMinute:
+		return "now-2m", "now-1m"
+	case store.FiveMinute:
+		return "now-10m", "now-5m"
+	case store.OneHour:
+		return "now-2h", "now-1h"
+	case store.OneDay:
+		return "now-2d", "now-1d"
+	case store.OneWeek:
+		return "now-14d", "now-7d"
+	case store.OneMonth:
+		return "now-60d", "now-30d"
+	case store.Today:
+		return "now-1d/d", "now-1d"
+	case store.Yesterday:
+		return "now-2d/d", "now-1d/d"
+	case store.ThisWeek:
+		return fmt.Sprintf("now-%dd/d", weekDays(now, weekStart)+7), "now-7d"
+	case store.MonthToDate:
+		return "now-1M/M", "now-1M"
+	case store.PreviousMonth:
+		return "now-2M/M", "now-1M/M"
+	default:
+		return "", ""
+	}
+}
+
+// weekDays returns the number of days since the start of the week.
+func weekDays(now time.Time, weekStart time.Weekday) int {
+	return (int(now.Weekday()) - int(weekStart) + 7) % 7
+}
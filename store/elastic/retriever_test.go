@@ -1,3 +1,4 @@
+//go:build integration
 // +build integration
 
 package elastic
@@ -12,15 +13,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-// Test each range constant should have unit.
-func TestRangeUnit(t *testing.T) {
-	for i := 0; i < int(store.NumRange); i++ {
-		if rangeUnit(store.Range(i)) == "" {
-			t.Fatalf("unimplemented range unit for range %d", i)
-		}
-	}
-}
-
 func TestRetrieve(t *testing.T) {
 	db, cleanup, err := connect(t)
 	if !assert.NoError(t, err) {
@@ -29,6 +21,7 @@ func TestRetrieve(t *testing.T) {
 	defer cleanup()
 
 	err = db.viewTracker.Track(context.Background(), store.ViewTrack{
+		Tenant:    "acme",
 		ID:        "1",
 		Timestamp: time.Now(),
 	})
@@ -39,7 +32,11 @@ func TestRetrieve(t *testing.T) {
 	// Wait for consistency, since elastic is eventual consistency
 	time.Sleep(1 * time.Second)
 
-	res, err := db.viewRetriever.Retrieve(context.Background(), "1", store.OneMinute)
+	res, err := db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant: "acme",
+		ID:     "1",
+		Ranges: []store.Range{store.OneMinute},
+	})
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -49,7 +46,11 @@ func TestRetrieve(t *testing.T) {
 	assert.Equal(t, store.RangeDescription(store.OneMinute), res[0].Description)
 	assert.Equal(t, int64(1), res[0].Count)
 
-	res, err = db.viewRetriever.Retrieve(context.Background(), "2", store.OneMinute)
+	res, err = db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant: "acme",
+		ID:     "2",
+		Ranges: []store.Range{store.OneMinute},
+	})
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -58,4 +59,269 @@ func TestRetrieve(t *testing.T) {
 
 	assert.Equal(t, store.RangeDescription(store.OneMinute), res[0].Description)
 	assert.Equal(t, int64(0), res[0].Count)
+
+	// Another tenant can't see the views of the same ID.
+	res, err = db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant: "globex",
+		ID:     "1",
+		Ranges: []store.Range{store.OneMinute},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, res, 1)
+	assert.Equal(t, int64(0), res[0].Count)
+
+	_, err = db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		ID:     "1",
+		Ranges: []store.Range{store.OneMinute},
+	})
+	assert.Error(t, err, "empty tenant")
+}
+
+func TestRetrieveCalendar(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	loc, err := time.LoadLocation("America/New_York")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	// The views just before and after midnight in New York, on different days in UTC or not.
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: today.Add(time.Second)},
+		{Tenant: "acme", ID: "1", Timestamp: today.Add(-time.Second)},
+		{Tenant: "acme", ID: "1", Timestamp: today.AddDate(0, 0, -1).Add(-time.Second)},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	res, err := db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant:   "acme",
+		ID:       "1",
+		Ranges:   []store.Range{store.Today, store.Yesterday, store.MonthToDate},
+		Location: loc,
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, res, 3) {
+		return
+	}
+
+	counts := make(map[string]store.ViewCount)
+	for _, count := range res {
+		counts[count.Description] = count
+	}
+
+	if count := counts[store.RangeDescription(store.Today)]; assert.NotNil(t, count.From) {
+		assert.Equal(t, int64(1), count.Count)
+		assert.True(t, count.From.Equal(today))
+	}
+
+	if count := counts[store.RangeDescription(store.Yesterday)]; assert.NotNil(t, count.To) {
+		assert.Equal(t, int64(1), count.Count)
+		assert.True(t, count.To.Equal(today))
+	}
+
+	if count := counts[store.RangeDescription(store.MonthToDate)]; assert.NotNil(t, count.From) {
+		assert.True(t, count.From.Equal(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)))
+	}
+}
+
+func TestRetrieveCompare(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	now := time.Now()
+
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: now.Add(-10 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: now.Add(-30 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: now.Add(-90 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: now.Add(-3 * time.Hour)},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	res, err := db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant:  "acme",
+		ID:      "1",
+		Ranges:  []store.Range{store.OneHour, store.OneDay},
+		Compare: true,
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, res, 2) {
+		return
+	}
+
+	counts := make(map[string]store.ViewCount)
+	for _, count := range res {
+		counts[count.Description] = count
+	}
+
+	if hour := counts[store.RangeDescription(store.OneHour)]; assert.NotNil(t, hour.Previous) {
+		assert.Equal(t, int64(2), hour.Count)
+		assert.Equal(t, int64(1), *hour.Previous)
+		assert.Equal(t, int64(1), *hour.Change)
+		assert.Equal(t, float64(100), *hour.ChangePercent)
+	}
+
+	if day := counts[store.RangeDescription(store.OneDay)]; assert.NotNil(t, day.Previous) {
+		assert.Equal(t, int64(4), day.Count)
+		assert.Equal(t, int64(0), *day.Previous)
+		assert.Nil(t, day.ChangePercent)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	to := time.Now().UTC().Truncate(time.Hour)
+
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-150 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-30 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-10 * time.Minute)},
+		{Tenant: "acme", ID: "2", Timestamp: to.Add(-10 * time.Minute)},
+		{Tenant: "globex", ID: "1", Timestamp: to.Add(-10 * time.Minute)},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	buckets, err := db.viewRetriever.Histogram(context.Background(), store.HistogramQuery{
+		Tenant:   "acme",
+		ID:       "1",
+		Interval: time.Hour,
+		From:     to.Add(-4 * time.Hour),
+		To:       to,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The empty buckets are included.
+	assert.Equal(t, []store.Bucket{
+		{Timestamp: to.Add(-4 * time.Hour), Count: 0},
+		{Timestamp: to.Add(-3 * time.Hour), Count: 1},
+		{Timestamp: to.Add(-2 * time.Hour), Count: 0},
+		{Timestamp: to.Add(-1 * time.Hour), Count: 2},
+	}, buckets)
+
+	_, err = db.viewRetriever.Histogram(context.Background(), store.HistogramQuery{
+		Tenant:   "acme",
+		ID:       "1",
+		Interval: time.Second,
+		From:     to.Add(-24 * time.Hour),
+		To:       to,
+	})
+	assert.EqualError(t, err, "histogram exceeds 10000 buckets")
+}
+
+func TestHits(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	to := time.Now().UTC().Truncate(time.Millisecond)
+
+	// Two views with the same timestamp, which must not be skipped across the pages.
+	views := []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-3 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-2 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-2 * time.Minute)},
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-1 * time.Minute)},
+	}
+
+	err = db.viewTracker.BatchTrack(context.Background(), append([]store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: to.Add(-time.Hour)},
+		{Tenant: "acme", ID: "2", Timestamp: to.Add(-time.Minute)},
+		{Tenant: "globex", ID: "1", Timestamp: to.Add(-time.Minute)},
+	}, views...))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	q := store.HitQuery{Tenant: "acme", ID: "1", From: to.Add(-10 * time.Minute), To: to, Size: 2}
+
+	var hits []store.ViewTrack
+
+	for pages := 0; pages < 10; pages++ {
+		page, err := db.viewRetriever.Hits(context.Background(), q)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		hits = append(hits, page.Hits...)
+
+		if page.Next == "" {
+			break
+		}
+
+		// The next pages keep the range of the first page, and never see the views tracked after it.
+		if pages == 0 {
+			err = db.viewTracker.Track(context.Background(), store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: to.Add(-30 * time.Second)})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			time.Sleep(1 * time.Second)
+
+			q.From, q.To = time.Time{}, time.Time{}
+		}
+
+		q.After = page.Next
+	}
+
+	if assert.Len(t, hits, len(views)) {
+		for i := range views {
+			assert.True(t, views[i].Timestamp.Equal(hits[i].Timestamp), "hit %d", i)
+		}
+	}
+
+	views = append(views, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: to.Add(-30 * time.Second)})
+
+	// The newest first, in one page.
+	page, err := db.viewRetriever.Hits(context.Background(), store.HitQuery{Tenant: "acme", ID: "1", From: to.Add(-10 * time.Minute), To: to, Newest: true})
+	if assert.NoError(t, err) && assert.Len(t, page.Hits, len(views)) {
+		for i := range views {
+			assert.True(t, views[len(views)-1-i].Timestamp.Equal(page.Hits[i].Timestamp), "hit %d", i)
+		}
+
+		assert.Empty(t, page.Next)
+	}
+
+	_, err = db.viewRetriever.Hits(context.Background(), store.HitQuery{Tenant: "acme", ID: "1", To: to, Size: maxHitPageSize + 1})
+	assert.Error(t, err)
+
+	_, err = db.viewRetriever.Hits(context.Background(), store.HitQuery{Tenant: "acme", ID: "1", To: to, After: "not a cursor"})
+	assert.Equal(t, store.ErrInvalidCursor, err)
 }
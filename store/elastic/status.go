@@ -0,0 +1,50 @@
+package elastic
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IndexStatus is the health and the size of an index.
+type IndexStatus struct {
+	Name   string
+	Health string
+	Docs   int64
+	// Size of the primaries and the replicas.
+	SizeBytes int64
+}
+
+// Status returns the status of the indices of the views, including the late index, sorted by name.
+func (s *Store) Status(ctx context.Context) ([]IndexStatus, error) {
+	res, err := s.client.CatIndices().
+		Index(strings.Join([]string{s.readIndex, s.lateIndex}, ",")).
+		Bytes("b").
+		Do(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cat indices")
+	}
+
+	statuses := make([]IndexStatus, 0, len(res))
+
+	for _, row := range res {
+		// The size is empty while the index is not allocated.
+		size, _ := strconv.ParseInt(row.StoreSize, 10, 64)
+
+		statuses = append(statuses, IndexStatus{
+			Name:      row.Index,
+			Health:    row.Health,
+			Docs:      int64(row.DocsCount),
+			SizeBytes: size,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
@@ -2,33 +2,180 @@ package elastic
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/logging"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/olivere/elastic/v7"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var _ store.Store = (*Store)(nil)
 
-const indexName = "views"
+const defaultIndexName = "views"
+
+var (
+	tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/elastic")
+
+	dbSystem = attribute.String("db.system", "elasticsearch")
+)
 
 type Store struct {
-	client *elastic.Client
+	client    *elastic.Client
+	serverUrl string
+	index     string
+	lateIndex string
+	// The indices written and searched, the index itself or the aliases of the rollover indices.
+	writeIndex string
+	readIndex  string
+
+	logger     *slog.Logger
+	shards     int
+	replicas   int
+	rollover   *Rollover
+	migrations []Migration
 
 	viewTracker   *viewTracker
 	viewRetriever *viewRetriever
+	viewPurger    *viewPurger
+}
+
+type options struct {
+	logger    *slog.Logger
+	timeout   time.Duration
+	index     string
+	lateIndex string
+	shards    int
+	replicas  int
+	rollover  *Rollover
+	// Only verify the indices exist, instead of creating them.
+	verifyOnly bool
+	// The versions of the mapping, replaced by the tests.
+	migrations []Migration
+}
+
+// Rollover writes the views to rollover indices, named <index>-000001, <index>-000002, and so on,
+// managed by the <index>-policy lifecycle policy.
+// The views are written through the <index>-write alias and searched through the <index>-read alias.
+type Rollover struct {
+	// The write index is rolled over when it is older than MaxAge, or larger than MaxSize, e.g. 50gb, if not empty.
+	MaxAge  time.Duration
+	MaxSize string
+	// The indices are deleted once rolled over for Retention, so the views are kept at least that long. Zero keeps them forever.
+	Retention time.Duration
+}
+
+type Option func(*options)
+
+// WithLogger sets the logger of the store and the ElasticSearch client. Default is to discard the logs.
+func WithLogger(logger *slog.Logger) func(*options) {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRollover writes the views to time-based rollover indices, instead of a single index.
+// An existing single index is added to the read alias, so its views are still counted until it is deleted.
+func WithRollover(rollover Rollover) func(*options) {
+	return func(o *options) {
+		o.rollover = &rollover
+	}
+}
+
+// WithVerifyOnly only verifies the indices exist, instead of creating them, so the processes don't race to create them.
+// They are created by Init, e.g. with the admin init command.
+func WithVerifyOnly() func(*options) {
+	return func(o *options) {
+		o.verifyOnly = true
+	}
+}
+
+// withMigrations replaces the versions of the mapping, for the tests.
+func withMigrations(migrations []Migration) func(*options) {
+	return func(o *options) {
+		o.migrations = migrations
+	}
+}
+
+// Default HTTP timeout is 3 seconds.
+func WithTimeout(timeout time.Duration) func(*options) {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Default index is views.
+func WithIndex(index string) func(*options) {
+	return func(o *options) {
+		o.index = index
+	}
+}
+
+// WithLateIndex sets the index of the late views, see store.ViewTrack. Default is the index with the _late suffix.
+func WithLateIndex(index string) func(*options) {
+	return func(o *options) {
+		o.lateIndex = index
+	}
 }
 
-func Connect(serverUrl string) (*Store, error) {
+// WithIndexSettings sets the number of shards and replicas, used when the index is created.
+// Default is 2 shards and 0 replicas.
+func WithIndexSettings(shards, replicas int) func(*options) {
+	return func(o *options) {
+		o.shards = shards
+		o.replicas = replicas
+	}
+}
+
+func Connect(serverUrl string, opts ...Option) (*Store, error) {
+	o := options{
+		timeout:    3 * time.Second,
+		index:      defaultIndexName,
+		shards:     2,
+		replicas:   0,
+		migrations: migrations,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.lateIndex == "" {
+		o.lateIndex = o.index + "_late"
+	}
+
+	writeIndex, readIndex := o.index, o.index
+
+	if o.rollover != nil {
+		writeIndex, readIndex = o.index+"-write", o.index+"-read"
+
+		if o.rollover.MaxAge < time.Second {
+			return nil, errors.New("rollover max age must be at least 1s")
+		}
+
+		if strings.HasPrefix(o.lateIndex, o.index+"-") {
+			return nil, errors.Errorf("late index %s must not match the rollover indices %s-*", o.lateIndex, o.index)
+		}
+	}
+
+	logger := logging.OrDiscard(o.logger).With(slog.String("component", "elastic"))
+
 	httpClient := &http.Client{
-		Timeout: 3 * time.Second,
+		Timeout: o.timeout,
 	}
 
-	client, err := elastic.NewClient(elastic.SetURL(serverUrl), elastic.SetHttpClient(httpClient))
+	client, err := elastic.NewClient(
+		elastic.SetURL(serverUrl),
+		elastic.SetHttpClient(httpClient),
+		elastic.SetErrorLog(errorLog{logger: logger}),
+	)
 	if err != nil {
 		return nil, errors.Wrap(err, "client")
 	}
@@ -38,29 +185,176 @@ func Connect(serverUrl string) (*Store, error) {
 		return nil, errors.Wrap(err, "ping")
 	}
 
-	if exists, err := client.IndexExists(indexName).Do(context.Background()); err != nil {
-		return nil, errors.Wrap(err, "index exists")
-	} else if !exists {
-		res, err := client.CreateIndex(indexName).BodyString(mapping).Do(context.Background())
+	s := &Store{
+		client:        client,
+		serverUrl:     serverUrl,
+		index:         o.index,
+		lateIndex:     o.lateIndex,
+		writeIndex:    writeIndex,
+		readIndex:     readIndex,
+		logger:        logger,
+		shards:        o.shards,
+		replicas:      o.replicas,
+		rollover:      o.rollover,
+		migrations:    o.migrations,
+		viewTracker:   &viewTracker{client: client, index: writeIndex, lateIndex: o.lateIndex, logger: logger},
+		viewRetriever: &viewRetriever{client: client, index: readIndex},
+		viewPurger:    &viewPurger{client: client, indices: []string{readIndex, o.lateIndex}},
+	}
 
-		// Ignore error index already exists.
-		// For some reason, sometimes IndexExists() return false even if the Index already exists.
-		if err != nil && !strings.Contains(err.Error(), "resource_already_exists_exception") {
-			return nil, errors.Wrap(err, "create index")
+	if o.verifyOnly {
+		err = s.Verify(context.Background())
+	} else {
+		err = s.Init(context.Background())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.MappingVersion(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if version < latest(o.migrations).Version {
+		logger.Warn("the mapping is not the latest, run the admin migrate command",
+			slog.Int("version", version),
+			slog.Int("latest", latest(o.migrations).Version))
+	}
+
+	return s, nil
+}
+
+// Init creates the indices, and with the rollover indices, the lifecycle policy, the index template and the first index.
+// The existing indices are kept, the policy and the template are updated.
+func (s *Store) Init(ctx context.Context) error {
+	if s.rollover != nil {
+		if err := s.createRollover(ctx); err != nil {
+			return err
+		}
+	} else if err := createIndex(ctx, s.client, s.index, s.shards, s.replicas, latest(s.migrations)); err != nil {
+		return err
+	}
+
+	// The late views are few, they are kept in a single index.
+	return createIndex(ctx, s.client, s.lateIndex, s.shards, s.replicas, latest(s.migrations))
+}
+
+// Verify checks the indices exist, and with the rollover indices, the lifecycle policy and the index template.
+func (s *Store) Verify(ctx context.Context) error {
+	for _, index := range []string{s.writeIndex, s.readIndex, s.lateIndex} {
+		exists, err := s.client.IndexExists(index).Do(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "index exists %s", index)
 		}
 
-		if res != nil && !res.Acknowledged {
-			return nil, errors.New("create index acknowledged is false")
+		if !exists {
+			return errors.Errorf("index %s does not exist, run the admin init command", index)
 		}
 	}
 
-	s := &Store{
-		client:        client,
-		viewTracker:   &viewTracker{client: client},
-		viewRetriever: &viewRetriever{client: client},
+	if s.rollover == nil {
+		return nil
+	}
+
+	exists, err := s.client.IndexTemplateExists(s.index).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "index template exists %s", s.index)
+	}
+
+	if !exists {
+		return errors.Errorf("index template %s does not exist, run the admin init command", s.index)
+	}
+
+	policy := s.index + "-policy"
+
+	_, err = s.client.XPackIlmGetLifecycle().Policy(policy).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return errors.Errorf("lifecycle policy %s does not exist, run the admin init command", policy)
+	}
+
+	return errors.Wrapf(err, "get lifecycle policy %s", policy)
+}
+
+// createIndex creates the index if it doesn't exist.
+func createIndex(ctx context.Context, client *elastic.Client, index string, shards, replicas int, m Migration) error {
+	exists, err := client.IndexExists(index).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "index exists %s", index)
+	}
+
+	if exists {
+		return nil
+	}
+
+	res, err := client.CreateIndex(index).BodyString(mapping(shards, replicas, m)).Do(ctx)
+
+	// Ignore error index already exists.
+	// For some reason, sometimes IndexExists() return false even if the Index already exists.
+	if err != nil && !strings.Contains(err.Error(), "resource_already_exists_exception") {
+		return errors.Wrapf(err, "create index %s", index)
+	}
+
+	if res != nil && !res.Acknowledged {
+		return errors.Errorf("create index %s acknowledged is false", index)
+	}
+
+	return nil
+}
+
+// createRollover creates the lifecycle policy, the index template and the first rollover index.
+// The policy and the template are updated if they exist.
+func (s *Store) createRollover(ctx context.Context) error {
+	policy := s.index + "-policy"
+	pattern := s.index + "-*"
+
+	_, err := s.client.XPackIlmPutLifecycle().Policy(policy).BodyString(lifecyclePolicy(*s.rollover)).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "put lifecycle policy %s", policy)
+	}
+
+	_, err = s.client.IndexPutTemplate(s.index).
+		BodyString(template(pattern, s.shards, s.replicas, policy, s.writeIndex, s.readIndex, latest(s.migrations))).
+		Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "put index template %s", s.index)
+	}
+
+	exists, err := s.client.IndexExists(s.writeIndex).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "alias exists %s", s.writeIndex)
+	}
+
+	if !exists {
+		first := s.index + "-000001"
+
+		_, err := s.client.CreateIndex(first).
+			BodyString(fmt.Sprintf(`{"aliases":{%q:{"is_write_index":true}}}`, s.writeIndex)).
+			Do(ctx)
+		if err != nil && !strings.Contains(err.Error(), "resource_already_exists_exception") {
+			return errors.Wrapf(err, "create index %s", first)
+		}
+	}
+
+	// Keep counting the views of the single index, if it was used before.
+	exists, err = s.client.IndexExists(s.index).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "index exists %s", s.index)
 	}
 
-	return s, err
+	if exists {
+		if _, err := s.client.Alias().Add(s.index, s.readIndex).Do(ctx); err != nil {
+			return errors.Wrapf(err, "add alias %s to %s", s.readIndex, s.index)
+		}
+	}
+
+	return nil
+}
+
+// Ping checks the ElasticSearch server is reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	_, _, err := s.client.Ping(s.serverUrl).Do(ctx)
+	return err
 }
 
 func (s *Store) ViewTracker() store.ViewTracker {
@@ -70,3 +364,16 @@ func (s *Store) ViewTracker() store.ViewTracker {
 func (s *Store) ViewRetriever() store.ViewRetriever {
 	return s.viewRetriever
 }
+
+func (s *Store) ViewPurger() store.ViewPurger {
+	return s.viewPurger
+}
+
+// errorLog adapts the logger to the ElasticSearch client error log.
+type errorLog struct {
+	logger *slog.Logger
+}
+
+func (l errorLog) Printf(format string, v ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
@@ -1,3 +1,4 @@
+//go:build integration
 // +build integration
 
 package elastic
@@ -8,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,12 +25,157 @@ func TestConnect(t *testing.T) {
 	}
 	defer cleanup()
 
-	exists, err := db.client.IndexExists(indexName).Do(context.Background())
+	exists, err := db.client.IndexExists(db.index).Do(context.Background())
 	if !assert.NoError(t, err) {
 		return
 	}
 
 	assert.True(t, exists, "index does not exist")
+
+	exists, err = db.client.IndexExists(db.lateIndex).Do(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, exists, "late index does not exist")
+}
+
+func TestConnectRollover(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := wait(testElasticServerURL); !assert.NoError(t, err) {
+		return
+	}
+
+	// A single index used before the rollover.
+	single, err := Connect(testElasticServerURL, WithIndex("views_rollover"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, single.viewTracker.Track(ctx, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Now()}))
+
+	db, err := Connect(testElasticServerURL, WithIndex("views_rollover"), WithRollover(Rollover{MaxAge: time.Hour, Retention: 24 * time.Hour}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_, err := db.client.DeleteIndex("views_rollover", "views_rollover-*", db.lateIndex).Do(ctx)
+		assert.NoError(t, err)
+
+		_, err = db.client.IndexDeleteTemplate("views_rollover").Do(ctx)
+		assert.NoError(t, err)
+
+		_, err = db.client.XPackIlmDeleteLifecycle().Policy("views_rollover-policy").Do(ctx)
+		assert.NoError(t, err)
+	}()
+
+	assert.Equal(t, "views_rollover-write", db.writeIndex)
+	assert.Equal(t, "views_rollover-read", db.readIndex)
+
+	aliases, err := db.client.Aliases().Index("views_rollover*").Do(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"views_rollover-000001"}, aliases.IndicesByAlias("views_rollover-write"))
+	assert.ElementsMatch(t, []string{"views_rollover", "views_rollover-000001"}, aliases.IndicesByAlias("views_rollover-read"))
+
+	policies, err := db.client.XPackIlmGetLifecycle().Policy("views_rollover-policy").Do(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Contains(t, policies, "views_rollover-policy")
+
+	// Connecting again keeps the write index.
+	_, err = Connect(testElasticServerURL, WithIndex("views_rollover"), WithRollover(Rollover{MaxAge: time.Hour}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.viewTracker.Track(ctx, store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Now()}))
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	// The views of the single index and of the rollover index are counted.
+	res, err := db.viewRetriever.Retrieve(ctx, store.ViewQuery{Tenant: "acme", ID: "1", Ranges: []store.Range{store.OneMinute}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(2), res[0].Count)
+}
+
+func TestVerify(t *testing.T) {
+	if _, err := wait(testElasticServerURL); !assert.NoError(t, err) {
+		return
+	}
+
+	_, err := Connect(testElasticServerURL, WithIndex("views_verify"), WithVerifyOnly())
+	assert.EqualError(t, err, "index views_verify does not exist, run the admin init command")
+
+	db, err := Connect(testElasticServerURL, WithIndex("views_verify"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_, err := db.client.DeleteIndex(db.index, db.lateIndex).Do(context.Background())
+		assert.NoError(t, err)
+	}()
+
+	_, err = Connect(testElasticServerURL, WithIndex("views_verify"), WithVerifyOnly())
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.viewTracker.Track(context.Background(), store.ViewTrack{Tenant: "acme", ID: "1", Timestamp: time.Now()}))
+
+	_, err = db.client.Refresh(db.index).Do(context.Background())
+	assert.NoError(t, err)
+
+	statuses, err := db.Status(context.Background())
+	if !assert.NoError(t, err) || !assert.Len(t, statuses, 2) {
+		return
+	}
+
+	assert.Equal(t, "views_verify", statuses[0].Name)
+	assert.Equal(t, int64(1), statuses[0].Docs)
+	assert.True(t, statuses[0].SizeBytes > 0)
+	assert.Equal(t, "views_verify_late", statuses[1].Name)
+}
+
+func TestTrackLate(t *testing.T) {
+	db, cleanup, err := connect(t)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cleanup()
+
+	err = db.viewTracker.BatchTrack(context.Background(), []store.ViewTrack{
+		{Tenant: "acme", ID: "1", Timestamp: time.Now()},
+		{Tenant: "acme", ID: "1", Timestamp: time.Now().Add(-time.Hour), Late: true},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for consistency, since elastic is eventual consistency
+	time.Sleep(1 * time.Second)
+
+	for index, want := range map[string]int64{db.index: 1, db.lateIndex: 1} {
+		count, err := db.client.Count(index).Do(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, count, index)
+		}
+	}
+
+	// The late views are not counted.
+	res, err := db.viewRetriever.Retrieve(context.Background(), store.ViewQuery{
+		Tenant: "acme",
+		ID:     "1",
+		Ranges: []store.Range{store.OneDay},
+	})
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.Equal(t, int64(1), res[0].Count)
+	}
 }
 
 func connect(t *testing.T) (*Store, func(), error) {
@@ -42,7 +190,7 @@ func connect(t *testing.T) (*Store, func(), error) {
 	}
 
 	cleanup := func() {
-		_, err = db.client.DeleteIndex(indexName).Do(context.Background())
+		_, err = db.client.DeleteIndex(db.index, db.lateIndex).Do(context.Background())
 		if !assert.NoError(t, err) {
 			return
 		}
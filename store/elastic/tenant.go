@@ -0,0 +1,35 @@
+package elastic
+
+import (
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/pkg/errors"
+)
+
+// tenantQuery returns a query matching only the documents of the tenant, and the filters.
+// Every query on the views of a tenant must be built by it, so a tenant never sees the views of another.
+func tenantQuery(tenant string, filters ...elastic.Query) (*elastic.BoolQuery, error) {
+	if tenant == "" {
+		return nil, errors.New("tenant is empty")
+	}
+
+	return elastic.NewBoolQuery().Filter(append([]elastic.Query{tenantFilter(tenant)}, filters...)...), nil
+}
+
+// tenantFilter matches the documents of the tenant. The documents indexed before the tenants have no tenant field,
+// they belong to the default tenant until the migration sets it.
+func tenantFilter(tenant string) elastic.Query {
+	if tenant != store.DefaultTenant {
+		return elastic.NewTermQuery("tenant", tenant)
+	}
+
+	return elastic.NewBoolQuery().
+		Should(elastic.NewTermQuery("tenant", tenant), withoutTenant()).
+		MinimumNumberShouldMatch(1)
+}
+
+// withoutTenant matches the documents without a tenant field.
+func withoutTenant() elastic.Query {
+	return elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("tenant"))
+}
@@ -0,0 +1,108 @@
+package elastic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantQuery(t *testing.T) {
+	_, err := tenantQuery("")
+	assert.Error(t, err)
+
+	query, err := tenantQuery("acme", elastic.NewTermQuery("id", "1"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"tenant": "acme"}},
+				map[string]interface{}{"term": map[string]interface{}{"id": "1"}},
+			},
+		},
+	}, source(t, query))
+
+	// The documents without a tenant belong to the default tenant.
+	query, err = tenantQuery(store.DefaultTenant)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"minimum_should_match": "1",
+					"should": []interface{}{
+						map[string]interface{}{"term": map[string]interface{}{"tenant": store.DefaultTenant}},
+						map[string]interface{}{"bool": map[string]interface{}{
+							"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "tenant"}},
+						}},
+					},
+				},
+			},
+		},
+	}, source(t, query))
+}
+
+func TestPurgeQuery(t *testing.T) {
+	_, err := purgeQuery(store.PurgeFilter{ExcludeTenants: []string{"acme"}})
+	assert.Error(t, err, "whole index")
+
+	query, err := purgeQuery(store.PurgeFilter{Tenant: "acme"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": map[string]interface{}{"term": map[string]interface{}{"tenant": "acme"}},
+			},
+		}, source(t, query))
+	}
+
+	before := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	query, err = purgeQuery(store.PurgeFilter{Before: before, ExcludeTenants: []string{"acme"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						"timestamp": map[string]interface{}{
+							"from":          nil,
+							"include_lower": true,
+							"include_upper": false,
+							"to":            before,
+						},
+					},
+				},
+				"must_not": map[string]interface{}{"terms": map[string]interface{}{"tenant": []interface{}{"acme"}}},
+			},
+		}, source(t, query))
+	}
+
+	query, err = purgeQuery(store.PurgeFilter{Before: before, ExcludeTenants: []string{store.DefaultTenant}})
+	if assert.NoError(t, err) {
+		src := source(t, query).(map[string]interface{})["bool"].(map[string]interface{})
+
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "tenant"}},
+			}},
+			map[string]interface{}{"terms": map[string]interface{}{"tenant": []interface{}{store.DefaultTenant}}},
+		}, src["must_not"])
+	}
+}
+
+func source(t *testing.T, query elastic.Query) interface{} {
+	src, err := query.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return src
+}
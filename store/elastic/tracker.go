@@ -2,31 +2,83 @@ package elastic
 
 import (
 	"context"
+	"log/slog"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/olivere/elastic/v7"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ store.ViewTracker = (*viewTracker)(nil)
 
 type viewTracker struct {
-	client *elastic.Client
+	client    *elastic.Client
+	index     string
+	lateIndex string
+	logger    *slog.Logger
+}
+
+// indexOf returns the index of the view, the late views are not counted.
+func (t *viewTracker) indexOf(v store.ViewTrack) string {
+	if v.Late {
+		return t.lateIndex
+	}
+
+	return t.index
 }
 
 func (t *viewTracker) Track(ctx context.Context, v store.ViewTrack) error {
-	_, err := t.client.Index().Index(indexName).BodyJson(v).Do(ctx)
+	ctx, span := tracer.Start(ctx, "elastic.Index",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, tracing.IDAttribute(v.ID)))
+	defer span.End()
+
+	_, err := t.client.Index().Index(t.indexOf(v)).BodyJson(v).Do(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+
 	return err
 }
 
 func (t *viewTracker) BatchTrack(ctx context.Context, vs []store.ViewTrack) error {
+	ctx, span := tracer.Start(ctx, "elastic.Bulk",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, attribute.Int("batch.size", len(vs))))
+	defer span.End()
+
 	bulk := t.client.Bulk()
 
 	for i := range vs {
-		bulk.Add(elastic.NewBulkIndexRequest().Index(indexName).UseEasyJSON(true).Doc(vs[i]))
+		bulk.Add(elastic.NewBulkIndexRequest().Index(t.indexOf(vs[i])).UseEasyJSON(true).Doc(vs[i]))
 	}
 
-	_, err := bulk.Do(ctx)
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
 
-	return err
+	// The bulk request succeeds even if some of the documents fail to be indexed.
+	if failed := res.Failed(); len(failed) > 0 {
+		span.SetAttributes(attribute.Int("batch.failed", len(failed)))
+
+		attrs := []slog.Attr{
+			slog.Int("batch_size", len(vs)),
+			slog.Int("failed", len(failed)),
+		}
+
+		if failed[0].Error != nil {
+			attrs = append(attrs,
+				slog.String("error_type", failed[0].Error.Type),
+				slog.String("error_reason", failed[0].Error.Reason))
+		}
+
+		t.logger.LogAttrs(ctx, slog.LevelError, "bulk index failed documents", attrs...)
+	}
+
+	return nil
 }
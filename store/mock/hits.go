@@ -0,0 +1,83 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+// Hits returns an OnHits func paging the views in memory, e.g. to test a pagination.
+// The cursor is the offset of the page, then the From and To of the first page in Unix nanoseconds.
+func Hits(views []store.ViewTrack) func(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+	return func(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+		var offset int
+
+		if q.After != "" {
+			var err error
+			if offset, q.From, q.To, err = decodeCursor(q.After); err != nil {
+				return store.HitPage{}, err
+			}
+		}
+
+		var hits []store.ViewTrack
+
+		for _, v := range views {
+			if v.Tenant == q.Tenant && v.ID == q.ID && !v.Timestamp.Before(q.From) && v.Timestamp.Before(q.To) {
+				hits = append(hits, v)
+			}
+		}
+
+		sort.SliceStable(hits, func(i, j int) bool {
+			if q.Newest {
+				return hits[i].Timestamp.After(hits[j].Timestamp)
+			}
+
+			return hits[i].Timestamp.Before(hits[j].Timestamp)
+		})
+
+		if offset > len(hits) {
+			return store.HitPage{}, store.ErrInvalidCursor
+		}
+
+		size := q.Size
+		if size == 0 {
+			size = 1000
+		}
+
+		page := store.HitPage{Hits: hits[offset:]}
+
+		if len(page.Hits) > size {
+			page.Hits = page.Hits[:size]
+			page.Next = fmt.Sprintf("%d:%d:%d", offset+size, q.From.UnixNano(), q.To.UnixNano())
+		}
+
+		return page, nil
+	}
+}
+
+func decodeCursor(cursor string) (offset int, from, to time.Time, err error) {
+	parts := strings.Split(cursor, ":")
+	if len(parts) != 3 {
+		return 0, from, to, store.ErrInvalidCursor
+	}
+
+	var nanos [2]int64
+
+	offset, err = strconv.Atoi(parts[0])
+	if err == nil {
+		nanos[0], err = strconv.ParseInt(parts[1], 10, 64)
+	}
+	if err == nil {
+		nanos[1], err = strconv.ParseInt(parts[2], 10, 64)
+	}
+	if err != nil || offset < 0 {
+		return 0, from, to, store.ErrInvalidCursor
+	}
+
+	return offset, time.Unix(0, nanos[0]).UTC(), time.Unix(0, nanos[1]).UTC(), nil
+}
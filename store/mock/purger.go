@@ -0,0 +1,22 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
+)
+
+var _ store.ViewPurger = (*ViewPurger)(nil)
+
+type ViewPurger struct {
+	OnPurge       func(ctx context.Context, f store.PurgeFilter) (string, error)
+	OnPurgeStatus func(ctx context.Context, taskID string) (store.PurgeStatus, error)
+}
+
+func (p *ViewPurger) Purge(ctx context.Context, f store.PurgeFilter) (string, error) {
+	return p.OnPurge(ctx, f)
+}
+
+func (p *ViewPurger) PurgeStatus(ctx context.Context, taskID string) (store.PurgeStatus, error) {
+	return p.OnPurgeStatus(ctx, taskID)
+}
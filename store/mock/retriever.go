@@ -9,9 +9,19 @@ import (
 var _ store.ViewRetriever = (*ViewRetriever)(nil)
 
 type ViewRetriever struct {
-	OnRetrieve func(ctx context.Context, id string, ranges ...store.Range) ([]store.ViewCount, error)
+	OnRetrieve  func(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error)
+	OnHistogram func(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error)
+	OnHits      func(ctx context.Context, q store.HitQuery) (store.HitPage, error)
 }
 
-func (r *ViewRetriever) Retrieve(ctx context.Context, id string, ranges ...store.Range) ([]store.ViewCount, error) {
-	return r.OnRetrieve(ctx, id, ranges...)
+func (r *ViewRetriever) Retrieve(ctx context.Context, q store.ViewQuery) ([]store.ViewCount, error) {
+	return r.OnRetrieve(ctx, q)
+}
+
+func (r *ViewRetriever) Histogram(ctx context.Context, q store.HistogramQuery) ([]store.Bucket, error) {
+	return r.OnHistogram(ctx, q)
+}
+
+func (r *ViewRetriever) Hits(ctx context.Context, q store.HitQuery) (store.HitPage, error) {
+	return r.OnHits(ctx, q)
 }
@@ -9,6 +9,7 @@ var _ store.Store = (*Store)(nil)
 type Store struct {
 	ViewTrackerStore   store.ViewTracker
 	ViewRetrieverStore store.ViewRetriever
+	ViewPurgerStore    store.ViewPurger
 }
 
 func (s *Store) ViewTracker() store.ViewTracker {
@@ -18,3 +19,7 @@ func (s *Store) ViewTracker() store.ViewTracker {
 func (s *Store) ViewRetriever() store.ViewRetriever {
 	return s.ViewRetrieverStore
 }
+
+func (s *Store) ViewPurger() store.ViewPurger {
+	return s.ViewPurgerStore
+}
@@ -1,5 +1,9 @@
 package store
 
+import (
+	"github.com/pkg/errors"
+)
+
 type Range int
 
 const (
@@ -9,9 +13,46 @@ const (
 	OneDay
 	OneWeek
 	OneMonth
+	// The calendar ranges are aligned on the days, weeks and months in the location of the query.
+	Today
+	Yesterday
+	ThisWeek
+	MonthToDate
+	PreviousMonth
 	NumRange // Used to get all the range constants.
 )
 
+// rangeNames are the names of the ranges in the queries.
+var rangeNames = map[Range]string{
+	OneMinute:     "1m",
+	FiveMinute:    "5m",
+	OneHour:       "1h",
+	OneDay:        "1d",
+	OneWeek:       "7d",
+	OneMonth:      "30d",
+	Today:         "today",
+	Yesterday:     "yesterday",
+	ThisWeek:      "this_week",
+	MonthToDate:   "month_to_date",
+	PreviousMonth: "previous_month",
+}
+
+// ParseRange returns the range of the name, e.g. 1h or today.
+func ParseRange(name string) (Range, error) {
+	for rang, n := range rangeNames {
+		if n == name {
+			return rang, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown range %q", name)
+}
+
+// Calendar returns true for the calendar ranges, as opposed to the rolling ranges ending now.
+func (r Range) Calendar() bool {
+	return r >= Today && r < NumRange
+}
+
 // TODO add unit test
 // Get the description for the interval
 func RangeDescription(rang Range) string {
@@ -28,6 +69,16 @@ func RangeDescription(rang Range) string {
 		return "2 week ago"
 	case OneMonth:
 		return "1 month ago"
+	case Today:
+		return "today"
+	case Yesterday:
+		return "yesterday"
+	case ThisWeek:
+		return "this week"
+	case MonthToDate:
+		return "this month"
+	case PreviousMonth:
+		return "last month"
 	default:
 		return ""
 	}
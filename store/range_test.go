@@ -2,6 +2,8 @@ package store
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Test each range constant should have description.
@@ -12,3 +14,19 @@ func TestRangeDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRange(t *testing.T) {
+	for i := 0; i < int(NumRange); i++ {
+		rang, err := ParseRange(rangeNames[Range(i)])
+		if assert.NoError(t, err, "range %d", i) {
+			assert.Equal(t, Range(i), rang)
+		}
+	}
+
+	_, err := ParseRange("1y")
+	assert.EqualError(t, err, `unknown range "1y"`)
+
+	assert.False(t, OneMonth.Calendar())
+	assert.True(t, Today.Calendar())
+	assert.True(t, PreviousMonth.Calendar())
+}
@@ -1,22 +1,92 @@
 package redis
 
 import (
+	"context"
+	"time"
+
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/adjust/rmq"
+	"gopkg.in/redis.v3"
 )
 
 var _ store.ViewTracker = (*ViewTracker)(nil)
 
+// Default queue names.
+const (
+	SingleQueue = "view_single"
+	BatchQueue  = "view_batch"
+)
+
+type options struct {
+	singleQueue string
+	batchQueue  string
+}
+
+type Option func(*options)
+
+// WithQueues sets the names of the queue for the single views and the batches.
+// Default is view_single and view_batch.
+func WithQueues(single, batch string) func(*options) {
+	return func(o *options) {
+		o.singleQueue = single
+		o.batchQueue = batch
+	}
+}
+
 // addr must include port. e.g. 127.0.0.1:6379
-func Connect(addr string, db int) *ViewTracker {
-	conn := rmq.OpenConnection("producer", "tcp", addr, db)
+func Connect(addr string, db int, opts ...Option) *ViewTracker {
+	o := options{
+		singleQueue: SingleQueue,
+		batchQueue:  BatchQueue,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	client := NewClient(addr, db)
+
+	conn := rmq.OpenConnectionWithRedisClient("producer", client)
 
 	viewTracker := &ViewTracker{
+		client:      client,
 		conn:        conn,
-		singleQueue: conn.OpenQueue("view_single"),
-		batchQueue:  conn.OpenQueue("view_batch"),
+		singleQueue: conn.OpenQueue(o.singleQueue),
+		batchQueue:  conn.OpenQueue(o.batchQueue),
 	}
 
 	return viewTracker
 }
+
+// NewClient creates a Redis client. addr must include port. e.g. 127.0.0.1:6379
+func NewClient(addr string, db int) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Network:     "tcp",
+		Addr:        addr,
+		DB:          int64(db),
+		DialTimeout: 3 * time.Second,
+	})
+}
+
+// Ping checks the Redis server is reachable.
+func (t *ViewTracker) Ping(ctx context.Context) error {
+	return Ping(ctx, t.client)
+}
+
+// Ping checks the Redis server of the client is reachable.
+// The client doesn't support context, so the ping is abandoned, but not cancelled, when ctx is done.
+func Ping(ctx context.Context, client *redis.Client) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- client.Ping().Err()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,29 +4,46 @@ import (
 	"context"
 	"time"
 
+	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/internal/tracing"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/proto"
 	"github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store"
 
 	"github.com/adjust/rmq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/redis.v3"
 )
 
 var _ store.ViewTracker = (*ViewTracker)(nil)
 
+var tracer = otel.Tracer("github.com/ahmadmuzakkir/redis-elasticsearch-go-example/store/redis")
+
 type ViewTracker struct {
-	conn rmq.Connection
+	client *redis.Client
+	conn   rmq.Connection
 
 	singleQueue rmq.Queue
 	batchQueue  rmq.Queue
 }
 
 func (t *ViewTracker) Track(ctx context.Context, v store.ViewTrack) error {
+	ctx, span := tracer.Start(ctx, "redis.Publish view_single",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(tracing.IDAttribute(v.ID)))
+	defer span.End()
+
 	req := &proto.ViewTrackRequest{
-		Id: []byte(v.ID),
-		Timestamp: v.Timestamp.UnixNano(),
+		Id:           []byte(v.ID),
+		Timestamp:    v.Timestamp.UnixNano(),
+		TraceContext: tracing.Inject(ctx),
+		Tenant:       v.Tenant,
+		Late:         v.Late,
 	}
 
 	msg, err := req.Marshal()
 	if err != nil {
+		tracing.RecordError(span, err)
 		return err
 	}
 
@@ -37,15 +54,23 @@ func (t *ViewTracker) Track(ctx context.Context, v store.ViewTrack) error {
 
 // BatchTrack sends all the tracks in a single request.
 func (t *ViewTracker) BatchTrack(ctx context.Context, vs []store.ViewTrack) error {
+	ctx, span := tracer.Start(ctx, "redis.Publish view_batch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int("batch.size", len(vs))))
+	defer span.End()
+
 	batch := &proto.ViewTrackBatchRequest{
 		Requests:      make([]*proto.ViewTrackRequest, 0, len(vs)),
 		SentTimestamp: time.Now().UnixNano(),
+		TraceContext:  tracing.Inject(ctx),
 	}
 
 	for _, v := range vs {
 		req := &proto.ViewTrackRequest{
-			Id: []byte(v.ID),
+			Id:        []byte(v.ID),
 			Timestamp: v.Timestamp.UnixNano(),
+			Tenant:    v.Tenant,
+			Late:      v.Late,
 		}
 
 		batch.Requests = append(batch.Requests, req)
@@ -53,6 +78,7 @@ func (t *ViewTracker) BatchTrack(ctx context.Context, vs []store.ViewTrack) erro
 
 	msg, err := batch.Marshal()
 	if err != nil {
+		tracing.RecordError(span, err)
 		return err
 	}
 
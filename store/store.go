@@ -2,17 +2,109 @@ package store
 
 import (
 	"context"
+	"math"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
+// DefaultTenant is the tenant used when the authentication is disabled,
+// and for the views tracked before the tenants were introduced.
+const DefaultTenant = "default"
+
 type ViewTrack struct {
+	Tenant    string    `json:"tenant"`
 	ID        string    `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
+	// Late is set for the views older than the max past skew, they are stored apart and not counted.
+	Late bool `json:"-"`
 }
 
 type ViewCount struct {
 	Description string `json:"reference"`
 	Count       int64  `json:"count"`
+	// From and To are the period of a calendar range, in the location of the query.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Previous is the count of the previous period of the same length, set when the query compares the periods.
+	Previous *int64 `json:"previous,omitempty"`
+	// Change is Count minus Previous, and ChangePercent the change relative to Previous, unset if Previous is 0.
+	Change        *int64   `json:"change,omitempty"`
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+// Compare sets the count of the previous period, and the change from it.
+func (c *ViewCount) Compare(previous int64) {
+	change := c.Count - previous
+
+	c.Previous = &previous
+	c.Change = &change
+	c.ChangePercent = nil
+
+	if previous > 0 {
+		// Rounded to 2 decimals.
+		percent := math.Round(float64(change)/float64(previous)*10000) / 100
+		c.ChangePercent = &percent
+	}
+}
+
+// ViewQuery selects the views of an ID. The views of other tenants are never counted.
+type ViewQuery struct {
+	Tenant string
+	ID     string
+	Ranges []Range
+	// Location of the calendar ranges. Nil is UTC.
+	Location *time.Location
+	// WeekStart is the first day of the ThisWeek range.
+	WeekStart time.Weekday
+	// Compare counts the previous period of each range too, e.g. the hour before the last hour,
+	// or yesterday until the same time for today.
+	Compare bool
+}
+
+// HistogramQuery selects the views of an ID in [From, To), counted per Interval.
+type HistogramQuery struct {
+	Tenant string
+	ID     string
+	// Interval of the buckets, time.Hour or 24 * time.Hour. The buckets are aligned on the interval in UTC.
+	Interval time.Duration
+	From     time.Time
+	To       time.Time
+}
+
+// Bucket is the count of the views from Timestamp, for the interval of the histogram.
+type Bucket struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+}
+
+var (
+	// ErrInvalidCursor is returned when the cursor of a HitQuery is not the cursor of a page.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorExpired is returned when the cursor of a HitQuery is no longer valid, the next page was not read in time.
+	ErrCursorExpired = errors.New("cursor expired")
+)
+
+// HitQuery selects the views of an ID in [From, To), in order of time, a page at a time.
+type HitQuery struct {
+	Tenant string
+	ID     string
+	From   time.Time
+	To     time.Time
+	// Newest returns the newest views first.
+	Newest bool
+	// Size of the page.
+	Size int
+	// After is the cursor of the page, HitPage.Next of the previous page of the same query. Empty is the first page.
+	// The cursor keeps the From and To of the first page, so they are ignored with a cursor.
+	After string
+}
+
+// HitPage is a page of the views of a HitQuery.
+type HitPage struct {
+	Hits []ViewTrack
+	// Next is the cursor of the next page, empty on the last page.
+	Next string
 }
 
 type ViewTracker interface {
@@ -22,11 +114,51 @@ type ViewTracker interface {
 }
 
 type ViewRetriever interface {
-	Retrieve(ctx context.Context, id string, ranges ...Range) ([]ViewCount, error)
+	Retrieve(ctx context.Context, q ViewQuery) ([]ViewCount, error)
+
+	// Histogram returns every bucket between From and To in order, including the empty ones.
+	Histogram(ctx context.Context, q HistogramQuery) ([]Bucket, error)
+
+	// Hits returns a page of the views.
+	Hits(ctx context.Context, q HitQuery) (HitPage, error)
+}
+
+// PurgeFilter selects the views to delete. Tenant or Before must be set, to never delete the whole index by mistake.
+type PurgeFilter struct {
+	// Delete the views of the tenant. Empty is every tenant, except ExcludeTenants.
+	Tenant         string
+	ExcludeTenants []string
+	// Delete the views of the ID, of the Tenant. Empty is every ID.
+	ID string
+	// Delete the views older than Before. Zero is every view.
+	Before time.Time
+}
+
+// PurgeStatus is the progress of a purge task.
+type PurgeStatus struct {
+	Completed bool
+	Total     int64
+	Deleted   int64
+	// Error is set if the task failed.
+	Error string
+}
+
+// ErrTaskNotFound is returned by PurgeStatus when the task does not exist.
+var ErrTaskNotFound = errors.New("task not found")
+
+// ViewPurger deletes the views in the background, since it can take a while on a large index.
+type ViewPurger interface {
+	// Purge starts deleting the views matched by the filter and returns the task ID.
+	Purge(ctx context.Context, f PurgeFilter) (string, error)
+
+	// PurgeStatus returns the progress of the task, or ErrTaskNotFound.
+	PurgeStatus(ctx context.Context, taskID string) (PurgeStatus, error)
 }
 
 type Store interface {
 	ViewTracker() ViewTracker
 
 	ViewRetriever() ViewRetriever
+
+	ViewPurger() ViewPurger
 }
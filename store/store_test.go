@@ -0,0 +1,34 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewCountCompare(t *testing.T) {
+	count := ViewCount{Description: "1 hour ago", Count: 12}
+	count.Compare(9)
+
+	if assert.NotNil(t, count.Previous) && assert.NotNil(t, count.Change) && assert.NotNil(t, count.ChangePercent) {
+		assert.Equal(t, int64(9), *count.Previous)
+		assert.Equal(t, int64(3), *count.Change)
+		assert.Equal(t, 33.33, *count.ChangePercent)
+	}
+
+	count.Compare(0)
+
+	if assert.NotNil(t, count.Previous) && assert.NotNil(t, count.Change) {
+		assert.Equal(t, int64(0), *count.Previous)
+		assert.Equal(t, int64(12), *count.Change)
+		assert.Nil(t, count.ChangePercent)
+	}
+
+	count = ViewCount{Count: 0}
+	count.Compare(4)
+
+	if assert.NotNil(t, count.ChangePercent) {
+		assert.Equal(t, int64(-4), *count.Change)
+		assert.Equal(t, float64(-100), *count.ChangePercent)
+	}
+}